@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// tokenAudience is the audience callers' tokens must be issued for, so
+	// that a token sent to an agent cannot be used against the API server.
+	tokenAudience = "jarvis-agent"
+	// execSubresource is the virtual node subresource callers need the
+	// "create" verb on, for the agent's own node, to call it.
+	execSubresource = "jarvis-exec"
+	// allowedTTL and deniedTTL are how long decisions are cached. Denials
+	// are kept briefly so that a newly granted role takes effect quickly.
+	allowedTTL = 2 * time.Minute
+	deniedTTL  = 10 * time.Second
+	// maxCachedDecisions bounds the cache; it is emptied when full.
+	maxCachedDecisions = 1024
+)
+
+// caller is who made a call, as the API server sees them.
+type caller struct {
+	User   string
+	Groups []string
+}
+
+type callerKey struct{}
+
+// callerFrom returns who made the call ctx belongs to, if it was checked.
+func callerFrom(ctx context.Context) (caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(caller)
+	return c, ok
+}
+
+// decision is the cached outcome of checking a token.
+type decision struct {
+	caller  caller
+	err     error
+	expires time.Time
+}
+
+// authorizer admits a call if it carries a bearer token the API server
+// vouches for, whose user may create nodes/jarvis-exec on this node.
+type authorizer struct {
+	client kubernetes.Interface
+	node   string
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]decision
+}
+
+// authorize checks the token the call in ctx carries and returns ctx with
+// the caller attached.
+func (a *authorizer) authorize(ctx context.Context) (context.Context, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256([]byte(token))
+	a.mu.Lock()
+	d, ok := a.cache[key]
+	a.mu.Unlock()
+	if !ok || time.Now().After(d.expires) {
+		d = a.review(ctx, token)
+		if status.Code(d.err) == codes.Unavailable {
+			// Not a decision; ask again next time.
+			return nil, d.err
+		}
+		a.mu.Lock()
+		if a.cache == nil || len(a.cache) >= maxCachedDecisions {
+			a.cache = map[[sha256.Size]byte]decision{}
+		}
+		a.cache[key] = d
+		a.mu.Unlock()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return context.WithValue(ctx, callerKey{}, d.caller), nil
+}
+
+// review asks the API server who token belongs to and whether they may call
+// this agent.
+func (a *authorizer) review(ctx context.Context, token string) decision {
+	tr, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token, Audiences: []string{tokenAudience}},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		a.logger.Error("TokenReview failed", "error", err)
+		return decision{err: status.Error(codes.Unavailable, "unable to authenticate the caller")}
+	}
+	if !tr.Status.Authenticated || !slices.Contains(tr.Status.Audiences, tokenAudience) {
+		a.logger.Info("Rejected call with invalid token", "error", tr.Status.Error)
+		return decision{
+			err:     status.Error(codes.Unauthenticated, "invalid token"),
+			expires: time.Now().Add(deniedTTL),
+		}
+	}
+	user := tr.Status.User
+	c := caller{User: user.Username, Groups: user.Groups}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:        "create",
+				Resource:    "nodes",
+				Subresource: execSubresource,
+				Name:        a.node,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		a.logger.Error("SubjectAccessReview failed", "user", c.User, "error", err)
+		return decision{err: status.Error(codes.Unavailable, "unable to authorize the caller")}
+	}
+	if !sar.Status.Allowed {
+		a.logger.Info("Denied call", "user", c.User, "reason", sar.Status.Reason)
+		return decision{
+			caller:  c,
+			err:     status.Errorf(codes.PermissionDenied, "%s may not create nodes/%s on %s", c.User, execSubresource, a.node),
+			expires: time.Now().Add(deniedTTL),
+		}
+	}
+	return decision{caller: c, expires: time.Now().Add(allowedTTL)}
+}
+
+// bearerToken returns the token in the call's authorization header.
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || token == "" {
+		return "", status.Error(codes.Unauthenticated, "authorization is not a bearer token")
+	}
+	return token, nil
+}
+
+func (a *authorizer) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := a.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a.logCall(ctx, info.FullMethod)
+	return handler(ctx, req)
+}
+
+func (a *authorizer) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authorize(ss.Context())
+	if err != nil {
+		return err
+	}
+	a.logCall(ctx, info.FullMethod)
+	return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+}
+
+// authorizedStream carries the caller in its context.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *authorizer) logCall(ctx context.Context, method string) {
+	c, _ := callerFrom(ctx)
+	a.logger.Info("Authorized call", "method", method, "caller", c.User, "groups", c.Groups)
+}
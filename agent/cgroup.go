@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"golang.org/x/sys/unix"
+)
+
+// cgroupRoot is the cgroup v2 directory, on the host's hierarchy, under
+// which commands with resource limits each get a cgroup of their own. It is
+// created if missing. Empty refuses such commands.
+var cgroupRoot = "/host-cgroup/jarvis.slice"
+
+// hostCgroupNamespace is joined before moving a command into its cgroup.
+// The kernel only moves processes between cgroups visible in the mover's
+// cgroup namespace, and the agent's own only shows its container. With
+// hostPID, PID 1 is the host's init.
+const hostCgroupNamespace = "/proc/1/ns/cgroup"
+
+// cpuPeriod is the period cpu.max quotas are given over, and minCPUQuota the
+// smallest quota the kernel accepts, both in microseconds.
+const (
+	cpuPeriod   = 100000
+	minCPUQuota = 1000
+)
+
+// cgroup is the transient cgroup a command runs in. It is removed, along
+// with any process the command left behind, once the command has finished.
+type cgroup struct {
+	dir string
+}
+
+// needsCgroup reports whether limits sets anything that takes a cgroup to
+// enforce.
+func needsCgroup(limits *pb.ResourceLimits) bool {
+	return limits.GetCpuMillis() > 0 || limits.GetMemoryBytes() > 0 || limits.GetIoWeight() > 0 || limits.GetPidsMax() > 0
+}
+
+// newCgroup creates a cgroup under cgroupRoot enforcing limits.
+func newCgroup(limits *pb.ResourceLimits) (*cgroup, error) {
+	if cgroupRoot == "" {
+		return nil, errors.New("this agent does not limit resources; it was started without --cgroup-root")
+	}
+	var fs unix.Statfs_t
+	if err := unix.Statfs(filepath.Dir(cgroupRoot), &fs); err != nil {
+		return nil, fmt.Errorf("cgroup filesystem is not mounted: %w", err)
+	}
+	if fs.Type != unix.CGROUP2_SUPER_MAGIC {
+		return nil, fmt.Errorf("%s is not a cgroup v2 filesystem", filepath.Dir(cgroupRoot))
+	}
+	return createCgroup(cgroupRoot, limits)
+}
+
+// createCgroup creates a cgroup under root, a directory on a cgroup v2
+// filesystem, enforcing limits.
+func createCgroup(root string, limits *pb.ResourceLimits) (*cgroup, error) {
+	if err := os.Mkdir(root, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+
+	files := map[string]string{}
+	controllers := []string{}
+	if millis := limits.GetCpuMillis(); millis > 0 {
+		quota := max(millis*cpuPeriod/1000, minCPUQuota)
+		files["cpu.max"] = fmt.Sprintf("%d %d", quota, cpuPeriod)
+		controllers = append(controllers, "cpu")
+	}
+	if memory := limits.GetMemoryBytes(); memory > 0 {
+		files["memory.max"] = strconv.FormatInt(memory, 10)
+		controllers = append(controllers, "memory")
+	}
+	if weight := limits.GetIoWeight(); weight > 0 {
+		files["io.weight"] = fmt.Sprintf("default %d", weight)
+		controllers = append(controllers, "io")
+	}
+	if pids := limits.GetPidsMax(); pids > 0 {
+		files["pids.max"] = strconv.FormatInt(pids, 10)
+		controllers = append(controllers, "pids")
+	}
+	for _, c := range controllers {
+		if err := os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+"+c), 0o644); err != nil {
+			return nil, fmt.Errorf("enabling the %s controller in %s: %w", c, root, err)
+		}
+	}
+
+	name := make([]byte, 8)
+	if _, err := rand.Read(name); err != nil {
+		return nil, err
+	}
+	cg := &cgroup{dir: filepath.Join(root, "run-"+hex.EncodeToString(name)+".scope")}
+	if err := os.Mkdir(cg.dir, 0o755); err != nil {
+		return nil, err
+	}
+	for file, value := range files {
+		if err := os.WriteFile(filepath.Join(cg.dir, file), []byte(value), 0o644); err != nil {
+			cg.remove()
+			return nil, fmt.Errorf("setting %s to %q: %w", file, value, err)
+		}
+	}
+	if limits.GetMemoryBytes() > 0 {
+		// Otherwise the command would swap rather than stop at its limit.
+		// Without swap accounting there is no file, and nothing to stop.
+		err := os.WriteFile(filepath.Join(cg.dir, "memory.swap.max"), []byte("0"), 0o644)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			cg.remove()
+			return nil, fmt.Errorf("setting memory.swap.max: %w", err)
+		}
+	}
+	return cg, nil
+}
+
+// limitsHit reports the limits the command ran into.
+func (cg *cgroup) limitsHit() []pb.Limit {
+	var hit []pb.Limit
+	if cg.counter("cpu.stat", "nr_throttled") > 0 {
+		hit = append(hit, pb.Limit_LIMIT_CPU)
+	}
+	if cg.counter("memory.events", "max") > 0 {
+		hit = append(hit, pb.Limit_LIMIT_MEMORY)
+	}
+	if cg.counter("memory.events", "oom_kill") > 0 {
+		hit = append(hit, pb.Limit_LIMIT_OOM_KILL)
+	}
+	if cg.counter("pids.events", "max") > 0 {
+		hit = append(hit, pb.Limit_LIMIT_PIDS)
+	}
+	return hit
+}
+
+// counter reads key from one of the cgroup's flat keyed files. A file or
+// key that is missing, as for a controller that is not enabled, reads as
+// zero.
+func (cg *cgroup) counter(file, key string) int64 {
+	data, err := os.ReadFile(filepath.Join(cg.dir, file))
+	if err != nil {
+		return 0
+	}
+	for line := range strings.Lines(string(data)) {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == key {
+			n, _ := strconv.ParseInt(fields[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// remove kills whatever is left in the cgroup and removes it.
+func (cg *cgroup) remove() {
+	_ = os.WriteFile(filepath.Join(cg.dir, "cgroup.kill"), []byte("1"), 0)
+	// The cgroup stays busy until the killed processes have been reaped.
+	for range 50 {
+		if err := unix.Rmdir(cg.dir); err == nil || errors.Is(err, unix.ENOENT) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// joinCgroup moves the calling process into the cgroup whose cgroup.procs
+// is open as procs. It runs in the sandbox helper, which has joined
+// hostCgroupNamespace.
+func joinCgroup(procs *os.File) error {
+	if _, err := procs.WriteString("0"); err != nil {
+		return fmt.Errorf("joining cgroup: %w", err)
+	}
+	return procs.Close()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+)
+
+func TestCreateCgroup(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits *pb.ResourceLimits
+		// files are what the cgroup's files must hold; "" means missing.
+		files       map[string]string
+		controllers string
+	}{
+		{
+			name:        "cpu",
+			limits:      &pb.ResourceLimits{CpuMillis: 250},
+			files:       map[string]string{"cpu.max": "25000 100000", "memory.max": "", "memory.swap.max": ""},
+			controllers: "+cpu",
+		},
+		{
+			name:        "cpu below the smallest quota",
+			limits:      &pb.ResourceLimits{CpuMillis: 1},
+			files:       map[string]string{"cpu.max": "1000 100000"},
+			controllers: "+cpu",
+		},
+		{
+			name:        "memory without swap",
+			limits:      &pb.ResourceLimits{MemoryBytes: 64 << 20},
+			files:       map[string]string{"memory.max": "67108864", "memory.swap.max": "0", "cpu.max": ""},
+			controllers: "+memory",
+		},
+		{
+			name:   "everything",
+			limits: &pb.ResourceLimits{CpuMillis: 2000, MemoryBytes: 1 << 30, IoWeight: 50, PidsMax: 100},
+			files: map[string]string{
+				"cpu.max":         "200000 100000",
+				"memory.max":      "1073741824",
+				"memory.swap.max": "0",
+				"io.weight":       "default 50",
+				"pids.max":        "100",
+			},
+			// Each controller is enabled with a write of its own.
+			controllers: "+pids",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !needsCgroup(tt.limits) {
+				t.Fatalf("needsCgroup(%v) = false", tt.limits)
+			}
+			root := filepath.Join(t.TempDir(), "jarvis.slice")
+			cg, err := createCgroup(root, tt.limits)
+			if err != nil {
+				t.Fatalf("createCgroup() error = %v", err)
+			}
+			if filepath.Dir(cg.dir) != root {
+				t.Errorf("cgroup %s is not under %s", cg.dir, root)
+			}
+			for file, want := range tt.files {
+				data, err := os.ReadFile(filepath.Join(cg.dir, file))
+				if want == "" {
+					if !os.IsNotExist(err) {
+						t.Errorf("%s = %q, want it missing", file, data)
+					}
+					continue
+				}
+				if err != nil || string(data) != want {
+					t.Errorf("%s = %q (%v), want %q", file, data, err, want)
+				}
+			}
+			data, err := os.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+			if err != nil || string(data) != tt.controllers {
+				t.Errorf("cgroup.subtree_control = %q (%v), want %q", data, err, tt.controllers)
+			}
+		})
+	}
+}
+
+func TestNeedsCgroup(t *testing.T) {
+	nice := int32(10)
+	tests := []struct {
+		limits *pb.ResourceLimits
+		want   bool
+	}{
+		{nil, false},
+		{&pb.ResourceLimits{}, false},
+		{&pb.ResourceLimits{Nice: &nice, IoClass: pb.IOClass_IO_CLASS_IDLE}, false},
+		{&pb.ResourceLimits{PidsMax: 1}, true},
+		{&pb.ResourceLimits{IoWeight: 1}, true},
+	}
+	for _, tt := range tests {
+		if got := needsCgroup(tt.limits); got != tt.want {
+			t.Errorf("needsCgroup(%v) = %v, want %v", tt.limits, got, tt.want)
+		}
+	}
+}
+
+func TestLimitsHit(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []pb.Limit
+	}{
+		{
+			name: "nothing hit",
+			files: map[string]string{
+				"cpu.stat":      "usage_usec 1200\nnr_periods 10\nnr_throttled 0\nthrottled_usec 0\n",
+				"memory.events": "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\noom_group_kill 0\n",
+				"pids.events":   "max 0\n",
+			},
+		},
+		{
+			name:  "controllers not enabled",
+			files: map[string]string{},
+		},
+		{
+			name: "throttled and killed",
+			files: map[string]string{
+				"cpu.stat":      "usage_usec 1200\nnr_periods 10\nnr_throttled 4\nthrottled_usec 300\n",
+				"memory.events": "low 0\nhigh 0\nmax 17\noom 1\noom_kill 1\noom_group_kill 0\n",
+			},
+			want: []pb.Limit{pb.Limit_LIMIT_CPU, pb.Limit_LIMIT_MEMORY, pb.Limit_LIMIT_OOM_KILL},
+		},
+		{
+			name: "pids",
+			files: map[string]string{
+				"pids.events": "max 2\n",
+			},
+			want: []pb.Limit{pb.Limit_LIMIT_PIDS},
+		},
+		{
+			name: "keys matched whole",
+			files: map[string]string{
+				"memory.events": "max_something 3\noom_group_kill 1\n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cg := &cgroup{dir: t.TempDir()}
+			for file, data := range tt.files {
+				if err := os.WriteFile(filepath.Join(cg.dir, file), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := cg.limitsHit(); !slices.Equal(got, tt.want) {
+				t.Errorf("limitsHit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
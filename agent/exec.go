@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"golang.org/x/sys/unix"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// chunkSize bounds how much output is read from a pipe before it is handed
+// to the sink, so long-running commands report progress as they go.
+const chunkSize = 32 * 1024
+
+// defaultGracePeriod is used when a request does not set its own grace period.
+// The controller allows for it when it sets the RPC's deadline, so the two must
+// change together.
+const defaultGracePeriod = 10 * time.Second
+
+// readOnlyRoot and readWriteRoot are where the host's filesystem is mounted
+// in the agent's container, read-only and writable. Commands are chrooted
+// into the one their privilege calls for.
+var (
+	readOnlyRoot  = "/host"
+	readWriteRoot = "/host-rw"
+)
+
+// errTimedOut is the cancellation cause recorded when a request's own timeout
+// elapses, as opposed to the caller cancelling or its deadline passing.
+var errTimedOut = errors.New("command timed out")
+
+// chunkSink receives output chunks as they are produced by a running command.
+// Calls are serialized; returning an error stops further chunks from being
+// delivered but the command is still allowed to finish.
+type chunkSink func(*pb.OutputChunk) error
+
+// ExecCommand runs a command to completion and returns its output, both
+// interleaved and split by stream. The output is capped so the result fits in
+// a single message.
+func ExecCommand(ctx context.Context, command *pb.CommandRequest) *pb.CommandResult {
+	var out, stdout, stderr bytes.Buffer
+	limit := outputLimit(command, unaryMaxOutputBytes)
+	result := StreamCommand(ctx, command, limit, func(chunk *pb.OutputChunk) error {
+		out.Write(chunk.GetData())
+		if chunk.GetStream() == pb.Stream_STREAM_STDERR {
+			stderr.Write(chunk.GetData())
+		} else {
+			stdout.Write(chunk.GetData())
+		}
+		return nil
+	})
+	result.Output = out.Bytes()
+	result.Stdout = stdout.Bytes()
+	result.Stderr = stderr.Bytes()
+
+	return result
+}
+
+// StreamCommand runs a command, passing stdout and stderr to sink as they are
+// read. The returned result carries the exit code but no output, since the
+// output has already been delivered through sink.
+//
+// At most limit bytes of output are delivered. The first half is delivered as
+// it is read; once that is used up only the most recent output is kept, and it
+// is delivered after the command exits.
+//
+// The command runs in its own process group, in the sandbox its profile
+// calls for and, if it has resource limits, in a cgroup of its own. If ctx is
+// cancelled or the request's timeout elapses, the whole group is sent SIGTERM
+// and, after the grace period, SIGKILL.
+func StreamCommand(ctx context.Context, command *pb.CommandRequest, limit int64, sink chunkSink) *pb.CommandResult {
+	result := &pb.CommandResult{Id: command.Id, Outcome: pb.Outcome_OUTCOME_COMPLETED}
+
+	if timeout := command.GetTimeout().AsDuration(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, errTimedOut)
+		defer cancel()
+	}
+	gracePeriod := defaultGracePeriod
+	if command.GetGracePeriod() != nil {
+		gracePeriod = command.GetGracePeriod().AsDuration()
+	}
+
+	var mu sync.Mutex
+	limiter := newOutputLimiter(limit, sink)
+	encodings := map[pb.Stream]*utf8Tracker{
+		pb.Stream_STREAM_STDOUT: {},
+		pb.Stream_STREAM_STDERR: {},
+	}
+	emit := func(stream pb.Stream, data []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		encodings[stream].write(data)
+		limiter.write(stream, data)
+	}
+	defer func() {
+		limiter.flush()
+		result.Truncated = limiter.dropped > 0
+		result.DroppedBytes = limiter.dropped
+		result.Encoding = pb.Encoding_ENCODING_UTF8
+		for _, tracker := range encodings {
+			if !tracker.valid() {
+				result.Encoding = pb.Encoding_ENCODING_BINARY
+			}
+		}
+	}()
+
+	result.Privilege = command.GetPrivilege()
+	if result.Privilege == pb.Privilege_PRIVILEGE_UNSPECIFIED {
+		result.Privilege = pb.Privilege_PRIVILEGE_READ_ONLY
+	}
+	result.Profile = command.GetProfile()
+	if result.Profile == pb.Profile_PROFILE_UNSPECIFIED {
+		result.Profile = pb.Profile_PROFILE_FULL
+	}
+	root, err := hostRoot(result.Privilege)
+	if err != nil {
+		return spawnFailed(result, err)
+	}
+	limits := command.GetResources()
+	s := sandbox{root: root, profile: result.Profile, ioPriority: ioPriorityFor(limits)}
+	if limits != nil {
+		s.nice = limits.Nice
+	}
+	if needsCgroup(limits) {
+		cg, err := newCgroup(limits)
+		if err != nil {
+			return spawnFailed(result, err)
+		}
+		defer cg.remove()
+		defer func() { result.LimitsHit = cg.limitsHit() }()
+		s.cgroup = cg.dir
+	}
+	cmd, err := sandboxCommand(s, command.GetCmd())
+	if err != nil {
+		return spawnFailed(result, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return spawnFailed(result, err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return spawnFailed(result, err)
+	}
+	startTime := time.Now()
+	if err := startSandboxed(cmd); err != nil {
+		return spawnFailed(result, err)
+	}
+	result.StartTime = timestamppb.New(startTime)
+
+	exited := make(chan struct{})
+	var killed atomic.Bool
+	go func() {
+		select {
+		case <-ctx.Done():
+			killed.Store(true)
+			killProcessGroup(cmd.Process.Pid, gracePeriod, exited)
+		case <-exited:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for stream, r := range map[pb.Stream]io.Reader{
+		pb.Stream_STREAM_STDOUT: stdout,
+		pb.Stream_STREAM_STDERR: stderr,
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pump(r, func(data []byte) { emit(stream, data) })
+		}()
+	}
+	// All reads must complete before Wait closes the pipes.
+	wg.Wait()
+
+	waitErr := cmd.Wait()
+	close(exited)
+
+	if killed.Load() {
+		result.Outcome = outcomeFor(context.Cause(ctx))
+	}
+
+	endTime := time.Now()
+	result.EndTime = timestamppb.New(endTime)
+	result.Duration = durationpb.New(endTime.Sub(startTime))
+
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) {
+		emit(pb.Stream_STREAM_STDERR, fmt.Appendf(nil, "failed to wait for command: %v", waitErr))
+	}
+	recordExit(result, cmd.ProcessState)
+
+	return result
+}
+
+// hostRoot returns where the host is mounted for commands run with
+// privilege. A read-only command is refused rather than run in a view that
+// turns out to be writable.
+func hostRoot(privilege pb.Privilege) (string, error) {
+	var root string
+	switch privilege {
+	case pb.Privilege_PRIVILEGE_READ_ONLY:
+		root = readOnlyRoot
+	case pb.Privilege_PRIVILEGE_READ_WRITE:
+		root = readWriteRoot
+	}
+	if root == "" {
+		return "", fmt.Errorf("this agent has no host view for %s", privilege)
+	}
+	var fs unix.Statfs_t
+	if err := unix.Statfs(root, &fs); err != nil {
+		return "", fmt.Errorf("host view for %s is not mounted: %w", privilege, err)
+	}
+	if privilege == pb.Privilege_PRIVILEGE_READ_ONLY && fs.Flags&unix.ST_RDONLY == 0 {
+		return "", fmt.Errorf("%s is writable; mount the host there read-only to run %s commands", root, privilege)
+	}
+	return root, nil
+}
+
+// recordExit copies the exit status and resource usage of a finished process
+// into result.
+func recordExit(result *pb.CommandResult, state *os.ProcessState) {
+	if state == nil {
+		result.ExitCode = -1
+		return
+	}
+	result.ExitCode = int32(state.ExitCode())
+	result.UserCpuTime = durationpb.New(state.UserTime())
+	result.SystemCpuTime = durationpb.New(state.SystemTime())
+
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = unix.SignalName(status.Signal())
+	}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// ru_maxrss is reported in kilobytes on Linux.
+		result.MaxRssBytes = rusage.Maxrss * 1024
+	}
+}
+
+// killProcessGroup asks every process in the group led by pgid to stop, then
+// kills whatever is left once gracePeriod has passed or the leader has been
+// reaped, whichever comes first.
+func killProcessGroup(pgid int, gracePeriod time.Duration, exited <-chan struct{}) {
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
+
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-exited:
+	}
+	_ = syscall.Kill(-pgid, syscall.SIGKILL)
+}
+
+func outcomeFor(err error) pb.Outcome {
+	if errors.Is(err, errTimedOut) {
+		return pb.Outcome_OUTCOME_TIMED_OUT
+	}
+	return pb.Outcome_OUTCOME_CANCELLED
+}
+
+// pump reads r until EOF, handing each chunk to emit.
+func pump(r io.Reader, emit func([]byte)) {
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			emit(append([]byte(nil), buf[:n]...))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// spawnFailed marks result as never having run. The error is reported in its
+// own field so it cannot be mistaken for output of a command that exited 1.
+func spawnFailed(result *pb.CommandResult, err error) *pb.CommandResult {
+	result.Outcome = pb.Outcome_OUTCOME_FAILED_TO_START
+	result.ExitCode = -1
+	result.SpawnError = err.Error()
+	return result
+}
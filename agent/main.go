@@ -1,21 +1,47 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"fmt"
+	"flag"
 	"io"
 	"log/slog"
 	"net"
 	"os"
-	"os/exec"
+	"strconv"
+	"time"
 
 	pb "github.com/motilayo/jarvis/agent/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 type server struct {
 	pb.UnimplementedJarvisServer
-	logger *slog.Logger
+	logger  *slog.Logger
+	running running
+	// verifier, if set, checks that requests were signed by the controller.
+	verifier *verifier
+	// policy, if set, is the node's own policy on what may run.
+	policy *policyStore
+}
+
+// verify refuses req unless it carries a valid signature, when signatures
+// are required, and the node's policy allows its command.
+func (s *server) verify(ctx context.Context, req *pb.CommandRequest) error {
+	if s.verifier != nil {
+		if err := s.verifier.verify(ctx, req); err != nil {
+			return err
+		}
+	}
+	if err := s.policy.authorize(req.GetCmd()); err != nil {
+		s.logger.Info("Refused command by node policy", "id", req.GetId(), "cmd", req.GetCmd(), "error", err)
+		return err
+	}
+	return nil
 }
 
 func (s *server) Connect(stream pb.Jarvis_ConnectServer) error {
@@ -32,9 +58,23 @@ func (s *server) Connect(stream pb.Jarvis_ConnectServer) error {
 
 		if command := in.GetCommand(); command != nil {
 			s.logger.Info("Executing command", "cmd", command.GetCmd(), "id", command.GetId())
+			if err := s.verify(stream.Context(), command); err != nil {
+				return err
+			}
 			nodeName := GetNodeName()
-			result := ExecCommand(command)
-			s.logger.Info("Command executed", "cmd", command.GetCmd(), "output", result.Output, "exitCode", result.ExitCode)
+			ctx, finished, replay, err := s.running.start(stream.Context(), command.GetId(), pb.RequestDigest(command), detachable(command))
+			if err != nil {
+				return err
+			}
+			var result *pb.CommandResult
+			if replay != nil {
+				s.logger.Info("Command already ran, returning its result", "id", command.GetId())
+				result = replay.result
+			} else {
+				result = ExecCommand(ctx, command)
+				finished(result, nil)
+			}
+			s.logger.Info("Command executed", "cmd", command.GetCmd(), "output", string(result.Output), "exitCode", result.ExitCode, "outcome", result.Outcome, "signal", result.Signal, "duration", result.Duration.AsDuration(), "spawnError", result.SpawnError, "truncated", result.Truncated)
 			resp := pb.Response{
 				NodeName: nodeName,
 				Result:   result,
@@ -47,33 +87,75 @@ func (s *server) Connect(stream pb.Jarvis_ConnectServer) error {
 	}
 }
 
-func (s *server) RunCommand(_ context.Context, command *pb.CommandRequest) (*pb.CommandResult, error) {
-	s.logger.Info("Executing unary command", "cmd", command.GetCmd(), "id", command.GetId())
-	result := ExecCommand(command)
-	s.logger.Info("Unary command executed", "cmd", command.GetCmd(), "output", result.Output, "exitCode", result.ExitCode)
+func (s *server) RunCommand(ctx context.Context, command *pb.CommandRequest) (*pb.CommandResult, error) {
+	s.logger.Info("Executing unary command", "cmd", command.GetCmd(), "id", command.GetId(), "timeout", command.GetTimeout().AsDuration())
+	if err := s.verify(ctx, command); err != nil {
+		return nil, err
+	}
+	ctx, finished, replay, err := s.running.start(ctx, command.GetId(), pb.RequestDigest(command), detachable(command))
+	if err != nil {
+		return nil, err
+	}
+	if replay != nil {
+		s.logger.Info("Command already ran, returning its result", "id", command.GetId())
+		return replay.result, nil
+	}
+	result := ExecCommand(ctx, command)
+	finished(result, nil)
+	s.logger.Info("Unary command executed", "cmd", command.GetCmd(), "output", string(result.Output), "exitCode", result.ExitCode, "outcome", result.Outcome, "signal", result.Signal, "duration", result.Duration.AsDuration(), "spawnError", result.SpawnError, "truncated", result.Truncated)
 
 	return result, nil
 }
 
-func ExecCommand(command *pb.CommandRequest) *pb.CommandResult {
-	result := &pb.CommandResult{Id: command.Id}
-
-	cmd := command.GetCmd()
-	out, err := exec.Command("chroot", "/host", "sh", "-c", cmd).CombinedOutput()
-	exit := 0
+func (s *server) StreamCommand(command *pb.CommandRequest, stream pb.Jarvis_StreamCommandServer) error {
+	s.logger.Info("Executing streaming command", "cmd", command.GetCmd(), "id", command.GetId(), "timeout", command.GetTimeout().AsDuration())
+	if err := s.verify(stream.Context(), command); err != nil {
+		return err
+	}
+	limit := outputLimit(command, maxOutputBytesLimit)
+	ctx, finished, replay, err := s.running.start(stream.Context(), command.GetId(), pb.RequestDigest(command), detachable(command))
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exit = exitErr.ExitCode()
-		} else {
-			exit = 1
-			out = append(out, []byte(fmt.Sprintf("failed to execute command: %v", err))...)
+		return err
+	}
+	if replay != nil {
+		// The caller lost the stream the first time round; send back what
+		// the command produced, which may still have been running when this
+		// call came in, rather than running it again.
+		s.logger.Info("Command already ran, replaying its output", "id", command.GetId())
+		for _, chunk := range replay.chunks {
+			if err := stream.Send(&pb.CommandOutput{Payload: &pb.CommandOutput_Chunk{Chunk: chunk}}); err != nil {
+				return err
+			}
 		}
+		return stream.Send(&pb.CommandOutput{Payload: &pb.CommandOutput_Result{Result: replay.result}})
 	}
 
-	result.Output = string(out)
-	result.ExitCode = int32(exit)
+	// Every chunk is kept for a retry to replay, including those produced
+	// after the caller has gone.
+	var sent []*pb.OutputChunk
+	var sendErr error
+	result := StreamCommand(ctx, command, limit, func(chunk *pb.OutputChunk) error {
+		sent = append(sent, chunk)
+		if sendErr == nil {
+			sendErr = stream.Send(&pb.CommandOutput{Payload: &pb.CommandOutput_Chunk{Chunk: chunk}})
+		}
+		return nil
+	})
+	finished(result, sent)
+	s.logger.Info("Streaming command executed", "cmd", command.GetCmd(), "exitCode", result.ExitCode, "outcome", result.Outcome, "signal", result.Signal, "duration", result.Duration.AsDuration(), "spawnError", result.SpawnError, "truncated", result.Truncated)
+	if sendErr != nil {
+		// The caller is gone; there is nobody left to send the result to.
+		return sendErr
+	}
 
-	return result
+	return stream.Send(&pb.CommandOutput{Payload: &pb.CommandOutput_Result{Result: result}})
+}
+
+func (s *server) Cancel(ctx context.Context, req *pb.CancelRequest) (*pb.CancelResponse, error) {
+	s.logger.Info("Cancelling command", "id", req.GetId())
+	found, stopped := s.running.cancel(ctx, req.GetId())
+	s.logger.Info("Cancel finished", "id", req.GetId(), "found", found, "stopped", stopped)
+	return &pb.CancelResponse{Found: found, Stopped: stopped}, nil
 }
 
 func GetNodeName() string {
@@ -85,15 +167,99 @@ func GetNodeName() string {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == sandboxArg {
+		sandboxMain(os.Args[2:])
+	}
+	port := flag.Int("port", 50051, "Port to listen on; must match the JarvisConfig's agent.port.")
+	certFile := flag.String("tls-cert-file", "", "Certificate to serve TLS with, reloaded when it changes. If unset, the agent asks the controller's CA for one with a CertificateSigningRequest.")
+	keyFile := flag.String("tls-key-file", "", "Private key for --tls-cert-file.")
+	clientCAFile := flag.String("tls-client-ca-file", "", "If set, callers must present a certificate signed by this CA.")
+	plaintext := flag.Bool("plaintext", false, "Serve without TLS; for a JarvisConfig with agent.tls.mode Disabled.")
+	authorize := flag.Bool("authorize", true, "Only accept calls with a token for the jarvis-agent audience whose user may create nodes/jarvis-exec on this node. Ignored with --plaintext, as no token is sent without TLS.")
+	policyFile := flag.String("policy-file", "", "A YAML file listing the binaries commands may run, patterns they must not match, and whether shell metacharacters are allowed. Reloaded when it changes. If unset, any command is allowed.")
+	requireSignatures := flag.Bool("require-signatures", true, "Only run requests the controller signed for this node, with a key it publishes in the jarvis-signing-keys ConfigMap.")
+	flag.StringVar(&readOnlyRoot, "host-root", readOnlyRoot, "Where the host's filesystem is mounted read-only; ReadOnly commands are chrooted into it.")
+	flag.StringVar(&readWriteRoot, "host-root-rw", readWriteRoot, "Where the host's filesystem is mounted writable; ReadWrite commands are chrooted into it. Empty refuses ReadWrite commands.")
+	flag.StringVar(&cgroupRoot, "cgroup-root", cgroupRoot, "The cgroup v2 directory, on the host's hierarchy, that commands with resource limits get a cgroup of their own under. Empty refuses commands with limits that need one.")
+	flag.Parse()
+
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
-	lis, err := net.Listen("tcp", ":50051")
+	addr := net.JoinHostPort("", strconv.Itoa(*port))
+	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		logger.Error("failed to listen", "error", err)
 		os.Exit(1)
 	}
-	s := grpc.NewServer()
-	pb.RegisterJarvisServer(s, &server{logger: logger})
-	logger.Info("Server listening on :50051")
+	opts := []grpc.ServerOption{
+		// The controller keeps its connection open between commands and
+		// pings it every 30s to notice when either side has gone away.
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             15 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	// The API server is needed to check callers, to have a certificate
+	// signed, and to fetch the CAs and signing keys the controller publishes.
+	var clientset kubernetes.Interface
+	if (!*plaintext && (*authorize || *certFile == "")) || *requireSignatures {
+		config, err := rest.InClusterConfig()
+		if err == nil {
+			clientset, err = kubernetes.NewForConfig(config)
+		}
+		if err != nil {
+			logger.Error("failed to create Kubernetes client; outside a cluster run with --require-signatures=false and either --plaintext, or --tls-cert-file and --authorize=false", "error", err)
+			os.Exit(1)
+		}
+	}
+	if *plaintext {
+		logger.Warn("Serving without TLS; callers are not authenticated")
+	} else if *authorize {
+		auth := &authorizer{client: clientset, node: GetNodeName(), logger: logger}
+		opts = append(opts, grpc.ChainUnaryInterceptor(auth.unary), grpc.ChainStreamInterceptor(auth.stream))
+	}
+
+	tlsMode := "managed"
+	switch {
+	case *plaintext:
+		tlsMode = "disabled"
+	case *certFile != "":
+		tlsMode = "provided"
+		certs := &certStore{}
+		if err := certs.watchFiles(context.Background(), logger, *certFile, *keyFile, *clientCAFile); err != nil {
+			logger.Error("failed to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(certs.serverConfig())))
+	default:
+		certs := &certStore{clientName: controllerName}
+		namespace := cmp.Or(os.Getenv("POD_NAMESPACE"), "jarvis")
+		if err := certs.watchManaged(context.Background(), logger, clientset, namespace, GetNodeName()); err != nil {
+			logger.Error("failed to set up the agent certificate", "error", err)
+			os.Exit(1)
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(certs.serverConfig())))
+	}
+	srv := &server{logger: logger}
+	if *requireSignatures {
+		srv.verifier = &verifier{node: GetNodeName(), logger: logger, started: time.Now()}
+		namespace := cmp.Or(os.Getenv("POD_NAMESPACE"), "jarvis")
+		if err := srv.verifier.watchKeys(context.Background(), clientset, namespace); err != nil {
+			logger.Error("failed to watch for signing keys", "error", err)
+			os.Exit(1)
+		}
+	} else {
+		logger.Warn("Running requests without checking who signed them")
+	}
+	if *policyFile != "" {
+		srv.policy = &policyStore{}
+		if err := srv.policy.watchFile(context.Background(), logger, *policyFile); err != nil {
+			logger.Error("failed to load node policy", "error", err)
+			os.Exit(1)
+		}
+	}
+	s := grpc.NewServer(opts...)
+	pb.RegisterJarvisServer(s, srv)
+	logger.Info("Server listening", "addr", addr, "tls", tlsMode, "authorize", *authorize && !*plaintext, "requireSignatures", *requireSignatures, "policyFile", *policyFile, "hostRoot", readOnlyRoot, "hostRootRW", readWriteRoot, "cgroupRoot", cgroupRoot)
 	if err := s.Serve(lis); err != nil {
 		logger.Error("s.Serve()", "error", err)
 		os.Exit(1)
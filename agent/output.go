@@ -0,0 +1,157 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+)
+
+const (
+	// defaultMaxOutputBytes is used when a request does not set its own cap.
+	defaultMaxOutputBytes = 1 << 20
+	// maxOutputBytesLimit bounds what a streaming request may ask for. It
+	// stays below completedMaxBytes, so a retry can always get the output of
+	// a command that already ran.
+	maxOutputBytesLimit = 16 << 20
+	// unaryMaxOutputBytes bounds requests whose output is returned in a single
+	// message. The result carries the output twice (interleaved and split by
+	// stream), which must stay under gRPC's 4 MiB default message limit.
+	unaryMaxOutputBytes = 1 << 20
+)
+
+// outputLimit returns the output cap for a request, clamped to ceiling.
+func outputLimit(command *pb.CommandRequest, ceiling int64) int64 {
+	limit := command.GetMaxOutputBytes()
+	if limit <= 0 {
+		limit = defaultMaxOutputBytes
+	}
+	return min(limit, ceiling)
+}
+
+// outputLimiter passes output straight through to its sink until half of the
+// cap has been written. After that it keeps only the most recent output, up to
+// the other half of the cap, and hands it over on flush. Cuts are moved to
+// UTF-8 rune boundaries where possible so text output stays readable.
+type outputLimiter struct {
+	sink     chunkSink
+	sinkErr  error
+	headLeft int64
+
+	tail     []*pb.OutputChunk
+	tailSize int64
+	tailCap  int64
+	dropped  int64
+}
+
+func newOutputLimiter(limit int64, sink chunkSink) *outputLimiter {
+	head := limit / 2
+	return &outputLimiter{sink: sink, headLeft: head, tailCap: limit - head}
+}
+
+func (l *outputLimiter) write(stream pb.Stream, data []byte) {
+	if l.headLeft > 0 {
+		n := int64(len(data))
+		if n > l.headLeft {
+			n = runeStartBefore(data, l.headLeft)
+			l.headLeft = 0
+		} else {
+			l.headLeft -= n
+		}
+		l.send(&pb.OutputChunk{Stream: stream, Data: data[:n]})
+		data = data[n:]
+	}
+	if len(data) == 0 {
+		return
+	}
+
+	l.tail = append(l.tail, &pb.OutputChunk{Stream: stream, Data: data})
+	l.tailSize += int64(len(data))
+	for l.tailSize > l.tailCap {
+		first := l.tail[0]
+		excess := l.tailSize - l.tailCap
+		cut := int64(len(first.Data))
+		if excess < cut {
+			cut = runeStartAfter(first.Data, excess)
+		}
+		if cut == int64(len(first.Data)) {
+			l.tail = l.tail[1:]
+		} else {
+			first.Data = first.Data[cut:]
+		}
+		l.tailSize -= cut
+		l.dropped += cut
+	}
+}
+
+// flush hands over the retained tail. It must be called once all output has
+// been written.
+func (l *outputLimiter) flush() {
+	for _, chunk := range l.tail {
+		l.send(chunk)
+	}
+	l.tail = nil
+	l.tailSize = 0
+}
+
+func (l *outputLimiter) send(chunk *pb.OutputChunk) {
+	if l.sinkErr != nil || len(chunk.Data) == 0 {
+		return
+	}
+	l.sinkErr = l.sink(chunk)
+}
+
+// runeStartBefore returns the largest offset no greater than n that starts a
+// rune, looking back no further than one rune's width.
+func runeStartBefore(b []byte, n int64) int64 {
+	for i := n; i > 0 && i > n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			return i
+		}
+	}
+	return n
+}
+
+// runeStartAfter returns the smallest offset no less than n that starts a
+// rune, looking ahead no further than one rune's width.
+func runeStartAfter(b []byte, n int64) int64 {
+	for i := n; i < int64(len(b)) && i < n+utf8.UTFMax; i++ {
+		if utf8.RuneStart(b[i]) {
+			return i
+		}
+	}
+	return n
+}
+
+// utf8Tracker records whether a stream written in arbitrary pieces is valid
+// UTF-8 as a whole.
+type utf8Tracker struct {
+	pending []byte
+	invalid bool
+}
+
+func (t *utf8Tracker) write(p []byte) {
+	if t.invalid {
+		return
+	}
+	b := append(t.pending, p...)
+
+	// Hold back a trailing rune that may be completed by the next write.
+	cut := len(b)
+	for i := len(b) - 1; i >= 0 && i > len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	if !utf8.Valid(b[:cut]) {
+		t.invalid = true
+		return
+	}
+	t.pending = append(t.pending[:0], b[cut:]...)
+}
+
+func (t *utf8Tracker) valid() bool {
+	return !t.invalid && len(t.pending) == 0
+}
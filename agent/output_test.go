@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+)
+
+// write is one piece of output written to a limiter.
+type write struct {
+	stream pb.Stream
+	data   string
+}
+
+const (
+	stdout = pb.Stream_STREAM_STDOUT
+	stderr = pb.Stream_STREAM_STDERR
+)
+
+func TestOutputLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int64
+		writes []write
+		// want is the output handed to the sink, one string per chunk,
+		// prefixed with o: for stdout or e: for stderr.
+		want    []string
+		dropped int64
+	}{
+		{
+			name:   "under the limit",
+			limit:  100,
+			writes: []write{{stdout, "hello "}, {stderr, "oops "}, {stdout, "world"}},
+			want:   []string{"o:hello ", "e:oops ", "o:world"},
+		},
+		{
+			name:   "head then tail",
+			limit:  10,
+			writes: []write{{stdout, "0123456789abcdefghij"}},
+			want:   []string{"o:01234", "o:fghij"},
+			// The head keeps 5 bytes and the tail the last 5.
+			dropped: 10,
+		},
+		{
+			name:    "tail drops whole chunks",
+			limit:   4,
+			writes:  []write{{stdout, "ab"}, {stdout, "cd"}, {stdout, "ef"}, {stderr, "gh"}},
+			want:    []string{"o:ab", "e:gh"},
+			dropped: 4,
+		},
+		{
+			name:    "tail cuts inside a chunk",
+			limit:   6,
+			writes:  []write{{stdout, "abc"}, {stdout, "defgh"}, {stderr, "i"}},
+			want:    []string{"o:abc", "o:gh", "e:i"},
+			dropped: 3,
+		},
+		{
+			name:  "head cut moves back to a rune start",
+			limit: 8,
+			// é is two bytes; the head's fourth byte falls inside it.
+			writes:  []write{{stdout, "abcé"}},
+			want:    []string{"o:abc", "o:é"},
+			dropped: 0,
+		},
+		{
+			name:  "tail cut moves forward to a rune start",
+			limit: 4,
+			// The head keeps "ab"; the tail must drop 1 byte of "€x",
+			// which would split €, so it drops the whole rune.
+			writes:  []write{{stdout, "ab"}, {stdout, "€x"}},
+			want:    []string{"o:ab", "o:x"},
+			dropped: 3,
+		},
+		{
+			name:    "zero limit",
+			limit:   0,
+			writes:  []write{{stdout, "abc"}},
+			want:    nil,
+			dropped: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			l := newOutputLimiter(tt.limit, func(chunk *pb.OutputChunk) error {
+				got = append(got, map[pb.Stream]string{stdout: "o:", stderr: "e:"}[chunk.GetStream()]+string(chunk.GetData()))
+				return nil
+			})
+			for _, w := range tt.writes {
+				l.write(w.stream, []byte(w.data))
+			}
+			l.flush()
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("sink got %q, want %q", got, tt.want)
+			}
+			if l.dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", l.dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestOutputLimiterSinkError(t *testing.T) {
+	calls := 0
+	l := newOutputLimiter(100, func(*pb.OutputChunk) error {
+		calls++
+		return errors.New("stream closed")
+	})
+	l.write(stdout, []byte("a"))
+	l.write(stdout, []byte("b"))
+	l.flush()
+	if calls != 1 {
+		t.Errorf("sink called %d times after failing, want 1", calls)
+	}
+	if l.sinkErr == nil {
+		t.Error("sinkErr not kept")
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	tests := []struct {
+		requested, ceiling, want int64
+	}{
+		{0, maxOutputBytesLimit, defaultMaxOutputBytes},
+		{-1, maxOutputBytesLimit, defaultMaxOutputBytes},
+		{4096, maxOutputBytesLimit, 4096},
+		{maxOutputBytesLimit * 2, maxOutputBytesLimit, maxOutputBytesLimit},
+		{0, 1024, 1024},
+	}
+	for _, tt := range tests {
+		if got := outputLimit(&pb.CommandRequest{MaxOutputBytes: tt.requested}, tt.ceiling); got != tt.want {
+			t.Errorf("outputLimit(%d, %d) = %d, want %d", tt.requested, tt.ceiling, got, tt.want)
+		}
+	}
+}
+
+func TestUTF8Tracker(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   bool
+	}{
+		{"empty", nil, true},
+		{"ascii", []string{"hello", " world"}, true},
+		{"rune split across writes", []string{"caf\xc3", "\xa9"}, true},
+		{"rune split three ways", []string{"\xe2", "\x82", "\xac"}, true},
+		{"unfinished rune at the end", []string{"caf\xc3"}, false},
+		{"invalid byte", []string{"ab\xffcd"}, false},
+		{"invalid then valid", []string{"\xff", "ok"}, false},
+		{"continuation without a start", []string{"a", "\xa9b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tr utf8Tracker
+			for _, w := range tt.writes {
+				tr.write([]byte(w))
+			}
+			if got := tr.valid(); got != tt.want {
+				t.Errorf("valid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
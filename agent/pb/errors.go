@@ -0,0 +1,10 @@
+package agent
+
+// ErrorDomain is the domain of the errdetails.ErrorInfo agents attach to the
+// errors they return.
+const ErrorDomain = "jarvis.io"
+
+// ReasonNodePolicyDenied is the ErrorInfo reason of a PermissionDenied error
+// for a command the node's local policy refuses. Its metadata names the rule
+// under "rule" and the policy file under "policy".
+const ReasonNodePolicyDenied = "NODE_POLICY_DENIED"
@@ -9,6 +9,8 @@ package agent
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -21,6 +23,388 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// IOClass is an IO scheduling class, numbered as the kernel numbers them.
+type IOClass int32
+
+const (
+	IOClass_IO_CLASS_UNSPECIFIED IOClass = 0
+	IOClass_IO_CLASS_BEST_EFFORT IOClass = 2
+	IOClass_IO_CLASS_IDLE        IOClass = 3
+)
+
+// Enum value maps for IOClass.
+var (
+	IOClass_name = map[int32]string{
+		0: "IO_CLASS_UNSPECIFIED",
+		2: "IO_CLASS_BEST_EFFORT",
+		3: "IO_CLASS_IDLE",
+	}
+	IOClass_value = map[string]int32{
+		"IO_CLASS_UNSPECIFIED": 0,
+		"IO_CLASS_BEST_EFFORT": 2,
+		"IO_CLASS_IDLE":        3,
+	}
+)
+
+func (x IOClass) Enum() *IOClass {
+	p := new(IOClass)
+	*p = x
+	return p
+}
+
+func (x IOClass) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (IOClass) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[0].Descriptor()
+}
+
+func (IOClass) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[0]
+}
+
+func (x IOClass) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use IOClass.Descriptor instead.
+func (IOClass) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{0}
+}
+
+// Limit is a limit from ResourceLimits that a command ran into.
+type Limit int32
+
+const (
+	Limit_LIMIT_UNSPECIFIED Limit = 0
+	// The command was throttled to stay under cpuMillis.
+	Limit_LIMIT_CPU Limit = 1
+	// The command reached memoryBytes.
+	Limit_LIMIT_MEMORY Limit = 2
+	// A process of the command was OOM-killed for going over memoryBytes.
+	Limit_LIMIT_OOM_KILL Limit = 3
+	// The command was refused a process or thread by pidsMax.
+	Limit_LIMIT_PIDS Limit = 4
+)
+
+// Enum value maps for Limit.
+var (
+	Limit_name = map[int32]string{
+		0: "LIMIT_UNSPECIFIED",
+		1: "LIMIT_CPU",
+		2: "LIMIT_MEMORY",
+		3: "LIMIT_OOM_KILL",
+		4: "LIMIT_PIDS",
+	}
+	Limit_value = map[string]int32{
+		"LIMIT_UNSPECIFIED": 0,
+		"LIMIT_CPU":         1,
+		"LIMIT_MEMORY":      2,
+		"LIMIT_OOM_KILL":    3,
+		"LIMIT_PIDS":        4,
+	}
+)
+
+func (x Limit) Enum() *Limit {
+	p := new(Limit)
+	*p = x
+	return p
+}
+
+func (x Limit) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Limit) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[1].Descriptor()
+}
+
+func (Limit) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[1]
+}
+
+func (x Limit) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Limit.Descriptor instead.
+func (Limit) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{1}
+}
+
+// Privilege is how much of the host a command may change.
+type Privilege int32
+
+const (
+	Privilege_PRIVILEGE_UNSPECIFIED Privilege = 0
+	// The command sees the host's filesystem read-only.
+	Privilege_PRIVILEGE_READ_ONLY Privilege = 1
+	// The command sees the host's filesystem writable.
+	Privilege_PRIVILEGE_READ_WRITE Privilege = 2
+)
+
+// Enum value maps for Privilege.
+var (
+	Privilege_name = map[int32]string{
+		0: "PRIVILEGE_UNSPECIFIED",
+		1: "PRIVILEGE_READ_ONLY",
+		2: "PRIVILEGE_READ_WRITE",
+	}
+	Privilege_value = map[string]int32{
+		"PRIVILEGE_UNSPECIFIED": 0,
+		"PRIVILEGE_READ_ONLY":   1,
+		"PRIVILEGE_READ_WRITE":  2,
+	}
+)
+
+func (x Privilege) Enum() *Privilege {
+	p := new(Privilege)
+	*p = x
+	return p
+}
+
+func (x Privilege) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Privilege) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[2].Descriptor()
+}
+
+func (Privilege) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[2]
+}
+
+func (x Privilege) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Privilege.Descriptor instead.
+func (Privilege) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{2}
+}
+
+// Profile is the sandbox a command runs in.
+type Profile int32
+
+const (
+	Profile_PROFILE_UNSPECIFIED Profile = 0
+	// No sandbox: the command runs as root with every capability.
+	Profile_PROFILE_FULL Profile = 1
+	// A capability bounding set for looking around, no_new_privs, a seccomp
+	// filter and a mount namespace of its own.
+	Profile_PROFILE_DIAGNOSTIC Profile = 2
+	// PROFILE_DIAGNOSTIC in a network namespace of its own, with only a
+	// loopback interface.
+	Profile_PROFILE_NETWORK_ISOLATED Profile = 3
+)
+
+// Enum value maps for Profile.
+var (
+	Profile_name = map[int32]string{
+		0: "PROFILE_UNSPECIFIED",
+		1: "PROFILE_FULL",
+		2: "PROFILE_DIAGNOSTIC",
+		3: "PROFILE_NETWORK_ISOLATED",
+	}
+	Profile_value = map[string]int32{
+		"PROFILE_UNSPECIFIED":      0,
+		"PROFILE_FULL":             1,
+		"PROFILE_DIAGNOSTIC":       2,
+		"PROFILE_NETWORK_ISOLATED": 3,
+	}
+)
+
+func (x Profile) Enum() *Profile {
+	p := new(Profile)
+	*p = x
+	return p
+}
+
+func (x Profile) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Profile) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[3].Descriptor()
+}
+
+func (Profile) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[3]
+}
+
+func (x Profile) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Profile.Descriptor instead.
+func (Profile) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{3}
+}
+
+// Outcome describes how a command stopped running.
+type Outcome int32
+
+const (
+	Outcome_OUTCOME_UNSPECIFIED Outcome = 0
+	// The command exited on its own; exitCode is meaningful.
+	Outcome_OUTCOME_COMPLETED Outcome = 1
+	// The command was killed because its timeout elapsed.
+	Outcome_OUTCOME_TIMED_OUT Outcome = 2
+	// The command was killed because it was cancelled, or because every call
+	// waiting for it went away and none came back for it in time.
+	Outcome_OUTCOME_CANCELLED Outcome = 3
+	// The command could not be started; see spawnError.
+	Outcome_OUTCOME_FAILED_TO_START Outcome = 4
+)
+
+// Enum value maps for Outcome.
+var (
+	Outcome_name = map[int32]string{
+		0: "OUTCOME_UNSPECIFIED",
+		1: "OUTCOME_COMPLETED",
+		2: "OUTCOME_TIMED_OUT",
+		3: "OUTCOME_CANCELLED",
+		4: "OUTCOME_FAILED_TO_START",
+	}
+	Outcome_value = map[string]int32{
+		"OUTCOME_UNSPECIFIED":     0,
+		"OUTCOME_COMPLETED":       1,
+		"OUTCOME_TIMED_OUT":       2,
+		"OUTCOME_CANCELLED":       3,
+		"OUTCOME_FAILED_TO_START": 4,
+	}
+)
+
+func (x Outcome) Enum() *Outcome {
+	p := new(Outcome)
+	*p = x
+	return p
+}
+
+func (x Outcome) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Outcome) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[4].Descriptor()
+}
+
+func (Outcome) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[4]
+}
+
+func (x Outcome) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Outcome.Descriptor instead.
+func (Outcome) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{4}
+}
+
+// Encoding declares how the bytes in a result's output fields should be read.
+type Encoding int32
+
+const (
+	Encoding_ENCODING_UNSPECIFIED Encoding = 0
+	// All output is valid UTF-8 text.
+	Encoding_ENCODING_UTF8 Encoding = 1
+	// Some output is not valid UTF-8 and should be treated as opaque bytes.
+	Encoding_ENCODING_BINARY Encoding = 2
+)
+
+// Enum value maps for Encoding.
+var (
+	Encoding_name = map[int32]string{
+		0: "ENCODING_UNSPECIFIED",
+		1: "ENCODING_UTF8",
+		2: "ENCODING_BINARY",
+	}
+	Encoding_value = map[string]int32{
+		"ENCODING_UNSPECIFIED": 0,
+		"ENCODING_UTF8":        1,
+		"ENCODING_BINARY":      2,
+	}
+)
+
+func (x Encoding) Enum() *Encoding {
+	p := new(Encoding)
+	*p = x
+	return p
+}
+
+func (x Encoding) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Encoding) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[5].Descriptor()
+}
+
+func (Encoding) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[5]
+}
+
+func (x Encoding) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Encoding.Descriptor instead.
+func (Encoding) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{5}
+}
+
+type Stream int32
+
+const (
+	Stream_STREAM_UNSPECIFIED Stream = 0
+	Stream_STREAM_STDOUT      Stream = 1
+	Stream_STREAM_STDERR      Stream = 2
+)
+
+// Enum value maps for Stream.
+var (
+	Stream_name = map[int32]string{
+		0: "STREAM_UNSPECIFIED",
+		1: "STREAM_STDOUT",
+		2: "STREAM_STDERR",
+	}
+	Stream_value = map[string]int32{
+		"STREAM_UNSPECIFIED": 0,
+		"STREAM_STDOUT":      1,
+		"STREAM_STDERR":      2,
+	}
+)
+
+func (x Stream) Enum() *Stream {
+	p := new(Stream)
+	*p = x
+	return p
+}
+
+func (x Stream) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Stream) Descriptor() protoreflect.EnumDescriptor {
+	return file_jarvis_proto_enumTypes[6].Descriptor()
+}
+
+func (Stream) Type() protoreflect.EnumType {
+	return &file_jarvis_proto_enumTypes[6]
+}
+
+func (x Stream) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Stream.Descriptor instead.
+func (Stream) EnumDescriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{6}
+}
+
 type Response struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	NodeName      string                 `protobuf:"bytes,1,opt,name=nodeName,proto3" json:"nodeName,omitempty"`
@@ -118,9 +502,39 @@ func (x *Request) GetCommand() *CommandRequest {
 }
 
 type CommandRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Cmd           string                 `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id identifies the execution. At most one command with a given id runs at
+	// a time. A request repeating the id of a running or recently finished
+	// command waits for it and gets its output and result back instead of
+	// running it again, provided it asks for the same thing; one asking for
+	// something else is refused with FAILED_PRECONDITION. Finished commands
+	// are kept for ten minutes, in memory only, so a retry after that or after
+	// the agent restarts runs the command again. Once every call waiting for a
+	// command has gone, it is killed: after a minute if it has a timeout, to
+	// give a retry time to come back for it, and straight away otherwise.
+	// Leaving the id empty opts out of all this and of cancellation by id, and
+	// the command stops with its call.
+	Id  string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Cmd string `protobuf:"bytes,2,opt,name=cmd,proto3" json:"cmd,omitempty"`
+	// timeout bounds how long the command may run. Unset or zero means no limit.
+	Timeout *durationpb.Duration `protobuf:"bytes,3,opt,name=timeout,proto3" json:"timeout,omitempty"`
+	// gracePeriod is how long the agent waits after SIGTERM before sending
+	// SIGKILL to the command's process group.
+	GracePeriod *durationpb.Duration `protobuf:"bytes,4,opt,name=gracePeriod,proto3" json:"gracePeriod,omitempty"`
+	// maxOutputBytes caps how much output is kept: the first half and the last
+	// half of the cap are returned and everything in between is dropped. Zero
+	// uses the agent's default.
+	MaxOutputBytes int64 `protobuf:"varint,5,opt,name=maxOutputBytes,proto3" json:"maxOutputBytes,omitempty"`
+	// signature shows that the controller issued the request, for this node,
+	// and that nothing in it was changed on the way. Agents that require
+	// signatures refuse requests without a valid one.
+	Signature *RequestSignature `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+	// privilege is the view of the host the command runs in. Unset is read-only.
+	Privilege Privilege `protobuf:"varint,7,opt,name=privilege,proto3,enum=jarvis.v1.Privilege" json:"privilege,omitempty"`
+	// profile is the sandbox the command runs in. Unset is PROFILE_FULL.
+	Profile Profile `protobuf:"varint,8,opt,name=profile,proto3,enum=jarvis.v1.Profile" json:"profile,omitempty"`
+	// resources bounds what the command may use. Unset is no limits.
+	Resources     *ResourceLimits `protobuf:"bytes,9,opt,name=resources,proto3" json:"resources,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -169,29 +583,91 @@ func (x *CommandRequest) GetCmd() string {
 	return ""
 }
 
-type CommandResult struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Output        string                 `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
-	ExitCode      int32                  `protobuf:"varint,3,opt,name=exitCode,proto3" json:"exitCode,omitempty"`
+func (x *CommandRequest) GetTimeout() *durationpb.Duration {
+	if x != nil {
+		return x.Timeout
+	}
+	return nil
+}
+
+func (x *CommandRequest) GetGracePeriod() *durationpb.Duration {
+	if x != nil {
+		return x.GracePeriod
+	}
+	return nil
+}
+
+func (x *CommandRequest) GetMaxOutputBytes() int64 {
+	if x != nil {
+		return x.MaxOutputBytes
+	}
+	return 0
+}
+
+func (x *CommandRequest) GetSignature() *RequestSignature {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *CommandRequest) GetPrivilege() Privilege {
+	if x != nil {
+		return x.Privilege
+	}
+	return Privilege_PRIVILEGE_UNSPECIFIED
+}
+
+func (x *CommandRequest) GetProfile() Profile {
+	if x != nil {
+		return x.Profile
+	}
+	return Profile_PROFILE_UNSPECIFIED
+}
+
+func (x *CommandRequest) GetResources() *ResourceLimits {
+	if x != nil {
+		return x.Resources
+	}
+	return nil
+}
+
+// ResourceLimits bound what a command may use. A command with cpuMillis,
+// memoryBytes, ioWeight or pidsMax set runs in a cgroup of its own.
+type ResourceLimits struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// cpuMillis caps CPU time, in thousandths of a CPU. Zero is no cap.
+	CpuMillis int64 `protobuf:"varint,1,opt,name=cpuMillis,proto3" json:"cpuMillis,omitempty"`
+	// memoryBytes caps memory. Zero is no cap.
+	MemoryBytes int64 `protobuf:"varint,2,opt,name=memoryBytes,proto3" json:"memoryBytes,omitempty"`
+	// ioWeight is the share of disk bandwidth, from 1 to 10000. Zero leaves
+	// the default of 100.
+	IoWeight uint32 `protobuf:"varint,3,opt,name=ioWeight,proto3" json:"ioWeight,omitempty"`
+	// pidsMax caps processes and threads. Zero is no cap.
+	PidsMax int64 `protobuf:"varint,4,opt,name=pidsMax,proto3" json:"pidsMax,omitempty"`
+	// nice is the scheduling priority, from -20 to 19.
+	Nice    *int32  `protobuf:"varint,5,opt,name=nice,proto3,oneof" json:"nice,omitempty"`
+	IoClass IOClass `protobuf:"varint,6,opt,name=ioClass,proto3,enum=jarvis.v1.IOClass" json:"ioClass,omitempty"`
+	// ioPriority is the priority within IO_CLASS_BEST_EFFORT, from 0 to 7.
+	IoPriority    *int32 `protobuf:"varint,7,opt,name=ioPriority,proto3,oneof" json:"ioPriority,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *CommandResult) Reset() {
-	*x = CommandResult{}
+func (x *ResourceLimits) Reset() {
+	*x = ResourceLimits{}
 	mi := &file_jarvis_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *CommandResult) String() string {
+func (x *ResourceLimits) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CommandResult) ProtoMessage() {}
+func (*ResourceLimits) ProtoMessage() {}
 
-func (x *CommandResult) ProtoReflect() protoreflect.Message {
+func (x *ResourceLimits) ProtoReflect() protoreflect.Message {
 	mi := &file_jarvis_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -203,104 +679,820 @@ func (x *CommandResult) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CommandResult.ProtoReflect.Descriptor instead.
-func (*CommandResult) Descriptor() ([]byte, []int) {
+// Deprecated: Use ResourceLimits.ProtoReflect.Descriptor instead.
+func (*ResourceLimits) Descriptor() ([]byte, []int) {
 	return file_jarvis_proto_rawDescGZIP(), []int{3}
 }
 
-func (x *CommandResult) GetId() string {
+func (x *ResourceLimits) GetCpuMillis() int64 {
 	if x != nil {
-		return x.Id
+		return x.CpuMillis
 	}
-	return ""
+	return 0
 }
 
-func (x *CommandResult) GetOutput() string {
+func (x *ResourceLimits) GetMemoryBytes() int64 {
 	if x != nil {
-		return x.Output
+		return x.MemoryBytes
 	}
-	return ""
+	return 0
 }
 
-func (x *CommandResult) GetExitCode() int32 {
+func (x *ResourceLimits) GetIoWeight() uint32 {
 	if x != nil {
-		return x.ExitCode
+		return x.IoWeight
 	}
 	return 0
 }
 
-var File_jarvis_proto protoreflect.FileDescriptor
+func (x *ResourceLimits) GetPidsMax() int64 {
+	if x != nil {
+		return x.PidsMax
+	}
+	return 0
+}
 
-const file_jarvis_proto_rawDesc = "" +
-	"\n" +
-	"\fjarvis.proto\x12\tjarvis.v1\"X\n" +
-	"\bResponse\x12\x1a\n" +
-	"\bnodeName\x18\x01 \x01(\tR\bnodeName\x120\n" +
-	"\x06result\x18\x02 \x01(\v2\x18.jarvis.v1.CommandResultR\x06result\">\n" +
-	"\aRequest\x123\n" +
-	"\acommand\x18\x01 \x01(\v2\x19.jarvis.v1.CommandRequestR\acommand\"2\n" +
-	"\x0eCommandRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
-	"\x03cmd\x18\x02 \x01(\tR\x03cmd\"S\n" +
-	"\rCommandResult\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
-	"\x06output\x18\x02 \x01(\tR\x06output\x12\x1a\n" +
-	"\bexitCode\x18\x03 \x01(\x05R\bexitCode2\x83\x01\n" +
-	"\x06Jarvis\x126\n" +
-	"\aConnect\x12\x12.jarvis.v1.Request\x1a\x13.jarvis.v1.Response(\x010\x01\x12A\n" +
-	"\n" +
-	"RunCommand\x12\x19.jarvis.v1.CommandRequest\x1a\x18.jarvis.v1.CommandResultB\"Z github.com/motilayo/jarvis/agentb\x06proto3"
+func (x *ResourceLimits) GetNice() int32 {
+	if x != nil && x.Nice != nil {
+		return *x.Nice
+	}
+	return 0
+}
 
-var (
-	file_jarvis_proto_rawDescOnce sync.Once
-	file_jarvis_proto_rawDescData []byte
-)
+func (x *ResourceLimits) GetIoClass() IOClass {
+	if x != nil {
+		return x.IoClass
+	}
+	return IOClass_IO_CLASS_UNSPECIFIED
+}
 
-func file_jarvis_proto_rawDescGZIP() []byte {
-	file_jarvis_proto_rawDescOnce.Do(func() {
-		file_jarvis_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_jarvis_proto_rawDesc), len(file_jarvis_proto_rawDesc)))
-	})
-	return file_jarvis_proto_rawDescData
+func (x *ResourceLimits) GetIoPriority() int32 {
+	if x != nil && x.IoPriority != nil {
+		return *x.IoPriority
+	}
+	return 0
 }
 
-var file_jarvis_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
-var file_jarvis_proto_goTypes = []any{
-	(*Response)(nil),       // 0: jarvis.v1.Response
-	(*Request)(nil),        // 1: jarvis.v1.Request
-	(*CommandRequest)(nil), // 2: jarvis.v1.CommandRequest
-	(*CommandResult)(nil),  // 3: jarvis.v1.CommandResult
+// RequestSignature is an Ed25519 signature over a CommandRequest: its id,
+// cmd, timeout, gracePeriod, maxOutputBytes, privilege, profile and
+// resources, and every field here but signature itself. SigningPayload lays
+// those out.
+type RequestSignature struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// keyID names the key among those published to the agents.
+	KeyID string `protobuf:"bytes,1,opt,name=keyID,proto3" json:"keyID,omitempty"`
+	// node is the node the request is meant for.
+	Node string `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+	// nonce is random and used only once, so the request cannot be replayed.
+	Nonce []byte `protobuf:"bytes,3,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	// expiresAt is when the request stops being accepted.
+	ExpiresAt *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=expiresAt,proto3" json:"expiresAt,omitempty"`
+	// commandUID is the UID of the Command the request runs.
+	CommandUID string `protobuf:"bytes,5,opt,name=commandUID,proto3" json:"commandUID,omitempty"`
+	Signature  []byte `protobuf:"bytes,6,opt,name=signature,proto3" json:"signature,omitempty"`
+	// issuedAt is when the request was signed. Agents refuse requests signed
+	// before they started, as the nonces they saw earlier are forgotten.
+	IssuedAt      *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=issuedAt,proto3" json:"issuedAt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
-var file_jarvis_proto_depIdxs = []int32{
-	3, // 0: jarvis.v1.Response.result:type_name -> jarvis.v1.CommandResult
-	2, // 1: jarvis.v1.Request.command:type_name -> jarvis.v1.CommandRequest
-	1, // 2: jarvis.v1.Jarvis.Connect:input_type -> jarvis.v1.Request
-	2, // 3: jarvis.v1.Jarvis.RunCommand:input_type -> jarvis.v1.CommandRequest
-	0, // 4: jarvis.v1.Jarvis.Connect:output_type -> jarvis.v1.Response
-	3, // 5: jarvis.v1.Jarvis.RunCommand:output_type -> jarvis.v1.CommandResult
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+
+func (x *RequestSignature) Reset() {
+	*x = RequestSignature{}
+	mi := &file_jarvis_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
-func init() { file_jarvis_proto_init() }
-func file_jarvis_proto_init() {
-	if File_jarvis_proto != nil {
-		return
+func (x *RequestSignature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestSignature) ProtoMessage() {}
+
+func (x *RequestSignature) ProtoReflect() protoreflect.Message {
+	mi := &file_jarvis_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestSignature.ProtoReflect.Descriptor instead.
+func (*RequestSignature) Descriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RequestSignature) GetKeyID() string {
+	if x != nil {
+		return x.KeyID
+	}
+	return ""
+}
+
+func (x *RequestSignature) GetNode() string {
+	if x != nil {
+		return x.Node
+	}
+	return ""
+}
+
+func (x *RequestSignature) GetNonce() []byte {
+	if x != nil {
+		return x.Nonce
+	}
+	return nil
+}
+
+func (x *RequestSignature) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *RequestSignature) GetCommandUID() string {
+	if x != nil {
+		return x.CommandUID
+	}
+	return ""
+}
+
+func (x *RequestSignature) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *RequestSignature) GetIssuedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.IssuedAt
+	}
+	return nil
+}
+
+type CommandResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// output is stdout and stderr interleaved in the order they were read.
+	Output []byte `protobuf:"bytes,2,opt,name=output,proto3" json:"output,omitempty"`
+	// exitCode is -1 when the command was killed by a signal or never started.
+	ExitCode  int32                  `protobuf:"varint,3,opt,name=exitCode,proto3" json:"exitCode,omitempty"`
+	Outcome   Outcome                `protobuf:"varint,4,opt,name=outcome,proto3,enum=jarvis.v1.Outcome" json:"outcome,omitempty"`
+	Stdout    []byte                 `protobuf:"bytes,5,opt,name=stdout,proto3" json:"stdout,omitempty"`
+	Stderr    []byte                 `protobuf:"bytes,6,opt,name=stderr,proto3" json:"stderr,omitempty"`
+	StartTime *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=startTime,proto3" json:"startTime,omitempty"`
+	EndTime   *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=endTime,proto3" json:"endTime,omitempty"`
+	// duration is the wall-clock time between startTime and endTime.
+	Duration *durationpb.Duration `protobuf:"bytes,9,opt,name=duration,proto3" json:"duration,omitempty"`
+	// signal names the signal that terminated the command, e.g. "SIGKILL".
+	Signal string `protobuf:"bytes,10,opt,name=signal,proto3" json:"signal,omitempty"`
+	// maxRssBytes is the peak resident set size of the command.
+	MaxRssBytes   int64                `protobuf:"varint,11,opt,name=maxRssBytes,proto3" json:"maxRssBytes,omitempty"`
+	UserCpuTime   *durationpb.Duration `protobuf:"bytes,12,opt,name=userCpuTime,proto3" json:"userCpuTime,omitempty"`
+	SystemCpuTime *durationpb.Duration `protobuf:"bytes,13,opt,name=systemCpuTime,proto3" json:"systemCpuTime,omitempty"`
+	// spawnError explains why the command could not be started.
+	SpawnError string   `protobuf:"bytes,14,opt,name=spawnError,proto3" json:"spawnError,omitempty"`
+	Encoding   Encoding `protobuf:"varint,15,opt,name=encoding,proto3,enum=jarvis.v1.Encoding" json:"encoding,omitempty"`
+	// truncated is set when output went over maxOutputBytes and the middle of
+	// it was dropped; droppedBytes says how much.
+	Truncated    bool  `protobuf:"varint,16,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	DroppedBytes int64 `protobuf:"varint,17,opt,name=droppedBytes,proto3" json:"droppedBytes,omitempty"`
+	// privilege is the view of the host the command ran in.
+	Privilege Privilege `protobuf:"varint,18,opt,name=privilege,proto3,enum=jarvis.v1.Privilege" json:"privilege,omitempty"`
+	// profile is the sandbox the command ran in.
+	Profile Profile `protobuf:"varint,19,opt,name=profile,proto3,enum=jarvis.v1.Profile" json:"profile,omitempty"`
+	// limitsHit lists the limits from the request's resources the command ran
+	// into.
+	LimitsHit     []Limit `protobuf:"varint,20,rep,packed,name=limitsHit,proto3,enum=jarvis.v1.Limit" json:"limitsHit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandResult) Reset() {
+	*x = CommandResult{}
+	mi := &file_jarvis_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandResult) ProtoMessage() {}
+
+func (x *CommandResult) ProtoReflect() protoreflect.Message {
+	mi := &file_jarvis_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandResult.ProtoReflect.Descriptor instead.
+func (*CommandResult) Descriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CommandResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CommandResult) GetOutput() []byte {
+	if x != nil {
+		return x.Output
+	}
+	return nil
+}
+
+func (x *CommandResult) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *CommandResult) GetOutcome() Outcome {
+	if x != nil {
+		return x.Outcome
+	}
+	return Outcome_OUTCOME_UNSPECIFIED
+}
+
+func (x *CommandResult) GetStdout() []byte {
+	if x != nil {
+		return x.Stdout
+	}
+	return nil
+}
+
+func (x *CommandResult) GetStderr() []byte {
+	if x != nil {
+		return x.Stderr
+	}
+	return nil
+}
+
+func (x *CommandResult) GetStartTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartTime
+	}
+	return nil
+}
+
+func (x *CommandResult) GetEndTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.EndTime
+	}
+	return nil
+}
+
+func (x *CommandResult) GetDuration() *durationpb.Duration {
+	if x != nil {
+		return x.Duration
+	}
+	return nil
+}
+
+func (x *CommandResult) GetSignal() string {
+	if x != nil {
+		return x.Signal
+	}
+	return ""
+}
+
+func (x *CommandResult) GetMaxRssBytes() int64 {
+	if x != nil {
+		return x.MaxRssBytes
+	}
+	return 0
+}
+
+func (x *CommandResult) GetUserCpuTime() *durationpb.Duration {
+	if x != nil {
+		return x.UserCpuTime
+	}
+	return nil
+}
+
+func (x *CommandResult) GetSystemCpuTime() *durationpb.Duration {
+	if x != nil {
+		return x.SystemCpuTime
+	}
+	return nil
+}
+
+func (x *CommandResult) GetSpawnError() string {
+	if x != nil {
+		return x.SpawnError
+	}
+	return ""
+}
+
+func (x *CommandResult) GetEncoding() Encoding {
+	if x != nil {
+		return x.Encoding
+	}
+	return Encoding_ENCODING_UNSPECIFIED
+}
+
+func (x *CommandResult) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *CommandResult) GetDroppedBytes() int64 {
+	if x != nil {
+		return x.DroppedBytes
+	}
+	return 0
+}
+
+func (x *CommandResult) GetPrivilege() Privilege {
+	if x != nil {
+		return x.Privilege
+	}
+	return Privilege_PRIVILEGE_UNSPECIFIED
+}
+
+func (x *CommandResult) GetProfile() Profile {
+	if x != nil {
+		return x.Profile
+	}
+	return Profile_PROFILE_UNSPECIFIED
+}
+
+func (x *CommandResult) GetLimitsHit() []Limit {
+	if x != nil {
+		return x.LimitsHit
+	}
+	return nil
+}
+
+type OutputChunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stream        Stream                 `protobuf:"varint,1,opt,name=stream,proto3,enum=jarvis.v1.Stream" json:"stream,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *OutputChunk) Reset() {
+	*x = OutputChunk{}
+	mi := &file_jarvis_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutputChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutputChunk) ProtoMessage() {}
+
+func (x *OutputChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_jarvis_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutputChunk.ProtoReflect.Descriptor instead.
+func (*OutputChunk) Descriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *OutputChunk) GetStream() Stream {
+	if x != nil {
+		return x.Stream
+	}
+	return Stream_STREAM_UNSPECIFIED
+}
+
+func (x *OutputChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type CommandOutput struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*CommandOutput_Chunk
+	//	*CommandOutput_Result
+	Payload       isCommandOutput_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandOutput) Reset() {
+	*x = CommandOutput{}
+	mi := &file_jarvis_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandOutput) ProtoMessage() {}
+
+func (x *CommandOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_jarvis_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandOutput.ProtoReflect.Descriptor instead.
+func (*CommandOutput) Descriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CommandOutput) GetPayload() isCommandOutput_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *CommandOutput) GetChunk() *OutputChunk {
+	if x != nil {
+		if x, ok := x.Payload.(*CommandOutput_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+func (x *CommandOutput) GetResult() *CommandResult {
+	if x != nil {
+		if x, ok := x.Payload.(*CommandOutput_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isCommandOutput_Payload interface {
+	isCommandOutput_Payload()
+}
+
+type CommandOutput_Chunk struct {
+	Chunk *OutputChunk `protobuf:"bytes,1,opt,name=chunk,proto3,oneof"`
+}
+
+type CommandOutput_Result struct {
+	Result *CommandResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*CommandOutput_Chunk) isCommandOutput_Payload() {}
+
+func (*CommandOutput_Result) isCommandOutput_Payload() {}
+
+type CancelRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelRequest) Reset() {
+	*x = CancelRequest{}
+	mi := &file_jarvis_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelRequest) ProtoMessage() {}
+
+func (x *CancelRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_jarvis_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelRequest.ProtoReflect.Descriptor instead.
+func (*CancelRequest) Descriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *CancelRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CancelResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// found is false when no command with the id was running.
+	Found bool `protobuf:"varint,1,opt,name=found,proto3" json:"found,omitempty"`
+	// stopped is true once the command has exited.
+	Stopped       bool `protobuf:"varint,2,opt,name=stopped,proto3" json:"stopped,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CancelResponse) Reset() {
+	*x = CancelResponse{}
+	mi := &file_jarvis_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CancelResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelResponse) ProtoMessage() {}
+
+func (x *CancelResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_jarvis_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelResponse.ProtoReflect.Descriptor instead.
+func (*CancelResponse) Descriptor() ([]byte, []int) {
+	return file_jarvis_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CancelResponse) GetFound() bool {
+	if x != nil {
+		return x.Found
+	}
+	return false
+}
+
+func (x *CancelResponse) GetStopped() bool {
+	if x != nil {
+		return x.Stopped
+	}
+	return false
+}
+
+var File_jarvis_proto protoreflect.FileDescriptor
+
+const file_jarvis_proto_rawDesc = "" +
+	"\n" +
+	"\fjarvis.proto\x12\tjarvis.v1\x1a\x1egoogle/protobuf/duration.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"X\n" +
+	"\bResponse\x12\x1a\n" +
+	"\bnodeName\x18\x01 \x01(\tR\bnodeName\x120\n" +
+	"\x06result\x18\x02 \x01(\v2\x18.jarvis.v1.CommandResultR\x06result\">\n" +
+	"\aRequest\x123\n" +
+	"\acommand\x18\x01 \x01(\v2\x19.jarvis.v1.CommandRequestR\acommand\"\xa2\x03\n" +
+	"\x0eCommandRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03cmd\x18\x02 \x01(\tR\x03cmd\x123\n" +
+	"\atimeout\x18\x03 \x01(\v2\x19.google.protobuf.DurationR\atimeout\x12;\n" +
+	"\vgracePeriod\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\vgracePeriod\x12&\n" +
+	"\x0emaxOutputBytes\x18\x05 \x01(\x03R\x0emaxOutputBytes\x129\n" +
+	"\tsignature\x18\x06 \x01(\v2\x1b.jarvis.v1.RequestSignatureR\tsignature\x122\n" +
+	"\tprivilege\x18\a \x01(\x0e2\x14.jarvis.v1.PrivilegeR\tprivilege\x12,\n" +
+	"\aprofile\x18\b \x01(\x0e2\x12.jarvis.v1.ProfileR\aprofile\x127\n" +
+	"\tresources\x18\t \x01(\v2\x19.jarvis.v1.ResourceLimitsR\tresources\"\x8a\x02\n" +
+	"\x0eResourceLimits\x12\x1c\n" +
+	"\tcpuMillis\x18\x01 \x01(\x03R\tcpuMillis\x12 \n" +
+	"\vmemoryBytes\x18\x02 \x01(\x03R\vmemoryBytes\x12\x1a\n" +
+	"\bioWeight\x18\x03 \x01(\rR\bioWeight\x12\x18\n" +
+	"\apidsMax\x18\x04 \x01(\x03R\apidsMax\x12\x17\n" +
+	"\x04nice\x18\x05 \x01(\x05H\x00R\x04nice\x88\x01\x01\x12,\n" +
+	"\aioClass\x18\x06 \x01(\x0e2\x12.jarvis.v1.IOClassR\aioClass\x12#\n" +
+	"\n" +
+	"ioPriority\x18\a \x01(\x05H\x01R\n" +
+	"ioPriority\x88\x01\x01B\a\n" +
+	"\x05_niceB\r\n" +
+	"\v_ioPriority\"\x82\x02\n" +
+	"\x10RequestSignature\x12\x14\n" +
+	"\x05keyID\x18\x01 \x01(\tR\x05keyID\x12\x12\n" +
+	"\x04node\x18\x02 \x01(\tR\x04node\x12\x14\n" +
+	"\x05nonce\x18\x03 \x01(\fR\x05nonce\x128\n" +
+	"\texpiresAt\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x12\x1e\n" +
+	"\n" +
+	"commandUID\x18\x05 \x01(\tR\n" +
+	"commandUID\x12\x1c\n" +
+	"\tsignature\x18\x06 \x01(\fR\tsignature\x126\n" +
+	"\bissuedAt\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\bissuedAt\"\xb5\x06\n" +
+	"\rCommandResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
+	"\x06output\x18\x02 \x01(\fR\x06output\x12\x1a\n" +
+	"\bexitCode\x18\x03 \x01(\x05R\bexitCode\x12,\n" +
+	"\aoutcome\x18\x04 \x01(\x0e2\x12.jarvis.v1.OutcomeR\aoutcome\x12\x16\n" +
+	"\x06stdout\x18\x05 \x01(\fR\x06stdout\x12\x16\n" +
+	"\x06stderr\x18\x06 \x01(\fR\x06stderr\x128\n" +
+	"\tstartTime\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tstartTime\x124\n" +
+	"\aendTime\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\aendTime\x125\n" +
+	"\bduration\x18\t \x01(\v2\x19.google.protobuf.DurationR\bduration\x12\x16\n" +
+	"\x06signal\x18\n" +
+	" \x01(\tR\x06signal\x12 \n" +
+	"\vmaxRssBytes\x18\v \x01(\x03R\vmaxRssBytes\x12;\n" +
+	"\vuserCpuTime\x18\f \x01(\v2\x19.google.protobuf.DurationR\vuserCpuTime\x12?\n" +
+	"\rsystemCpuTime\x18\r \x01(\v2\x19.google.protobuf.DurationR\rsystemCpuTime\x12\x1e\n" +
+	"\n" +
+	"spawnError\x18\x0e \x01(\tR\n" +
+	"spawnError\x12/\n" +
+	"\bencoding\x18\x0f \x01(\x0e2\x13.jarvis.v1.EncodingR\bencoding\x12\x1c\n" +
+	"\ttruncated\x18\x10 \x01(\bR\ttruncated\x12\"\n" +
+	"\fdroppedBytes\x18\x11 \x01(\x03R\fdroppedBytes\x122\n" +
+	"\tprivilege\x18\x12 \x01(\x0e2\x14.jarvis.v1.PrivilegeR\tprivilege\x12,\n" +
+	"\aprofile\x18\x13 \x01(\x0e2\x12.jarvis.v1.ProfileR\aprofile\x12.\n" +
+	"\tlimitsHit\x18\x14 \x03(\x0e2\x10.jarvis.v1.LimitR\tlimitsHit\"L\n" +
+	"\vOutputChunk\x12)\n" +
+	"\x06stream\x18\x01 \x01(\x0e2\x11.jarvis.v1.StreamR\x06stream\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"~\n" +
+	"\rCommandOutput\x12.\n" +
+	"\x05chunk\x18\x01 \x01(\v2\x16.jarvis.v1.OutputChunkH\x00R\x05chunk\x122\n" +
+	"\x06result\x18\x02 \x01(\v2\x18.jarvis.v1.CommandResultH\x00R\x06resultB\t\n" +
+	"\apayload\"\x1f\n" +
+	"\rCancelRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"@\n" +
+	"\x0eCancelResponse\x12\x14\n" +
+	"\x05found\x18\x01 \x01(\bR\x05found\x12\x18\n" +
+	"\astopped\x18\x02 \x01(\bR\astopped*P\n" +
+	"\aIOClass\x12\x18\n" +
+	"\x14IO_CLASS_UNSPECIFIED\x10\x00\x12\x18\n" +
+	"\x14IO_CLASS_BEST_EFFORT\x10\x02\x12\x11\n" +
+	"\rIO_CLASS_IDLE\x10\x03*c\n" +
+	"\x05Limit\x12\x15\n" +
+	"\x11LIMIT_UNSPECIFIED\x10\x00\x12\r\n" +
+	"\tLIMIT_CPU\x10\x01\x12\x10\n" +
+	"\fLIMIT_MEMORY\x10\x02\x12\x12\n" +
+	"\x0eLIMIT_OOM_KILL\x10\x03\x12\x0e\n" +
+	"\n" +
+	"LIMIT_PIDS\x10\x04*Y\n" +
+	"\tPrivilege\x12\x19\n" +
+	"\x15PRIVILEGE_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13PRIVILEGE_READ_ONLY\x10\x01\x12\x18\n" +
+	"\x14PRIVILEGE_READ_WRITE\x10\x02*j\n" +
+	"\aProfile\x12\x17\n" +
+	"\x13PROFILE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fPROFILE_FULL\x10\x01\x12\x16\n" +
+	"\x12PROFILE_DIAGNOSTIC\x10\x02\x12\x1c\n" +
+	"\x18PROFILE_NETWORK_ISOLATED\x10\x03*\x84\x01\n" +
+	"\aOutcome\x12\x17\n" +
+	"\x13OUTCOME_UNSPECIFIED\x10\x00\x12\x15\n" +
+	"\x11OUTCOME_COMPLETED\x10\x01\x12\x15\n" +
+	"\x11OUTCOME_TIMED_OUT\x10\x02\x12\x15\n" +
+	"\x11OUTCOME_CANCELLED\x10\x03\x12\x1b\n" +
+	"\x17OUTCOME_FAILED_TO_START\x10\x04*L\n" +
+	"\bEncoding\x12\x18\n" +
+	"\x14ENCODING_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rENCODING_UTF8\x10\x01\x12\x13\n" +
+	"\x0fENCODING_BINARY\x10\x02*F\n" +
+	"\x06Stream\x12\x16\n" +
+	"\x12STREAM_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rSTREAM_STDOUT\x10\x01\x12\x11\n" +
+	"\rSTREAM_STDERR\x10\x022\x8a\x02\n" +
+	"\x06Jarvis\x126\n" +
+	"\aConnect\x12\x12.jarvis.v1.Request\x1a\x13.jarvis.v1.Response(\x010\x01\x12A\n" +
+	"\n" +
+	"RunCommand\x12\x19.jarvis.v1.CommandRequest\x1a\x18.jarvis.v1.CommandResult\x12F\n" +
+	"\rStreamCommand\x12\x19.jarvis.v1.CommandRequest\x1a\x18.jarvis.v1.CommandOutput0\x01\x12=\n" +
+	"\x06Cancel\x12\x18.jarvis.v1.CancelRequest\x1a\x19.jarvis.v1.CancelResponseB\"Z github.com/motilayo/jarvis/agentb\x06proto3"
+
+var (
+	file_jarvis_proto_rawDescOnce sync.Once
+	file_jarvis_proto_rawDescData []byte
+)
+
+func file_jarvis_proto_rawDescGZIP() []byte {
+	file_jarvis_proto_rawDescOnce.Do(func() {
+		file_jarvis_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_jarvis_proto_rawDesc), len(file_jarvis_proto_rawDesc)))
+	})
+	return file_jarvis_proto_rawDescData
+}
+
+var file_jarvis_proto_enumTypes = make([]protoimpl.EnumInfo, 7)
+var file_jarvis_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_jarvis_proto_goTypes = []any{
+	(IOClass)(0),                  // 0: jarvis.v1.IOClass
+	(Limit)(0),                    // 1: jarvis.v1.Limit
+	(Privilege)(0),                // 2: jarvis.v1.Privilege
+	(Profile)(0),                  // 3: jarvis.v1.Profile
+	(Outcome)(0),                  // 4: jarvis.v1.Outcome
+	(Encoding)(0),                 // 5: jarvis.v1.Encoding
+	(Stream)(0),                   // 6: jarvis.v1.Stream
+	(*Response)(nil),              // 7: jarvis.v1.Response
+	(*Request)(nil),               // 8: jarvis.v1.Request
+	(*CommandRequest)(nil),        // 9: jarvis.v1.CommandRequest
+	(*ResourceLimits)(nil),        // 10: jarvis.v1.ResourceLimits
+	(*RequestSignature)(nil),      // 11: jarvis.v1.RequestSignature
+	(*CommandResult)(nil),         // 12: jarvis.v1.CommandResult
+	(*OutputChunk)(nil),           // 13: jarvis.v1.OutputChunk
+	(*CommandOutput)(nil),         // 14: jarvis.v1.CommandOutput
+	(*CancelRequest)(nil),         // 15: jarvis.v1.CancelRequest
+	(*CancelResponse)(nil),        // 16: jarvis.v1.CancelResponse
+	(*durationpb.Duration)(nil),   // 17: google.protobuf.Duration
+	(*timestamppb.Timestamp)(nil), // 18: google.protobuf.Timestamp
+}
+var file_jarvis_proto_depIdxs = []int32{
+	12, // 0: jarvis.v1.Response.result:type_name -> jarvis.v1.CommandResult
+	9,  // 1: jarvis.v1.Request.command:type_name -> jarvis.v1.CommandRequest
+	17, // 2: jarvis.v1.CommandRequest.timeout:type_name -> google.protobuf.Duration
+	17, // 3: jarvis.v1.CommandRequest.gracePeriod:type_name -> google.protobuf.Duration
+	11, // 4: jarvis.v1.CommandRequest.signature:type_name -> jarvis.v1.RequestSignature
+	2,  // 5: jarvis.v1.CommandRequest.privilege:type_name -> jarvis.v1.Privilege
+	3,  // 6: jarvis.v1.CommandRequest.profile:type_name -> jarvis.v1.Profile
+	10, // 7: jarvis.v1.CommandRequest.resources:type_name -> jarvis.v1.ResourceLimits
+	0,  // 8: jarvis.v1.ResourceLimits.ioClass:type_name -> jarvis.v1.IOClass
+	18, // 9: jarvis.v1.RequestSignature.expiresAt:type_name -> google.protobuf.Timestamp
+	18, // 10: jarvis.v1.RequestSignature.issuedAt:type_name -> google.protobuf.Timestamp
+	4,  // 11: jarvis.v1.CommandResult.outcome:type_name -> jarvis.v1.Outcome
+	18, // 12: jarvis.v1.CommandResult.startTime:type_name -> google.protobuf.Timestamp
+	18, // 13: jarvis.v1.CommandResult.endTime:type_name -> google.protobuf.Timestamp
+	17, // 14: jarvis.v1.CommandResult.duration:type_name -> google.protobuf.Duration
+	17, // 15: jarvis.v1.CommandResult.userCpuTime:type_name -> google.protobuf.Duration
+	17, // 16: jarvis.v1.CommandResult.systemCpuTime:type_name -> google.protobuf.Duration
+	5,  // 17: jarvis.v1.CommandResult.encoding:type_name -> jarvis.v1.Encoding
+	2,  // 18: jarvis.v1.CommandResult.privilege:type_name -> jarvis.v1.Privilege
+	3,  // 19: jarvis.v1.CommandResult.profile:type_name -> jarvis.v1.Profile
+	1,  // 20: jarvis.v1.CommandResult.limitsHit:type_name -> jarvis.v1.Limit
+	6,  // 21: jarvis.v1.OutputChunk.stream:type_name -> jarvis.v1.Stream
+	13, // 22: jarvis.v1.CommandOutput.chunk:type_name -> jarvis.v1.OutputChunk
+	12, // 23: jarvis.v1.CommandOutput.result:type_name -> jarvis.v1.CommandResult
+	8,  // 24: jarvis.v1.Jarvis.Connect:input_type -> jarvis.v1.Request
+	9,  // 25: jarvis.v1.Jarvis.RunCommand:input_type -> jarvis.v1.CommandRequest
+	9,  // 26: jarvis.v1.Jarvis.StreamCommand:input_type -> jarvis.v1.CommandRequest
+	15, // 27: jarvis.v1.Jarvis.Cancel:input_type -> jarvis.v1.CancelRequest
+	7,  // 28: jarvis.v1.Jarvis.Connect:output_type -> jarvis.v1.Response
+	12, // 29: jarvis.v1.Jarvis.RunCommand:output_type -> jarvis.v1.CommandResult
+	14, // 30: jarvis.v1.Jarvis.StreamCommand:output_type -> jarvis.v1.CommandOutput
+	16, // 31: jarvis.v1.Jarvis.Cancel:output_type -> jarvis.v1.CancelResponse
+	28, // [28:32] is the sub-list for method output_type
+	24, // [24:28] is the sub-list for method input_type
+	24, // [24:24] is the sub-list for extension type_name
+	24, // [24:24] is the sub-list for extension extendee
+	0,  // [0:24] is the sub-list for field type_name
+}
+
+func init() { file_jarvis_proto_init() }
+func file_jarvis_proto_init() {
+	if File_jarvis_proto != nil {
+		return
+	}
+	file_jarvis_proto_msgTypes[3].OneofWrappers = []any{}
+	file_jarvis_proto_msgTypes[7].OneofWrappers = []any{
+		(*CommandOutput_Chunk)(nil),
+		(*CommandOutput_Result)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_jarvis_proto_rawDesc), len(file_jarvis_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   4,
+			NumEnums:      7,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_jarvis_proto_goTypes,
 		DependencyIndexes: file_jarvis_proto_depIdxs,
+		EnumInfos:         file_jarvis_proto_enumTypes,
 		MessageInfos:      file_jarvis_proto_msgTypes,
 	}.Build()
 	File_jarvis_proto = out.File
@@ -19,8 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Jarvis_Connect_FullMethodName    = "/jarvis.v1.Jarvis/Connect"
-	Jarvis_RunCommand_FullMethodName = "/jarvis.v1.Jarvis/RunCommand"
+	Jarvis_Connect_FullMethodName       = "/jarvis.v1.Jarvis/Connect"
+	Jarvis_RunCommand_FullMethodName    = "/jarvis.v1.Jarvis/RunCommand"
+	Jarvis_StreamCommand_FullMethodName = "/jarvis.v1.Jarvis/StreamCommand"
+	Jarvis_Cancel_FullMethodName        = "/jarvis.v1.Jarvis/Cancel"
 )
 
 // JarvisClient is the client API for Jarvis service.
@@ -29,6 +31,13 @@ const (
 type JarvisClient interface {
 	Connect(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Request, Response], error)
 	RunCommand(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (*CommandResult, error)
+	// StreamCommand runs a command and sends its output as it is produced,
+	// followed by a single final message carrying the result.
+	StreamCommand(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CommandOutput], error)
+	// Cancel kills the running command with the given id, and any re-run of it
+	// with an id of the form "<id>#<n>", and waits for them to exit or for the
+	// call's deadline to pass.
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error)
 }
 
 type jarvisClient struct {
@@ -62,12 +71,48 @@ func (c *jarvisClient) RunCommand(ctx context.Context, in *CommandRequest, opts
 	return out, nil
 }
 
+func (c *jarvisClient) StreamCommand(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CommandOutput], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Jarvis_ServiceDesc.Streams[1], Jarvis_StreamCommand_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CommandRequest, CommandOutput]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Jarvis_StreamCommandClient = grpc.ServerStreamingClient[CommandOutput]
+
+func (c *jarvisClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CancelResponse)
+	err := c.cc.Invoke(ctx, Jarvis_Cancel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // JarvisServer is the server API for Jarvis service.
 // All implementations must embed UnimplementedJarvisServer
 // for forward compatibility.
 type JarvisServer interface {
 	Connect(grpc.BidiStreamingServer[Request, Response]) error
 	RunCommand(context.Context, *CommandRequest) (*CommandResult, error)
+	// StreamCommand runs a command and sends its output as it is produced,
+	// followed by a single final message carrying the result.
+	StreamCommand(*CommandRequest, grpc.ServerStreamingServer[CommandOutput]) error
+	// Cancel kills the running command with the given id, and any re-run of it
+	// with an id of the form "<id>#<n>", and waits for them to exit or for the
+	// call's deadline to pass.
+	Cancel(context.Context, *CancelRequest) (*CancelResponse, error)
 	mustEmbedUnimplementedJarvisServer()
 }
 
@@ -84,6 +129,12 @@ func (UnimplementedJarvisServer) Connect(grpc.BidiStreamingServer[Request, Respo
 func (UnimplementedJarvisServer) RunCommand(context.Context, *CommandRequest) (*CommandResult, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RunCommand not implemented")
 }
+func (UnimplementedJarvisServer) StreamCommand(*CommandRequest, grpc.ServerStreamingServer[CommandOutput]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamCommand not implemented")
+}
+func (UnimplementedJarvisServer) Cancel(context.Context, *CancelRequest) (*CancelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
 func (UnimplementedJarvisServer) mustEmbedUnimplementedJarvisServer() {}
 func (UnimplementedJarvisServer) testEmbeddedByValue()                {}
 
@@ -130,6 +181,35 @@ func _Jarvis_RunCommand_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Jarvis_StreamCommand_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CommandRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(JarvisServer).StreamCommand(m, &grpc.GenericServerStream[CommandRequest, CommandOutput]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Jarvis_StreamCommandServer = grpc.ServerStreamingServer[CommandOutput]
+
+func _Jarvis_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JarvisServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Jarvis_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JarvisServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Jarvis_ServiceDesc is the grpc.ServiceDesc for Jarvis service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -141,6 +221,10 @@ var Jarvis_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RunCommand",
 			Handler:    _Jarvis_RunCommand_Handler,
 		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Jarvis_Cancel_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -149,6 +233,11 @@ var Jarvis_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "StreamCommand",
+			Handler:       _Jarvis_StreamCommand_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "jarvis.proto",
 }
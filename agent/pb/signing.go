@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	// signingDomain starts every signed payload, so that a signature over a
+	// request cannot be passed off as one over anything else.
+	signingDomain = "jarvis.v1.CommandRequest"
+	// digestDomain starts what RequestDigest hashes.
+	digestDomain = "jarvis.v1.CommandRequest.digest"
+)
+
+// SigningPayload returns the bytes req's signature is made over: the fields
+// listed on RequestSignature, each length-prefixed so that no two requests
+// lay out the same.
+func SigningPayload(req *CommandRequest) []byte {
+	sig := req.GetSignature()
+	e := encodeRequest(signingDomain, req)
+	e.field([]byte(sig.GetKeyID()))
+	e.field([]byte(sig.GetNode()))
+	e.field(sig.GetNonce())
+	e.number(sig.GetExpiresAt().AsTime().UnixNano())
+	e.field([]byte(sig.GetCommandUID()))
+	e.number(sig.GetIssuedAt().AsTime().UnixNano())
+	return e.b
+}
+
+// RequestDigest identifies what req asks to run, so that a retry of a request
+// can be told apart from another request reusing its ID. It covers what the
+// signature does, except for what changes with every attempt: the key, the
+// nonce, the issue and expiry times and the signature itself.
+func RequestDigest(req *CommandRequest) []byte {
+	sig := req.GetSignature()
+	e := encodeRequest(digestDomain, req)
+	e.field([]byte(sig.GetNode()))
+	e.field([]byte(sig.GetCommandUID()))
+	sum := sha256.Sum256(e.b)
+	return sum[:]
+}
+
+// encodeRequest lays out domain and the fields of req that say what to run.
+func encodeRequest(domain string, req *CommandRequest) *encoder {
+	e := &encoder{}
+	e.field([]byte(domain))
+	e.field([]byte(req.GetId()))
+	e.field([]byte(req.GetCmd()))
+	e.duration(req.GetTimeout())
+	e.duration(req.GetGracePeriod())
+	e.number(req.GetMaxOutputBytes())
+	e.number(int64(req.GetPrivilege()))
+	e.number(int64(req.GetProfile()))
+	if r := req.GetResources(); r == nil {
+		e.b = append(e.b, 0)
+	} else {
+		e.b = append(e.b, 1)
+		e.number(r.GetCpuMillis())
+		e.number(r.GetMemoryBytes())
+		e.number(int64(r.GetIoWeight()))
+		e.number(r.GetPidsMax())
+		e.optional(r.Nice)
+		e.number(int64(r.GetIoClass()))
+		e.optional(r.IoPriority)
+	}
+	return e
+}
+
+// encoder lays out fields unambiguously.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) field(data []byte) {
+	e.b = binary.BigEndian.AppendUint32(e.b, uint32(len(data)))
+	e.b = append(e.b, data...)
+}
+
+func (e *encoder) number(n int64) {
+	e.b = binary.BigEndian.AppendUint64(e.b, uint64(n))
+}
+
+// duration lays out d. An unset duration means something else than a zero
+// one.
+func (e *encoder) duration(d *durationpb.Duration) {
+	if d == nil {
+		e.b = append(e.b, 0)
+		return
+	}
+	e.b = append(e.b, 1)
+	e.number(int64(d.AsDuration()))
+}
+
+// optional lays out n, which likewise may be unset.
+func (e *encoder) optional(n *int32) {
+	if n == nil {
+		e.b = append(e.b, 0)
+		return
+	}
+	e.b = append(e.b, 1)
+	e.number(int64(*n))
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"mvdan.cc/sh/v3/syntax"
+	"sigs.k8s.io/yaml"
+)
+
+// policyPollInterval is how often the policy file is checked for changes.
+const policyPollInterval = 10 * time.Second
+
+// shellMetacharacters are the characters that make sh do more than run one
+// program with literal arguments: chain, pipe, redirect, substitute, expand
+// or glob.
+const shellMetacharacters = "|&;<>()$`\\\n*?[]{}~"
+
+// Policy is the node's own say over what runs on it, read from the file
+// given with --policy-file. It applies whatever the controller sends.
+type Policy struct {
+	// AllowedBinaries, if not empty, are the only programs a command may
+	// run. A name without a slash, like "systemctl", allows running it
+	// from the PATH; a path, like "/usr/bin/systemctl", allows exactly that
+	// file. The program a wrapper such as env, nice or timeout runs must be
+	// allowed too, and programs that run commands in ways that cannot be
+	// followed, such as sh -c, xargs or busybox, are refused.
+	AllowedBinaries []string `json:"allowedBinaries,omitempty"`
+	// Denied are rules no command may match.
+	Denied []DenyRule `json:"denied,omitempty"`
+	// AllowShellMetacharacters permits pipes, redirects, substitutions and
+	// the like. Without it a command is one program and its arguments.
+	AllowShellMetacharacters bool `json:"allowShellMetacharacters,omitempty"`
+}
+
+// DenyRule refuses commands matching Regex anywhere, or matching Glob as a
+// whole. Exactly one of them is set.
+type DenyRule struct {
+	// Name identifies the rule in refusals. It defaults to the rule's
+	// position, like "denied[2]".
+	Name string `json:"name,omitempty"`
+	// Regex is a regular expression (RE2).
+	Regex string `json:"regex,omitempty"`
+	// Glob is a pattern in which * matches any text, ? any one character
+	// and [...] any character listed.
+	Glob string `json:"glob,omitempty"`
+}
+
+// compiledPolicy is a Policy ready to check commands against.
+type compiledPolicy struct {
+	file     string
+	policy   Policy
+	patterns []*regexp.Regexp
+}
+
+// loadPolicy reads and compiles the policy in file.
+func loadPolicy(file string) (*compiledPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	var patterns []*regexp.Regexp
+	for i, rule := range policy.Denied {
+		if rule.Name == "" {
+			policy.Denied[i].Name = fmt.Sprintf("denied[%d]", i)
+		}
+		var pattern string
+		switch {
+		case (rule.Regex == "") == (rule.Glob == ""):
+			return nil, fmt.Errorf("%s: denied[%d]: exactly one of regex and glob must be set", file, i)
+		case rule.Regex != "":
+			pattern = rule.Regex
+		default:
+			pattern = globPattern(rule.Glob)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: denied[%d]: %w", file, i, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return &compiledPolicy{file: file, policy: policy, patterns: patterns}, nil
+}
+
+// globPattern translates glob into a regular expression matching the whole
+// of a command.
+func globPattern(glob string) string {
+	var b strings.Builder
+	b.WriteString(`^(?s:`)
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(`.*`)
+		case '?':
+			b.WriteString(`.`)
+		case '[':
+			if end := strings.IndexByte(glob[i+1:], ']'); end > 0 {
+				class := glob[i+1 : i+1+end]
+				if class[0] == '!' {
+					class = "^" + class[1:]
+				}
+				b.WriteString("[" + class + "]")
+				i += end + 1
+				continue
+			}
+			b.WriteString(`\[`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString(`)$`)
+	return b.String()
+}
+
+// check returns the rule that refuses command and why, or an empty rule if
+// the policy allows it.
+func (p *compiledPolicy) check(command string) (rule, reason string) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return "syntax", fmt.Sprintf("command does not parse: %v", err)
+	}
+	if !p.policy.AllowShellMetacharacters {
+		if i := strings.IndexAny(command, shellMetacharacters); i >= 0 {
+			return "allowShellMetacharacters", fmt.Sprintf("shell metacharacter %q is not allowed", command[i])
+		}
+	}
+	for i, re := range p.patterns {
+		if re.MatchString(command) {
+			denied := p.policy.Denied[i]
+			return denied.Name, fmt.Sprintf("command matches %q", cmp.Or(denied.Regex, denied.Glob))
+		}
+	}
+	if len(p.policy.AllowedBinaries) > 0 {
+		syntax.Walk(file, func(node syntax.Node) bool {
+			call, ok := node.(*syntax.CallExpr)
+			if !ok || len(call.Args) == 0 || rule != "" {
+				return rule == ""
+			}
+			args := make([]string, 0, len(call.Args))
+			for _, word := range call.Args {
+				args = append(args, literal(word))
+			}
+			rule, reason = p.checkProgram(args)
+			return rule == ""
+		})
+	}
+	return rule, reason
+}
+
+// checkProgram checks the program args runs against allowedBinaries,
+// following wrappers to the program they run.
+func (p *compiledPolicy) checkProgram(args []string) (rule, reason string) {
+	for len(args) > 0 {
+		name := args[0]
+		switch {
+		case name == "":
+			return "allowedBinaries", "the program to run is not a literal name"
+		case !slices.Contains(p.policy.AllowedBinaries, name):
+			return "allowedBinaries", fmt.Sprintf("%s is not an allowed binary", name)
+		case slices.Contains(runners, path.Base(name)),
+			path.Base(name) == "find" && slices.ContainsFunc(args[1:], isFindExec):
+			return "allowedBinaries", fmt.Sprintf("%s runs commands that cannot be checked against allowedBinaries", name)
+		}
+		w, ok := wrappers[path.Base(name)]
+		if !ok {
+			return "", ""
+		}
+		var err error
+		if args, err = w.command(args[1:]); err != nil {
+			return "allowedBinaries", fmt.Sprintf("cannot tell what %s runs: %v", name, err)
+		}
+	}
+	return "", ""
+}
+
+// wrapper describes the options of a program that runs the rest of its
+// arguments as a command, so that the command can be found.
+type wrapper struct {
+	// flags and values are the short options taking no value and a value.
+	flags, values string
+	// long are the long options taking no value. Long options taking one
+	// must be given as --name=value.
+	long []string
+	// assignments skips NAME=VALUE arguments before the command, as env
+	// takes them.
+	assignments bool
+	// leading counts the arguments before the command, like timeout's
+	// duration.
+	leading int
+}
+
+// wrappers are the wrappers followed to the program they run. Options not
+// listed are refused, as they might take the program's place.
+var wrappers = map[string]wrapper{
+	"command": {flags: "p"},
+	"exec":    {flags: "cl", values: "a"},
+	"nohup":   {},
+	"setsid":  {flags: "cfw", long: []string{"--ctty", "--fork", "--wait"}},
+	"nice":    {values: "n"},
+	"ionice":  {flags: "t", values: "cn", long: []string{"--ignore"}},
+	"env":     {flags: "i0", values: "uC", long: []string{"--ignore-environment", "--null"}, assignments: true},
+	"timeout": {flags: "v", values: "sk", long: []string{"--foreground", "--preserve-status", "--verbose"}, leading: 1},
+	"stdbuf":  {values: "ioe"},
+	"sudo":    {flags: "bEHnPS", values: "uUgpCDrtT", long: []string{"--background", "--preserve-env", "--set-home", "--non-interactive", "--preserve-groups", "--stdin"}},
+}
+
+// runners run commands in ways that cannot be followed: from a string, from
+// their input or as applets of their own.
+var runners = []string{
+	"sh", "bash", "dash", "ash", "ksh", "mksh", "zsh", "busybox", "toybox",
+	"xargs", "parallel", "watch", "su", "runuser", "chroot", "nsenter", "unshare",
+	"flock", "strace", "ltrace", "gdb", "script", "ssh",
+}
+
+// isFindExec reports whether arg makes find run a command.
+func isFindExec(arg string) bool {
+	switch arg {
+	case "-exec", "-execdir", "-ok", "-okdir":
+		return true
+	}
+	return false
+}
+
+// command returns the command a wrapper given args runs, starting with the
+// program, or nothing if it runs none.
+func (w wrapper) command(args []string) ([]string, error) {
+options:
+	for len(args) > 0 {
+		arg := args[0]
+		switch {
+		case arg == "--":
+			args = args[1:]
+			break options
+		case strings.HasPrefix(arg, "--"):
+			if !strings.Contains(arg, "=") && !slices.Contains(w.long, arg) {
+				return nil, fmt.Errorf("unknown option %s", arg)
+			}
+			args = args[1:]
+		case arg == "-":
+			return nil, errors.New("unknown option -")
+		case strings.HasPrefix(arg, "-"):
+			args = args[1:]
+			for i := 1; i < len(arg); i++ {
+				switch c := arg[i]; {
+				case strings.IndexByte(w.flags, c) >= 0:
+				case strings.IndexByte(w.values, c) >= 0:
+					if i == len(arg)-1 && len(args) > 0 {
+						// The value is the next argument.
+						args = args[1:]
+					}
+					i = len(arg)
+				default:
+					return nil, fmt.Errorf("unknown option -%c", c)
+				}
+			}
+		default:
+			break options
+		}
+	}
+	for w.assignments && len(args) > 0 && strings.Contains(args[0], "=") {
+		args = args[1:]
+	}
+	if len(args) < w.leading {
+		return nil, nil
+	}
+	return args[w.leading:], nil
+}
+
+// literal returns the text of word if it involves no expansion, quoted or
+// not, and "" otherwise.
+func literal(word *syntax.Word) string {
+	var b strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range part.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return ""
+				}
+				b.WriteString(lit.Value)
+			}
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// policyStore holds the policy in effect. A nil *policyStore allows
+// everything.
+type policyStore struct {
+	current atomic.Pointer[compiledPolicy]
+}
+
+// authorize returns a PermissionDenied error naming the rule that refuses
+// command, or nil if the policy allows it.
+func (s *policyStore) authorize(command string) error {
+	if s == nil {
+		return nil
+	}
+	p := s.current.Load()
+	rule, reason := p.check(command)
+	if rule == "" {
+		return nil
+	}
+	st, err := status.New(codes.PermissionDenied, fmt.Sprintf("refused by node policy, rule %s: %s", rule, reason)).
+		WithDetails(&errdetails.ErrorInfo{
+			Reason:   pb.ReasonNodePolicyDenied,
+			Domain:   pb.ErrorDomain,
+			Metadata: map[string]string{"rule": rule, "policy": p.file},
+		})
+	if err != nil {
+		return status.Errorf(codes.PermissionDenied, "refused by node policy, rule %s: %s", rule, reason)
+	}
+	return st.Err()
+}
+
+// watchFile loads the policy from file, then reloads it whenever the file
+// changes until ctx is done. A policy that fails to load is not put in
+// effect; the last good one stays.
+func (s *policyStore) watchFile(ctx context.Context, logger *slog.Logger, file string) error {
+	modified := func() time.Time {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	loaded := modified()
+	p, err := loadPolicy(file)
+	if err != nil {
+		return err
+	}
+	s.current.Store(p)
+	logger.Info("Loaded node policy", "file", file)
+	go func() {
+		ticker := time.NewTicker(policyPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest := modified()
+			if latest.Equal(loaded) {
+				continue
+			}
+			p, err := loadPolicy(file)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					logger.Error("Failed to reload node policy; keeping the last one", "file", file, "error", err)
+				}
+				continue
+			}
+			loaded = latest
+			s.current.Store(p)
+			logger.Info("Reloaded node policy", "file", file)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestGlobPattern(t *testing.T) {
+	tests := []struct {
+		glob    string
+		command string
+		want    bool
+	}{
+		{"*--force*", "rm --force x", true},
+		{"*--force*", "rm -f x", false},
+		{"rm ?", "rm x", true},
+		{"rm ?", "rm xy", false},
+		{"rm [ab]", "rm a", true},
+		{"rm [!ab]", "rm a", false},
+		{"rm [!ab]", "rm c", true},
+		{"a.b", "axb", false},
+		{"rm [", "rm [", true},
+		{"*", "line one\nline two", true},
+	}
+	for _, tt := range tests {
+		p := compile(t, Policy{Denied: []DenyRule{{Glob: tt.glob}}})
+		if got := p.patterns[0].MatchString(tt.command); got != tt.want {
+			t.Errorf("glob %q on %q: matched = %v, want %v", tt.glob, tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"regex", "denied:\n  - regex: 'reboot'\n", false},
+		{"glob", "denied:\n  - glob: 'rm *'\n", false},
+		{"both", "denied:\n  - regex: 'a'\n    glob: 'b'\n", true},
+		{"neither", "denied:\n  - name: x\n", true},
+		{"bad regex", "denied:\n  - regex: '('\n", true},
+		{"unknown field", "allowed: [ls]\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(file, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadPolicy(file)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	allowed := []string{"uptime", "/usr/bin/journalctl", "nice", "env", "timeout", "sudo", "sh", "find"}
+	tests := []struct {
+		name     string
+		policy   Policy
+		command  string
+		wantRule string
+	}{
+		{"anything goes", Policy{}, "rm -rf /tmp/x", ""},
+		{"syntax", Policy{}, "echo 'unterminated", "syntax"},
+		{"metacharacter", Policy{}, "uptime | cat", "allowShellMetacharacters"},
+		{"metacharacters allowed", Policy{AllowShellMetacharacters: true}, "uptime | cat", ""},
+		{"denied by name", Policy{Denied: []DenyRule{{Name: "no-reboot", Regex: `\breboot\b`}}}, "reboot now", "no-reboot"},
+		{"denied by index", Policy{Denied: []DenyRule{{Regex: "x"}, {Glob: "*reboot*"}}}, "sudo reboot", "denied[1]"},
+		{"allowed binary", Policy{AllowedBinaries: allowed}, "uptime", ""},
+		{"allowed path", Policy{AllowedBinaries: allowed}, "/usr/bin/journalctl -u kubelet", ""},
+		{"path not name", Policy{AllowedBinaries: allowed}, "journalctl -u kubelet", "allowedBinaries"},
+		{"not allowed", Policy{AllowedBinaries: allowed}, "rm x", "allowedBinaries"},
+		{"every call", Policy{AllowedBinaries: allowed, AllowShellMetacharacters: true}, "uptime | rm x", "allowedBinaries"},
+		{"expansion", Policy{AllowedBinaries: allowed, AllowShellMetacharacters: true}, "$CMD", "allowedBinaries"},
+		{"quoted", Policy{AllowedBinaries: allowed}, "'uptime'", ""},
+		{"wrapped allowed", Policy{AllowedBinaries: allowed}, "nice -n 10 uptime", ""},
+		{"wrapped value attached", Policy{AllowedBinaries: allowed}, "nice -n10 uptime", ""},
+		{"wrapped not allowed", Policy{AllowedBinaries: allowed}, "nice -n 10 rm x", "allowedBinaries"},
+		{"env assignments", Policy{AllowedBinaries: allowed}, "env -i A=1 B=2 rm x", "allowedBinaries"},
+		{"env unset", Policy{AllowedBinaries: allowed}, "env -u uptime rm x", "allowedBinaries"},
+		{"env split string", Policy{AllowedBinaries: allowed}, "env -S 'rm x'", "allowedBinaries"},
+		{"env long option with value", Policy{AllowedBinaries: allowed}, "env --unset uptime rm x", "allowedBinaries"},
+		{"timeout duration", Policy{AllowedBinaries: allowed}, "timeout -s KILL 5 uptime", ""},
+		{"timeout wraps", Policy{AllowedBinaries: allowed}, "timeout 5 rm x", "allowedBinaries"},
+		{"nested wrappers", Policy{AllowedBinaries: allowed}, "sudo -u root nice timeout 5 rm x", "allowedBinaries"},
+		{"end of options", Policy{AllowedBinaries: allowed}, "nice -- uptime", ""},
+		{"wrapper alone", Policy{AllowedBinaries: allowed}, "nice", ""},
+		{"wrapper not allowed", Policy{AllowedBinaries: []string{"uptime"}}, "nice uptime", "allowedBinaries"},
+		{"sudo shell", Policy{AllowedBinaries: allowed}, "sudo -s uptime", "allowedBinaries"},
+		{"shell", Policy{AllowedBinaries: allowed}, "sh -c 'rm x'", "allowedBinaries"},
+		{"find exec", Policy{AllowedBinaries: allowed, AllowShellMetacharacters: true}, `find / -exec rm {} \;`, "allowedBinaries"},
+		{"find", Policy{AllowedBinaries: allowed}, "find /var/log -name syslog", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := compile(t, tt.policy)
+			rule, reason := p.check(tt.command)
+			if rule != tt.wantRule {
+				t.Errorf("check(%q) = %q (%s), want %q", tt.command, rule, reason, tt.wantRule)
+			}
+		})
+	}
+}
+
+// compile compiles policy the way loadPolicy does.
+func compile(t *testing.T, policy Policy) *compiledPolicy {
+	t.Helper()
+	data, err := yaml.Marshal(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := loadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// completedTTL is how long a finished command's result is kept so that a
+	// caller retrying after a dropped connection gets it back instead of
+	// running the command again.
+	completedTTL = 10 * time.Minute
+	// completedMaxEntries and completedMaxBytes bound the kept results. The
+	// byte bound is kept well above maxOutputBytesLimit, so that no result is
+	// too large to keep.
+	completedMaxEntries = 256
+	completedMaxBytes   = 32 << 20
+)
+
+// reattachWindow is how long a command that can outlive its caller keeps
+// running once nobody is waiting for it, for a retry to come back for it. It
+// covers the controller's default maximum backoff between retries.
+var reattachWindow = time.Minute
+
+var (
+	// errCancelRequested is the cause recorded when a command is stopped
+	// through the Cancel RPC.
+	errCancelRequested = errors.New("cancel requested")
+	// errCallerGone is the cause recorded when a command is stopped because
+	// every call waiting for it went away and none came back in time.
+	errCallerGone = errors.New("caller went away")
+)
+
+// execution is a command that is currently running.
+type execution struct {
+	digest []byte
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+	// detachable commands keep running for reattachWindow after the last
+	// call waiting for them goes away; others are stopped straight away.
+	detachable bool
+	// attached counts the calls waiting for the command, and orphaned is
+	// the timer that stops it once none is left.
+	attached int
+	orphaned *time.Timer
+}
+
+// completed is what a finished command sent back, kept for replay.
+type completed struct {
+	id     string
+	digest []byte
+	at     time.Time
+	size   int64
+	result *pb.CommandResult
+	chunks []*pb.OutputChunk
+}
+
+// running tracks commands by id so they can be cancelled from another call,
+// and remembers recently finished ones so they are not run twice. The zero
+// value is ready to use.
+type running struct {
+	mu         sync.Mutex
+	executions map[string]*execution
+	completed  map[string]*completed
+	order      []*completed
+	size       int64
+}
+
+// start registers id for the request whose RequestDigest is digest. If a
+// command with that id already finished, its record is returned instead and
+// nothing is registered; if one is still running, start waits for it to
+// finish first, so that a caller retrying after a dropped connection picks up
+// where it left off. Either way the digest must match, or a request reusing
+// the id of another is refused.
+//
+// Otherwise start returns a context that Cancel can stop and a function that
+// must be called with what the command sent back once it has exited. The
+// context is cancelled once ctx, and that of every call that came back for
+// the command since, is done: straight away, or if detachable after
+// reattachWindow, unless another call comes back for it in the meantime.
+// Requests without an id cannot be retried or cancelled, so they are not
+// registered and stop with ctx.
+func (r *running) start(ctx context.Context, id string, digest []byte, detachable bool) (context.Context, func(*pb.CommandResult, []*pb.OutputChunk), *completed, error) {
+	if id == "" {
+		ctx, cancel := context.WithCancelCause(ctx)
+		return ctx, func(*pb.CommandResult, []*pb.OutputChunk) { cancel(nil) }, nil, nil
+	}
+
+	r.mu.Lock()
+	r.expire(time.Now())
+	if c, ok := r.completed[id]; ok {
+		r.mu.Unlock()
+		if !bytes.Equal(c.digest, digest) {
+			return nil, nil, nil, errReused(id)
+		}
+		return nil, nil, c, nil
+	}
+	if e, ok := r.executions[id]; ok {
+		if !bytes.Equal(e.digest, digest) {
+			r.mu.Unlock()
+			return nil, nil, nil, errReused(id)
+		}
+		r.attach(e)
+		r.mu.Unlock()
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			r.detach(e)
+			return nil, nil, nil, status.FromContextError(ctx.Err()).Err()
+		}
+		r.mu.Lock()
+		c, ok := r.completed[id]
+		r.mu.Unlock()
+		if !ok {
+			return nil, nil, nil, status.Errorf(codes.DataLoss, "command %q finished, but its result is no longer kept", id)
+		}
+		return nil, nil, c, nil
+	}
+	defer r.mu.Unlock()
+	if r.executions == nil {
+		r.executions = map[string]*execution{}
+	}
+	runCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	e := &execution{digest: digest, cancel: cancel, done: make(chan struct{}), detachable: detachable, attached: 1}
+	r.executions[id] = e
+	stop := context.AfterFunc(ctx, func() { r.detach(e) })
+
+	return runCtx, func(result *pb.CommandResult, chunks []*pb.OutputChunk) {
+		stop()
+		r.mu.Lock()
+		delete(r.executions, id)
+		if e.orphaned != nil {
+			e.orphaned.Stop()
+		}
+		r.remember(id, digest, result, chunks)
+		r.mu.Unlock()
+		close(e.done)
+		cancel(nil)
+	}, nil, nil
+}
+
+// attach records that another call is waiting for e. r.mu must be held.
+func (r *running) attach(e *execution) {
+	e.attached++
+	if e.orphaned != nil {
+		e.orphaned.Stop()
+		e.orphaned = nil
+	}
+}
+
+// detach records that a call waiting for e went away. Once none is left, e is
+// stopped: straight away, or if it is detachable, after reattachWindow unless
+// another call comes back for it by then.
+func (r *running) detach(e *execution) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.attached--
+	if e.attached > 0 {
+		return
+	}
+	if !e.detachable {
+		e.cancel(errCallerGone)
+		return
+	}
+	e.orphaned = time.AfterFunc(reattachWindow, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if e.attached == 0 {
+			e.cancel(errCallerGone)
+		}
+	})
+}
+
+// detachable reports whether command may keep running for a while after the
+// calls waiting for it have gone: only if it has a timeout, so that nothing is
+// left running unattended for ever.
+func detachable(command *pb.CommandRequest) bool {
+	return command.GetTimeout().AsDuration() > 0
+}
+
+// errReused refuses a request that reuses the id of a different one.
+func errReused(id string) error {
+	return status.Errorf(codes.FailedPrecondition, "command %q was sent with a different request before; use a new id", id)
+}
+
+// cancel stops the command registered as id, along with any re-run of it
+// registered as id#N, and waits until they have exited or ctx is done.
+func (r *running) cancel(ctx context.Context, id string) (found, stopped bool) {
+	r.mu.Lock()
+	var matched []*execution
+	for key, e := range r.executions {
+		if key == id || strings.HasPrefix(key, id+"#") {
+			matched = append(matched, e)
+		}
+	}
+	r.mu.Unlock()
+	if len(matched) == 0 {
+		return false, false
+	}
+
+	for _, e := range matched {
+		e.cancel(errCancelRequested)
+	}
+	for _, e := range matched {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return true, false
+		}
+	}
+	return true, true
+}
+
+// remember keeps a finished command's record, evicting the oldest ones to
+// stay within bounds. r.mu must be held.
+func (r *running) remember(id string, digest []byte, result *pb.CommandResult, chunks []*pb.OutputChunk) {
+	c := &completed{id: id, digest: digest, at: time.Now(), result: result, chunks: chunks}
+	c.size = int64(proto.Size(result))
+	for _, chunk := range chunks {
+		c.size += int64(len(chunk.GetData()))
+	}
+	if c.size > completedMaxBytes {
+		return
+	}
+	if r.completed == nil {
+		r.completed = map[string]*completed{}
+	}
+	r.completed[id] = c
+	r.order = append(r.order, c)
+	r.size += c.size
+	for len(r.order) > completedMaxEntries || r.size > completedMaxBytes {
+		r.evictOldest()
+	}
+}
+
+// expire drops records older than completedTTL. r.mu must be held.
+func (r *running) expire(now time.Time) {
+	for len(r.order) > 0 && now.Sub(r.order[0].at) > completedTTL {
+		r.evictOldest()
+	}
+}
+
+func (r *running) evictOldest() {
+	c := r.order[0]
+	r.order = r.order[1:]
+	r.size -= c.size
+	delete(r.completed, c.id)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRunningStart(t *testing.T) {
+	digest, other := []byte("digest"), []byte("other")
+	result := &pb.CommandResult{Id: "a", ExitCode: 3}
+	tests := []struct {
+		name string
+		// finished, if set, has a first request for "a" finish before the
+		// second arrives.
+		finished bool
+		digest   []byte
+		wantCode codes.Code
+	}{
+		{"replayed once finished", true, digest, codes.OK},
+		{"reused once finished", true, other, codes.FailedPrecondition},
+		{"re-attached while running", false, digest, codes.OK},
+		{"reused while running", false, other, codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r running
+			ctx, finish, replay, err := r.start(context.Background(), "a", digest, true)
+			if err != nil || replay != nil {
+				t.Fatalf("first start() = %v, %v", replay, err)
+			}
+			if tt.finished {
+				finish(result, nil)
+			} else {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					finish(result, nil)
+				}()
+			}
+			_, _, replay, err = r.start(context.Background(), "a", tt.digest, true)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("second start() error = %v, want code %s", err, tt.wantCode)
+			}
+			if tt.wantCode == codes.OK && replay.result.GetExitCode() != 3 {
+				t.Errorf("second start() replayed %v, want %v", replay.result, result)
+			}
+			if !tt.finished {
+				<-ctx.Done()
+			}
+		})
+	}
+}
+
+func TestRunningDetach(t *testing.T) {
+	defer func(window time.Duration) { reattachWindow = window }(reattachWindow)
+	reattachWindow = 50 * time.Millisecond
+
+	tests := []struct {
+		name       string
+		detachable bool
+		// reattach has a retry come back for the command after its caller
+		// went away.
+		reattach  bool
+		wantCause error
+	}{
+		{"killed after the reattach window", true, false, errCallerGone},
+		{"kept for a retry", true, true, nil},
+		{"killed straight away without a timeout", false, false, errCallerGone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r running
+			caller, hangUp := context.WithCancel(context.Background())
+			ctx, finish, _, err := r.start(caller, "a", nil, tt.detachable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hangUp()
+			if tt.detachable {
+				time.Sleep(reattachWindow / 5)
+				if ctx.Err() != nil {
+					t.Fatal("the command stopped before the reattach window passed")
+				}
+			}
+			retried := make(chan error, 1)
+			if tt.reattach {
+				go func() {
+					_, _, _, err := r.start(context.Background(), "a", nil, tt.detachable)
+					retried <- err
+				}()
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(2 * reattachWindow):
+			}
+			if got := context.Cause(ctx); !errors.Is(got, tt.wantCause) {
+				t.Errorf("cause = %v, want %v", got, tt.wantCause)
+			}
+			finish(&pb.CommandResult{}, nil)
+			if tt.reattach {
+				if err := <-retried; err != nil {
+					t.Errorf("retry start() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunningRetryGivesUp(t *testing.T) {
+	var r running
+	ctx, finish, _, err := r.start(context.Background(), "a", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A retry waiting for it gives up with its own context, and the command
+	// keeps running for the caller still waiting.
+	retry, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := r.start(retry, "a", nil, false); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("waiting start() error = %v, want DeadlineExceeded", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("the command stopped when a retry gave up")
+	}
+	finish(&pb.CommandResult{}, nil)
+	if ctx.Err() == nil {
+		t.Error("context not released once finished")
+	}
+}
+
+func TestRunningWithoutID(t *testing.T) {
+	var r running
+	caller, hangUp := context.WithCancel(context.Background())
+	ctx, finish, _, err := r.start(caller, "", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.executions) != 0 {
+		t.Error("a request without an id was registered")
+	}
+	hangUp()
+	if ctx.Err() == nil {
+		t.Error("a request without an id outlived its caller")
+	}
+	finish(nil, nil)
+}
+
+func TestRunningCancel(t *testing.T) {
+	tests := []struct {
+		name        string
+		id          string
+		wantFound   bool
+		wantStopped []string
+	}{
+		{"the command and its re-runs", "a", true, []string{"a", "a#1", "a#2"}},
+		{"one re-run", "a#1", true, []string{"a#1"}},
+		{"a prefix only", "x", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r running
+			stopped := map[string]bool{}
+			done := make(chan string)
+			ids := []string{"a", "a#1", "a#2", "ab", "xy"}
+			finishes := map[string]func(*pb.CommandResult, []*pb.OutputChunk){}
+			for _, id := range ids {
+				ctx, finish, _, err := r.start(context.Background(), id, nil, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				finishes[id] = finish
+				go func() {
+					<-ctx.Done()
+					if errors.Is(context.Cause(ctx), errCancelRequested) {
+						finish(&pb.CommandResult{}, nil)
+						done <- id
+					}
+				}()
+			}
+
+			found, ok := r.cancel(context.Background(), tt.id)
+			if found != tt.wantFound || ok != tt.wantFound {
+				t.Errorf("cancel(%q) = %v, %v, want %v, %v", tt.id, found, ok, tt.wantFound, tt.wantFound)
+			}
+			for range tt.wantStopped {
+				stopped[<-done] = true
+			}
+			for _, id := range tt.wantStopped {
+				if !stopped[id] {
+					t.Errorf("%s was not stopped", id)
+				}
+				delete(finishes, id)
+			}
+			for id, finish := range finishes {
+				if _, running := r.executions[id]; !running {
+					t.Errorf("%s was stopped too", id)
+				}
+				finish(&pb.CommandResult{}, nil)
+			}
+		})
+	}
+}
+
+func TestRunningCancelTimesOut(t *testing.T) {
+	var r running
+	_, finish, _, err := r.start(context.Background(), "a", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer finish(&pb.CommandResult{}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if found, stopped := r.cancel(ctx, "a"); !found || stopped {
+		t.Errorf("cancel() = %v, %v, want true, false", found, stopped)
+	}
+}
+
+func TestRunningRemember(t *testing.T) {
+	big := make([]byte, completedMaxBytes/4)
+	tests := []struct {
+		name string
+		// sizes are the output sizes of the commands remembered, in order.
+		sizes   []int
+		age     time.Duration
+		wantIDs []string
+	}{
+		{"kept", []int{10, 20}, 0, []string{"0", "1"}},
+		{"expired", []int{10, 20}, completedTTL + time.Second, nil},
+		{"too large to keep", []int{completedMaxBytes + 1, 10}, 0, []string{"1"}},
+		{"largest output kept", []int{maxOutputBytesLimit}, 0, []string{"0"}},
+		{"oldest evicted for size", []int{len(big), len(big), len(big), len(big)}, 0, []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r running
+			for i, size := range tt.sizes {
+				id := string(rune('0' + i))
+				r.remember(id, nil, &pb.CommandResult{Id: id}, []*pb.OutputChunk{{Data: make([]byte, size)}})
+			}
+			r.expire(time.Now().Add(tt.age))
+			if len(r.completed) != len(tt.wantIDs) || len(r.order) != len(tt.wantIDs) {
+				t.Fatalf("kept %d records (%d in order), want %v", len(r.completed), len(r.order), tt.wantIDs)
+			}
+			var size int64
+			for i, id := range tt.wantIDs {
+				if r.order[i].id != id || r.completed[id] == nil {
+					t.Errorf("record %d is %q, want %q", i, r.order[i].id, id)
+				}
+				size += r.order[i].size
+			}
+			if r.size != size {
+				t.Errorf("size = %d, want %d", r.size, size)
+			}
+		})
+	}
+}
+
+func TestRunningRememberEntries(t *testing.T) {
+	var r running
+	for i := range completedMaxEntries + 1 {
+		r.remember(string(rune(i)), nil, &pb.CommandResult{}, nil)
+	}
+	if len(r.completed) != completedMaxEntries {
+		t.Errorf("kept %d records, want %d", len(r.completed), completedMaxEntries)
+	}
+	if _, ok := r.completed[string(rune(0))]; ok {
+		t.Error("oldest record was kept")
+	}
+}
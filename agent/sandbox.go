@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"golang.org/x/sys/unix"
+)
+
+// sandboxArg, as the first argument, makes the agent binary set up a
+// sandbox and exec a command in it instead of serving. The agent runs itself
+// this way, as Go cannot run code between fork and exec.
+const sandboxArg = "jarvis-sandbox"
+
+// sandboxStatusFd is the descriptor the sandbox helper reports a failure to
+// set up on. It is closed on exec, so reading it to EOF without data means
+// the command is running.
+const sandboxStatusFd = 3
+
+// ioprioWhoProcess and ioprioClassShift are from linux/ioprio.h.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// ioPriorityFor returns the IO priority limits ask for, as ioprio_set(2)
+// takes it, or zero to leave it alone. Like ionice, a best-effort priority
+// left unset follows the nice value.
+func ioPriorityFor(limits *pb.ResourceLimits) int {
+	class := limits.GetIoClass()
+	switch class {
+	case pb.IOClass_IO_CLASS_IDLE:
+		return int(class) << ioprioClassShift
+	case pb.IOClass_IO_CLASS_BEST_EFFORT:
+		level := (limits.GetNice() + 20) / 5
+		if limits.IoPriority != nil {
+			level = limits.GetIoPriority()
+		}
+		return int(class)<<ioprioClassShift | int(level)
+	}
+	return 0
+}
+
+// profile is what a sandbox takes away from a command.
+type profile struct {
+	// capabilities are those kept in the bounding set. Nil keeps them all.
+	capabilities []uintptr
+	// noNewPrivs stops setuid binaries and file capabilities from granting
+	// more than the command started with.
+	noNewPrivs bool
+	// seccomp installs the filter from seccompFilter.
+	seccomp bool
+	// newMounts and newNetwork run the command in namespaces of its own.
+	newMounts  bool
+	newNetwork bool
+}
+
+// diagnosticCapabilities let a command read any file and inspect processes
+// and the network, but change none of them. CAP_SYS_PTRACE is left out:
+// attaching to a process lets a command change it, and the seccomp filter
+// refuses ptrace(2) anyway. Without it, what /proc only shows to a tracer,
+// such as another user's open files or environment, stays hidden.
+var diagnosticCapabilities = []uintptr{
+	unix.CAP_DAC_READ_SEARCH,
+	unix.CAP_NET_RAW,
+	unix.CAP_SYSLOG,
+}
+
+var profiles = map[pb.Profile]profile{
+	pb.Profile_PROFILE_FULL: {},
+	pb.Profile_PROFILE_DIAGNOSTIC: {
+		capabilities: diagnosticCapabilities,
+		noNewPrivs:   true,
+		seccomp:      true,
+		newMounts:    true,
+	},
+	pb.Profile_PROFILE_NETWORK_ISOLATED: {
+		capabilities: diagnosticCapabilities,
+		noNewPrivs:   true,
+		seccomp:      true,
+		newMounts:    true,
+		newNetwork:   true,
+	},
+}
+
+// sandbox is where and how the sandbox helper runs a command.
+type sandbox struct {
+	// root is the host view to chroot into.
+	root    string
+	profile pb.Profile
+	// cgroup, if set, is the directory of the cgroup to run in.
+	cgroup string
+	// nice, if set, is the scheduling priority to run at.
+	nice *int32
+	// ioPriority, if not zero, is the IO priority to run at, as
+	// ioprio_set(2) takes it.
+	ioPriority int
+}
+
+// args returns s as the sandbox helper's arguments.
+func (s sandbox) args(command string) []string {
+	nice := ""
+	if s.nice != nil {
+		nice = strconv.Itoa(int(*s.nice))
+	}
+	return []string{sandboxArg, s.profile.String(), s.root, s.cgroup, nice, strconv.Itoa(s.ioPriority), command}
+}
+
+// parseSandbox reverses args, returning the sandbox and the command.
+func parseSandbox(args []string) (sandbox, string, error) {
+	if len(args) != 6 {
+		return sandbox{}, "", fmt.Errorf("want 6 arguments, got %d", len(args))
+	}
+	s := sandbox{profile: pb.Profile(pb.Profile_value[args[0]]), root: args[1], cgroup: args[2]}
+	if args[3] != "" {
+		nice, err := strconv.ParseInt(args[3], 10, 32)
+		if err != nil {
+			return sandbox{}, "", fmt.Errorf("nice: %w", err)
+		}
+		n := int32(nice)
+		s.nice = &n
+	}
+	ioPriority, err := strconv.Atoi(args[4])
+	if err != nil {
+		return sandbox{}, "", fmt.Errorf("IO priority: %w", err)
+	}
+	s.ioPriority = ioPriority
+	return s, args[5], nil
+}
+
+// sandboxCommand returns the command that runs command with sh in s. Start
+// it with startSandboxed.
+func sandboxCommand(s sandbox, command string) (*exec.Cmd, error) {
+	prof, ok := profiles[s.profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s", s.profile)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("os.Executable(): %w", err)
+	}
+	cmd := exec.Command(self, s.args(command)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if prof.newMounts {
+		cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWNS
+	}
+	if prof.newNetwork {
+		cmd.SysProcAttr.Cloneflags |= unix.CLONE_NEWNET
+	}
+	return cmd, nil
+}
+
+// startSandboxed starts cmd and waits until the sandbox is in place and the
+// command has been exec'd. If the sandbox could not be set up, cmd is
+// reaped and the helper's error returned.
+func startSandboxed(cmd *exec.Cmd) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	msg, _ := io.ReadAll(r)
+	if len(msg) > 0 {
+		_ = cmd.Wait()
+		return errors.New(string(msg))
+	}
+	return nil
+}
+
+// sandboxMain is the sandbox helper: it sets up the sandbox args describe
+// and execs sh -c with the command in it. It does not return.
+func sandboxMain(args []string) {
+	// Capabilities, no_new_privs and seccomp filters belong to a thread;
+	// set them on the one that execs.
+	runtime.LockOSThread()
+	status := os.NewFile(sandboxStatusFd, "status")
+	fail := func(err error) {
+		fmt.Fprintf(status, "setting up sandbox: %v", err)
+		os.Exit(127)
+	}
+	unix.CloseOnExec(sandboxStatusFd)
+	s, command, err := parseSandbox(args)
+	if err != nil {
+		fail(err)
+	}
+	prof, ok := profiles[s.profile]
+	if !ok {
+		fail(fmt.Errorf("unknown profile %s", s.profile))
+	}
+
+	// Open the cgroup now, while it can be reached, but only join it just
+	// before exec, so that the command's limits are not spent on the
+	// helper.
+	var procs *os.File
+	if s.cgroup != "" {
+		if err := enterNamespace(hostCgroupNamespace, unix.CLONE_NEWCGROUP); err != nil {
+			fail(fmt.Errorf("entering the host's cgroup namespace: %w", err))
+		}
+		if procs, err = os.OpenFile(filepath.Join(s.cgroup, "cgroup.procs"), os.O_WRONLY, 0); err != nil {
+			fail(err)
+		}
+	}
+
+	if prof.newMounts {
+		// Keep mounts made in the sandbox from reaching the agent or the
+		// host.
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			fail(fmt.Errorf("making mounts private: %w", err))
+		}
+	}
+	if prof.newNetwork {
+		if err := loopbackUp(); err != nil {
+			fail(fmt.Errorf("bringing up lo: %w", err))
+		}
+	}
+	if s.nice != nil {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, 0, int(*s.nice)); err != nil {
+			fail(fmt.Errorf("setting nice %d: %w", *s.nice, err))
+		}
+	}
+	if s.ioPriority != 0 {
+		if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, 0, uintptr(s.ioPriority)); errno != 0 {
+			fail(fmt.Errorf("setting IO priority: %w", errno))
+		}
+	}
+	if err := unix.Chroot(s.root); err != nil {
+		fail(fmt.Errorf("chroot %s: %w", s.root, err))
+	}
+	if err := unix.Chdir("/"); err != nil {
+		fail(err)
+	}
+	if prof.capabilities != nil {
+		if err := limitCapabilities(prof.capabilities); err != nil {
+			fail(err)
+		}
+	}
+	if prof.noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			fail(fmt.Errorf("setting no_new_privs: %w", err))
+		}
+	}
+	if prof.seccomp {
+		if err := installSeccomp(); err != nil {
+			fail(err)
+		}
+	}
+	if procs != nil {
+		if err := joinCgroup(procs); err != nil {
+			fail(err)
+		}
+	}
+	err = unix.Exec("/bin/sh", []string{"sh", "-c", command}, os.Environ())
+	fail(fmt.Errorf("exec /bin/sh: %w", err))
+}
+
+// enterNamespace moves the calling thread into the namespace of type
+// nstype that path refers to.
+func enterNamespace(path string, nstype int) error {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	return unix.Setns(fd, nstype)
+}
+
+// limitCapabilities drops every capability but keep from the bounding set,
+// and from the sets of the calling thread, so that neither it nor what it
+// runs can get them back.
+func limitCapabilities(keep []uintptr) error {
+	var mask [2]uint32
+	for _, c := range keep {
+		mask[c/32] |= 1 << (c % 32)
+	}
+	for c := uintptr(0); c <= unix.CAP_LAST_CAP; c++ {
+		if mask[c/32]&(1<<(c%32)) != 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, c, 0, 0, 0); err != nil {
+			if errors.Is(err, unix.EINVAL) {
+				// The kernel does not know this capability.
+				break
+			}
+			return fmt.Errorf("dropping capability %d: %w", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("clearing ambient capabilities: %w", err)
+	}
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return fmt.Errorf("capget: %w", err)
+	}
+	for i := range data {
+		data[i].Effective &= mask[i]
+		data[i].Permitted &= mask[i]
+		data[i].Inheritable &= mask[i]
+	}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("capset: %w", err)
+	}
+	return nil
+}
+
+// loopbackUp brings up lo, the only interface in a new network namespace.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"golang.org/x/sys/unix"
+)
+
+func TestSandboxArgs(t *testing.T) {
+	niceLow, niceZero := int32(-5), int32(0)
+	tests := []struct {
+		name    string
+		sandbox sandbox
+		command string
+	}{
+		{"full", sandbox{profile: pb.Profile_PROFILE_FULL, root: "/host"}, "uptime"},
+		{"diagnostic", sandbox{profile: pb.Profile_PROFILE_DIAGNOSTIC, root: "/host", cgroup: "/host-cgroup/jarvis.slice/run-1.scope"}, "df -h"},
+		{"nice and IO priority", sandbox{profile: pb.Profile_PROFILE_NETWORK_ISOLATED, root: "/host-rw", nice: &niceLow, ioPriority: 2<<ioprioClassShift | 4}, "ping -c1 localhost"},
+		{"zero nice", sandbox{profile: pb.Profile_PROFILE_FULL, root: "/host", nice: &niceZero}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.sandbox.args(tt.command)
+			if args[0] != sandboxArg {
+				t.Fatalf("args()[0] = %q, want %q", args[0], sandboxArg)
+			}
+			got, command, err := parseSandbox(args[1:])
+			if err != nil {
+				t.Fatalf("parseSandbox() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.sandbox) || command != tt.command {
+				t.Errorf("parseSandbox(args()) = %+v, %q, want %+v, %q", got, command, tt.sandbox, tt.command)
+			}
+		})
+	}
+}
+
+func TestParseSandboxErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"too few", []string{"PROFILE_FULL", "/host", "", "", "0"}},
+		{"too many", []string{"PROFILE_FULL", "/host", "", "", "0", "uptime", "extra"}},
+		{"bad nice", []string{"PROFILE_FULL", "/host", "", "high", "0", "uptime"}},
+		{"bad IO priority", []string{"PROFILE_FULL", "/host", "", "", "", "uptime"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseSandbox(tt.args); err == nil {
+				t.Errorf("parseSandbox(%q) succeeded, want an error", tt.args)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	for _, p := range []pb.Profile{pb.Profile_PROFILE_DIAGNOSTIC, pb.Profile_PROFILE_NETWORK_ISOLATED} {
+		prof := profiles[p]
+		if !prof.noNewPrivs || !prof.seccomp || prof.capabilities == nil {
+			t.Errorf("%s: %+v does not sandbox", p, prof)
+		}
+		// The seccomp filter refuses ptrace, so the capability would only
+		// be a way around it.
+		if slices.Contains(prof.capabilities, unix.CAP_SYS_PTRACE) {
+			t.Errorf("%s keeps CAP_SYS_PTRACE", p)
+		}
+	}
+	if !profiles[pb.Profile_PROFILE_NETWORK_ISOLATED].newNetwork {
+		t.Error("PROFILE_NETWORK_ISOLATED has a network")
+	}
+}
+
+func TestIOPriorityFor(t *testing.T) {
+	nice, level := int32(10), int32(1)
+	tests := []struct {
+		name   string
+		limits *pb.ResourceLimits
+		want   int
+	}{
+		{"unset", nil, 0},
+		{"no class", &pb.ResourceLimits{Nice: &nice}, 0},
+		{"idle", &pb.ResourceLimits{IoClass: pb.IOClass_IO_CLASS_IDLE, IoPriority: &level}, 3 << ioprioClassShift},
+		{"best effort at a level", &pb.ResourceLimits{IoClass: pb.IOClass_IO_CLASS_BEST_EFFORT, IoPriority: &level}, 2<<ioprioClassShift | 1},
+		{"best effort following nice", &pb.ResourceLimits{IoClass: pb.IOClass_IO_CLASS_BEST_EFFORT, Nice: &nice}, 2<<ioprioClassShift | 6},
+		{"best effort at nice 0", &pb.ResourceLimits{IoClass: pb.IOClass_IO_CLASS_BEST_EFFORT}, 2<<ioprioClassShift | 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ioPriorityFor(tt.limits); got != tt.want {
+				t.Errorf("ioPriorityFor() = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
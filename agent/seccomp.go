@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// deniedSyscalls fail with EPERM under the seccomp filter. They change the
+// kernel, the machine or the sandbox itself rather than look at anything.
+// Each architecture adds its own in archDeniedSyscalls.
+var deniedSyscalls = []uint32{
+	// Mounts and namespaces.
+	unix.SYS_MOUNT, unix.SYS_UMOUNT2, unix.SYS_PIVOT_ROOT, unix.SYS_CHROOT,
+	unix.SYS_UNSHARE, unix.SYS_SETNS,
+	unix.SYS_FSOPEN, unix.SYS_FSCONFIG, unix.SYS_FSMOUNT, unix.SYS_FSPICK,
+	unix.SYS_MOVE_MOUNT, unix.SYS_OPEN_TREE, unix.SYS_MOUNT_SETATTR,
+	// The kernel and its modules.
+	unix.SYS_KEXEC_LOAD, unix.SYS_KEXEC_FILE_LOAD,
+	unix.SYS_INIT_MODULE, unix.SYS_FINIT_MODULE, unix.SYS_DELETE_MODULE,
+	unix.SYS_BPF, unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_ADD_KEY, unix.SYS_REQUEST_KEY, unix.SYS_KEYCTL,
+	// The machine.
+	unix.SYS_REBOOT, unix.SYS_SWAPON, unix.SYS_SWAPOFF, unix.SYS_ACCT,
+	unix.SYS_QUOTACTL, unix.SYS_NFSSERVCTL, unix.SYS_VHANGUP,
+	unix.SYS_SETTIMEOFDAY, unix.SYS_CLOCK_SETTIME, unix.SYS_CLOCK_ADJTIME,
+	unix.SYS_ADJTIMEX, unix.SYS_SETHOSTNAME, unix.SYS_SETDOMAINNAME,
+	// Other processes, and ways around the filter.
+	unix.SYS_PTRACE, unix.SYS_PROCESS_VM_WRITEV, unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_USERFAULTFD, unix.SYS_LOOKUP_DCOOKIE,
+	unix.SYS_IO_URING_SETUP, unix.SYS_IO_URING_ENTER, unix.SYS_IO_URING_REGISTER,
+}
+
+// namespaceCloneFlags are the clone flags that would create namespaces,
+// which unshare is denied for.
+const namespaceCloneFlags = unix.CLONE_NEWNS | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC |
+	unix.CLONE_NEWUSER | unix.CLONE_NEWPID | unix.CLONE_NEWNET | unix.CLONE_NEWCGROUP
+
+// Offsets into struct seccomp_data. Both supported architectures are
+// little-endian, so the low half of an argument comes first.
+const (
+	seccompDataNr    = 0
+	seccompDataArch  = 4
+	seccompDataArgs0 = 16
+)
+
+// seccompFilter builds the filter: a syscall from another architecture
+// kills the process, clone with namespace flags and the deniedSyscalls fail
+// with EPERM, clone3, whose flags the filter cannot read, fails with ENOSYS
+// so that callers fall back to clone, and the rest are allowed.
+func seccompFilter() ([]unix.SockFilter, error) {
+	if seccompArch == 0 {
+		return nil, errors.New("seccomp is not supported on this architecture")
+	}
+	load := func(offset uint32) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offset}
+	}
+	ret := func(action uint32) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: action}
+	}
+	// jump skips the next instruction unless the accumulator matches.
+	jump := func(op uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, K: k, Jt: 0, Jf: 1}
+	}
+	eperm := ret(unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM))
+
+	filter := []unix.SockFilter{
+		load(seccompDataArch),
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: seccompArch, Jt: 1, Jf: 0},
+		ret(unix.SECCOMP_RET_KILL_PROCESS),
+		load(seccompDataNr),
+	}
+	if syscallABIMask != 0 {
+		filter = append(filter, jump(unix.BPF_JSET, syscallABIMask), eperm)
+	}
+	filter = append(filter,
+		jump(unix.BPF_JEQ, unix.SYS_CLONE3), ret(unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+		// clone's flags are its first argument on every supported
+		// architecture.
+		unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: unix.SYS_CLONE, Jt: 0, Jf: 3},
+		load(seccompDataArgs0),
+		jump(unix.BPF_JSET, namespaceCloneFlags), eperm,
+	)
+	// The clone check may have left its flags in the accumulator.
+	filter = append(filter, load(seccompDataNr))
+	for _, nr := range append(deniedSyscalls, archDeniedSyscalls...) {
+		filter = append(filter, jump(unix.BPF_JEQ, nr), eperm)
+	}
+	filter = append(filter, ret(unix.SECCOMP_RET_ALLOW))
+	if len(filter) > unix.BPF_MAXINSNS {
+		return nil, fmt.Errorf("seccomp filter has %d instructions, more than %d", len(filter), unix.BPF_MAXINSNS)
+	}
+	return filter, nil
+}
+
+// installSeccomp installs the filter on the calling thread, which must have
+// no_new_privs set or CAP_SYS_ADMIN.
+func installSeccomp() error {
+	filter, err := seccompFilter()
+	if err != nil {
+		return err
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("installing seccomp filter: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// seccompArch is the architecture the seccomp filter admits syscalls from.
+const seccompArch = unix.AUDIT_ARCH_X86_64
+
+// syscallABIMask marks syscalls made through the x32 ABI, which the filter
+// refuses rather than list every syscall under a second number.
+const syscallABIMask = 0x40000000
+
+// archDeniedSyscalls are denied on top of deniedSyscalls.
+var archDeniedSyscalls = []uint32{
+	unix.SYS_IOPL, unix.SYS_IOPERM, unix.SYS_USELIB, unix.SYS__SYSCTL, unix.SYS_CREATE_MODULE,
+}
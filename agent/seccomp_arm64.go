@@ -0,0 +1,12 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// seccompArch is the architecture the seccomp filter admits syscalls from.
+const seccompArch = unix.AUDIT_ARCH_AARCH64
+
+// syscallABIMask is zero: arm64 has a single syscall ABI.
+const syscallABIMask = 0
+
+// archDeniedSyscalls are denied on top of deniedSyscalls.
+var archDeniedSyscalls []uint32
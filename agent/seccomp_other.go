@@ -0,0 +1,11 @@
+//go:build !amd64 && !arm64
+
+package main
+
+// seccompArch is zero where the seccomp filter has not been written for the
+// architecture; profiles that need it fail to start.
+const seccompArch = 0
+
+const syscallABIMask = 0
+
+var archDeniedSyscalls []uint32
@@ -0,0 +1,101 @@
+//go:build amd64 || arm64
+
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// runFilter runs filter on a syscall the way the kernel would, and returns
+// the action it takes.
+func runFilter(t *testing.T, filter []unix.SockFilter, arch, nr uint32, arg0 uint64) uint32 {
+	t.Helper()
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[seccompDataNr:], nr)
+	binary.LittleEndian.PutUint32(data[seccompDataArch:], arch)
+	binary.LittleEndian.PutUint64(data[seccompDataArgs0:], arg0)
+
+	var acc uint32
+	branch := func(ins unix.SockFilter, taken bool) int {
+		if taken {
+			return int(ins.Jt)
+		}
+		return int(ins.Jf)
+	}
+	for pc := 0; pc < len(filter); pc++ {
+		ins := filter[pc]
+		switch ins.Code {
+		case unix.BPF_LD | unix.BPF_W | unix.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[ins.K:])
+		case unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K:
+			pc += branch(ins, acc == ins.K)
+		case unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K:
+			pc += branch(ins, acc&ins.K != 0)
+		case unix.BPF_RET | unix.BPF_K:
+			return ins.K
+		default:
+			t.Fatalf("instruction %d: unexpected code %#x", pc, ins.Code)
+		}
+	}
+	t.Fatal("filter ran off its end")
+	return 0
+}
+
+func TestSeccompFilter(t *testing.T) {
+	filter, err := seccompFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pc, ins := range filter {
+		if ins.Code&0x07 == unix.BPF_JMP && (pc+1+int(ins.Jt) >= len(filter) || pc+1+int(ins.Jf) >= len(filter)) {
+			t.Fatalf("instruction %d jumps past the end of the filter", pc)
+		}
+	}
+
+	const (
+		allow  = unix.SECCOMP_RET_ALLOW
+		kill   = unix.SECCOMP_RET_KILL_PROCESS
+		eperm  = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+		enosys = unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)
+	)
+	type syscallTest struct {
+		name string
+		arch uint32
+		nr   uint32
+		arg0 uint64
+		want uint32
+	}
+	tests := []syscallTest{
+		{"read", seccompArch, unix.SYS_READ, 0, allow},
+		{"openat", seccompArch, unix.SYS_OPENAT, 0, allow},
+		{"other architecture", seccompArch ^ 1, unix.SYS_READ, 0, kill},
+		{"mount", seccompArch, unix.SYS_MOUNT, 0, eperm},
+		{"ptrace", seccompArch, unix.SYS_PTRACE, 0, eperm},
+		{"reboot", seccompArch, unix.SYS_REBOOT, 0, eperm},
+		{"last denied", seccompArch, deniedSyscalls[len(deniedSyscalls)-1], 0, eperm},
+		{"clone3", seccompArch, unix.SYS_CLONE3, 0, enosys},
+		{"clone for a thread", seccompArch, unix.SYS_CLONE, unix.CLONE_VM | unix.CLONE_THREAD, allow},
+		{"clone into a namespace", seccompArch, unix.SYS_CLONE, unix.CLONE_NEWNS, eperm},
+		{"clone into a user namespace", seccompArch, unix.SYS_CLONE, unix.CLONE_NEWUSER | unix.CLONE_VM, eperm},
+		// The accumulator must be reloaded after the clone check, or a
+		// clone flag value equal to a denied number would be confused with
+		// it.
+		{"clone with flags equal to a denied number", seccompArch, unix.SYS_CLONE, uint64(unix.SYS_MOUNT), allow},
+	}
+	for _, nr := range archDeniedSyscalls {
+		tests = append(tests, syscallTest{"architecture's own", seccompArch, nr, 0, eperm})
+	}
+	if syscallABIMask != 0 {
+		tests = append(tests, syscallTest{"other ABI", seccompArch, syscallABIMask | unix.SYS_READ, 0, eperm})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runFilter(t, filter, tt.arch, tt.nr, tt.arg0); got != tt.want {
+				t.Errorf("syscall %d arch %#x arg0 %#x: action %#x, want %#x", tt.nr, tt.arch, tt.arg0, got, tt.want)
+			}
+		})
+	}
+}
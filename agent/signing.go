@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// signingKeysConfigMap is the ConfigMap the controller publishes the
+	// public keys it signs requests with in, one per key ID.
+	signingKeysConfigMap = "jarvis-signing-keys"
+	// maxSignatureLifetime is the furthest ahead a signature may expire. It
+	// bounds how long nonces have to be remembered.
+	maxSignatureLifetime = 10 * time.Minute
+	// signatureClockSkew is how far the controller's clock may be ahead of
+	// the node's before its signatures are refused as expired.
+	signatureClockSkew = 30 * time.Second
+	// minNonceBytes is the shortest nonce accepted; shorter ones could
+	// repeat by chance.
+	minNonceBytes = 16
+)
+
+// verifier admits a request only if the controller signed it, for this
+// node, and it has not been seen before or expired.
+//
+// Nonces are only remembered in memory. So that a request seen before a
+// restart cannot be replayed after it, requests signed before the verifier
+// started are refused too. That leaves a request signed within the clock
+// skew between controller and node before the restart, when the controller's
+// clock is ahead, open to replay.
+type verifier struct {
+	node   string
+	logger *slog.Logger
+	// started is when the agent started; requests issued before it may have
+	// been seen already.
+	started time.Time
+
+	keys atomic.Pointer[map[string]ed25519.PublicKey]
+
+	mu sync.Mutex
+	// nonces holds the nonces of requests admitted, until they expire.
+	nonces map[string]time.Time
+}
+
+// verify checks the signature on req, and logs where it came from.
+func (v *verifier) verify(ctx context.Context, req *pb.CommandRequest) error {
+	sig := req.GetSignature()
+	if sig == nil {
+		v.logger.Info("Refused unsigned request", "id", req.GetId())
+		return status.Error(codes.Unauthenticated, "request is not signed")
+	}
+	var key ed25519.PublicKey
+	if keys := v.keys.Load(); keys != nil {
+		key = (*keys)[sig.GetKeyID()]
+	}
+	if key == nil {
+		v.logger.Info("Refused request signed with an unknown key", "id", req.GetId(), "keyID", sig.GetKeyID())
+		return status.Errorf(codes.Unauthenticated, "request is signed with unknown key %q", sig.GetKeyID())
+	}
+	if !ed25519.Verify(key, pb.SigningPayload(req), sig.GetSignature()) {
+		v.logger.Info("Refused request with a bad signature", "id", req.GetId(), "keyID", sig.GetKeyID())
+		return status.Error(codes.Unauthenticated, "request signature is invalid")
+	}
+	if sig.GetNode() != v.node {
+		v.logger.Info("Refused request signed for another node", "id", req.GetId(), "node", sig.GetNode())
+		return status.Errorf(codes.PermissionDenied, "request is signed for node %s, not %s", sig.GetNode(), v.node)
+	}
+	now := time.Now()
+	expires := sig.GetExpiresAt().AsTime()
+	switch {
+	case !now.Before(expires.Add(signatureClockSkew)):
+		v.logger.Info("Refused expired request", "id", req.GetId(), "expiresAt", expires)
+		return status.Errorf(codes.Unauthenticated, "request expired at %s", expires.Format(time.RFC3339))
+	case expires.After(now.Add(maxSignatureLifetime + signatureClockSkew)):
+		v.logger.Info("Refused request valid for too long", "id", req.GetId(), "expiresAt", expires)
+		return status.Errorf(codes.Unauthenticated, "request is valid until %s, more than %s ahead", expires.Format(time.RFC3339), maxSignatureLifetime)
+	}
+	issued := sig.GetIssuedAt().AsTime()
+	switch {
+	case sig.GetIssuedAt() == nil:
+		v.logger.Info("Refused request without an issue time", "id", req.GetId())
+		return status.Error(codes.Unauthenticated, "request has no issue time")
+	case issued.After(now.Add(signatureClockSkew)):
+		v.logger.Info("Refused request issued in the future", "id", req.GetId(), "issuedAt", issued)
+		return status.Errorf(codes.Unauthenticated, "request is issued at %s, in the future", issued.Format(time.RFC3339))
+	case issued.Before(v.started):
+		// It may have been seen before the restart. A request signed
+		// afresh gets through, so let the controller retry.
+		v.logger.Info("Refused request issued before the agent started", "id", req.GetId(), "issuedAt", issued, "started", v.started)
+		return status.Errorf(codes.Unavailable, "request was issued at %s, before the agent started at %s; sign it again", issued.Format(time.RFC3339), v.started.Format(time.RFC3339))
+	}
+	if len(sig.GetNonce()) < minNonceBytes {
+		return status.Errorf(codes.Unauthenticated, "request nonce is shorter than %d bytes", minNonceBytes)
+	}
+	nonce := hex.EncodeToString(sig.GetNonce())
+	if !v.remember(nonce, expires.Add(signatureClockSkew), now) {
+		v.logger.Info("Refused replayed request", "id", req.GetId(), "nonce", nonce)
+		return status.Error(codes.Unauthenticated, "request has been replayed")
+	}
+
+	c, _ := callerFrom(ctx)
+	v.logger.Info("Verified request", "id", req.GetId(), "cmd", req.GetCmd(), "privilege", req.GetPrivilege(), "profile", req.GetProfile(), "commandUID", sig.GetCommandUID(),
+		"node", sig.GetNode(), "keyID", sig.GetKeyID(), "nonce", nonce, "expiresAt", expires, "caller", c.User)
+	return nil
+}
+
+// remember records nonce until expires, and reports whether it was new.
+func (v *verifier) remember(nonce string, expires, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, seen := v.nonces[nonce]; seen {
+		return false
+	}
+	if v.nonces == nil {
+		v.nonces = map[string]time.Time{}
+	}
+	for n, until := range v.nonces {
+		if now.After(until) {
+			delete(v.nonces, n)
+		}
+	}
+	v.nonces[nonce] = expires
+	return true
+}
+
+// load replaces the keys signatures are checked against with the PEM-encoded
+// public keys in data, keyed by their IDs. Entries that are not Ed25519
+// public keys are skipped.
+func (v *verifier) load(data map[string]string) {
+	keys := map[string]ed25519.PublicKey{}
+	for id, keyPEM := range data {
+		key, err := parsePublicKey([]byte(keyPEM))
+		if err != nil {
+			v.logger.Error("Ignoring signing key", "keyID", id, "error", err)
+			continue
+		}
+		keys[id] = key
+	}
+	v.keys.Store(&keys)
+}
+
+// parsePublicKey parses a PEM-encoded Ed25519 public key.
+func parsePublicKey(keyPEM []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PUBLIC KEY block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("x509.ParsePKIXPublicKey(): %w", err)
+	}
+	ed, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%T is not an Ed25519 key", key)
+	}
+	return ed, nil
+}
+
+// watchKeys keeps the keys in step with the ConfigMap the controller
+// publishes them in, until ctx is done.
+func (v *verifier) watchKeys(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", signingKeysConfigMap).String()
+		}),
+	)
+	update := func(obj any) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		v.load(cm.Data)
+		v.logger.Info("Loaded signing keys", "configMap", signingKeysConfigMap, "keys", len(cm.Data), "resourceVersion", cm.ResourceVersion)
+	}
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(any) {
+			v.load(nil)
+			v.logger.Info("Signing keys deleted; refusing all requests", "configMap", signingKeysConfigMap)
+		},
+	}); err != nil {
+		return err
+	}
+	v.logger.Info("Waiting for signing keys", "namespace", namespace, "configMap", signingKeysConfigMap)
+	factory.Start(ctx.Done())
+	return nil
+}
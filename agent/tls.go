@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// controllerName is the common name of the client certificate the
+	// controller is issued in Managed mode. Only it may call the agent.
+	controllerName = "jarvis-controller"
+	// agentSignerName is the signer the agent asks for its certificate from.
+	// The controller signs only requests made by the agent on the node the
+	// certificate is for.
+	agentSignerName = "jarvis.io/agent"
+	// caBundleConfigMap is the ConfigMap the controller publishes the CAs
+	// callers' certificates are checked against in, as ca.crt.
+	caBundleConfigMap = "jarvis-ca-bundle"
+	// certRequestTimeout is how long a certificate request is waited on
+	// before a new one is made, and certRetryInterval how long after a
+	// failed one.
+	certRequestTimeout = 5 * time.Minute
+	certRetryInterval  = 30 * time.Second
+	// certPollInterval is how often certificate files are checked for
+	// changes.
+	certPollInterval = 30 * time.Second
+)
+
+// identity is the certificate the agent serves with and the CAs whose
+// certificates it accepts from callers.
+type identity struct {
+	cert      tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// certStore holds the agent's current identity. New connections use whatever
+// it holds at the time, so certificates are rotated without a restart.
+type certStore struct {
+	// clientName, if set, is the common name callers' certificates must
+	// carry.
+	clientName string
+
+	current atomic.Pointer[identity]
+
+	// mu guards the parts the identity is assembled from in Managed mode,
+	// which arrive separately.
+	mu                     sync.Mutex
+	certPEM, keyPEM, caPEM []byte
+}
+
+// load replaces the identity with the key pair in certPEM and keyPEM. If
+// caPEM is not empty, callers must present a certificate signed by one of the
+// CAs in it.
+func (s *certStore) load(certPEM, keyPEM, caPEM []byte) error {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("tls.X509KeyPair(): %w", err)
+	}
+	id := &identity{cert: cert}
+	if len(caPEM) > 0 {
+		id.clientCAs = x509.NewCertPool()
+		if !id.clientCAs.AppendCertsFromPEM(caPEM) {
+			return errors.New("client CA bundle holds no valid certificates")
+		}
+	}
+	s.current.Store(id)
+	return nil
+}
+
+// serverConfig is the TLS configuration to serve with. Handshakes fail until
+// an identity has been loaded.
+func (s *certStore) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			id := s.current.Load()
+			if id == nil {
+				return nil, errors.New("no certificate loaded yet")
+			}
+			config := &tls.Config{
+				Certificates: []tls.Certificate{id.cert},
+				MinVersion:   tls.VersionTLS12,
+			}
+			if id.clientCAs != nil {
+				config.ClientCAs = id.clientCAs
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				if s.clientName != "" {
+					config.VerifyPeerCertificate = s.verifyClientName
+				}
+			}
+			return config, nil
+		},
+	}
+}
+
+// verifyClientName accepts only the caller named clientName. It runs after
+// the chain has been verified.
+func (s *certStore) verifyClientName(_ [][]byte, chains [][]*x509.Certificate) error {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return errors.New("no verified client certificate")
+	}
+	if name := chains[0][0].Subject.CommonName; name != s.clientName {
+		return fmt.Errorf("client %q is not allowed, only %q", name, s.clientName)
+	}
+	return nil
+}
+
+// watchFiles loads the identity from certFile, keyFile and clientCAFile, then
+// reloads it whenever one of them changes until ctx is done.
+func (s *certStore) watchFiles(ctx context.Context, logger *slog.Logger, certFile, keyFile, clientCAFile string) error {
+	files := []string{certFile, keyFile}
+	if clientCAFile != "" {
+		files = append(files, clientCAFile)
+	}
+	read := func() error {
+		var contents [3][]byte
+		for i, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			contents[i] = data
+		}
+		return s.load(contents[0], contents[1], contents[2])
+	}
+	modified := func() time.Time {
+		var latest time.Time
+		for _, file := range files {
+			if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+		}
+		return latest
+	}
+
+	loaded := modified()
+	if err := read(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(certPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if latest := modified(); latest.After(loaded) {
+				if err := read(); err != nil {
+					// Keep serving the last good certificate.
+					logger.Error("Failed to reload TLS certificate", "error", err)
+					continue
+				}
+				loaded = latest
+				logger.Info("Reloaded TLS certificate", "file", certFile)
+			}
+		}
+	}()
+	return nil
+}
+
+// setParts replaces whichever of the key pair and client CAs are given, and
+// loads the identity once all of them are there.
+func (s *certStore) setParts(certPEM, keyPEM, caPEM []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if certPEM != nil {
+		s.certPEM, s.keyPEM = certPEM, keyPEM
+	}
+	if caPEM != nil {
+		s.caPEM = caPEM
+	}
+	if s.certPEM == nil || s.caPEM == nil {
+		return nil
+	}
+	return s.load(s.certPEM, s.keyPEM, s.caPEM)
+}
+
+// watchManaged keeps the identity issued by the controller's CA until ctx is
+// done: it asks for a certificate for node with a CertificateSigningRequest,
+// asks again once two thirds of its lifetime have passed, and follows the
+// CAs published in namespace. The private key never leaves the agent.
+func (s *certStore) watchManaged(ctx context.Context, logger *slog.Logger, clientset kubernetes.Interface, namespace, node string) error {
+	if err := s.watchCABundle(ctx, logger, clientset, namespace); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			renewAt, err := s.requestCertificate(ctx, logger, clientset, node)
+			delay := time.Until(renewAt)
+			if err != nil {
+				// Keep serving the last good certificate, if any.
+				logger.Error("Failed to obtain certificate", "node", node, "error", err)
+				delay = certRetryInterval
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+		}
+	}()
+	return nil
+}
+
+// requestCertificate has a new key pair's certificate signed and loads it. It
+// returns when the certificate is due for renewal.
+func (s *certStore) requestCertificate(ctx context.Context, logger *slog.Logger, clientset kubernetes.Interface, node string) (time.Time, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return time.Time{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	request, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: node},
+		DNSNames: []string{node},
+	}, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	csrs := clientset.CertificatesV1().CertificateSigningRequests()
+	csr, err := csrs.Create(ctx, &certificatesv1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: "jarvis-agent-" + node + "-"},
+		Spec: certificatesv1.CertificateSigningRequestSpec{
+			Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request}),
+			SignerName: agentSignerName,
+			Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("creating CertificateSigningRequest: %w", err)
+	}
+	logger.Info("Waiting for certificate", "csr", csr.Name)
+
+	var certPEM []byte
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, certRequestTimeout, true, func(ctx context.Context) (bool, error) {
+		csr, err := csrs.Get(ctx, csr.Name, metav1.GetOptions{})
+		if err != nil {
+			// Keep waiting through API server hiccups.
+			return false, nil
+		}
+		for _, c := range csr.Status.Conditions {
+			if c.Type == certificatesv1.CertificateDenied || c.Type == certificatesv1.CertificateFailed {
+				return false, fmt.Errorf("CertificateSigningRequest %s %s: %s", csr.Name, c.Type, c.Message)
+			}
+		}
+		certPEM = csr.Status.Certificate
+		return len(certPEM) > 0, nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, errors.New("issued certificate is not PEM")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := s.setParts(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil); err != nil {
+		return time.Time{}, err
+	}
+	logger.Info("Loaded certificate", "csr", csr.Name, "expires", leaf.NotAfter)
+	return leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) * 2 / 3), nil
+}
+
+// watchCABundle keeps the client CAs in step with the ConfigMap the
+// controller publishes them in, until ctx is done.
+func (s *certStore) watchCABundle(ctx context.Context, logger *slog.Logger, clientset kubernetes.Interface, namespace string) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", caBundleConfigMap).String()
+		}),
+	)
+	update := func(obj any) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok {
+			return
+		}
+		if cm.Data["ca.crt"] == "" {
+			logger.Error("ConfigMap has no ca.crt; refusing to serve without checking callers", "configMap", caBundleConfigMap)
+			return
+		}
+		if err := s.setParts(nil, nil, []byte(cm.Data["ca.crt"])); err != nil {
+			logger.Error("Failed to load client CAs", "configMap", caBundleConfigMap, "error", err)
+			return
+		}
+		logger.Info("Loaded client CAs", "configMap", caBundleConfigMap, "resourceVersion", cm.ResourceVersion)
+	}
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		// A deleted ConfigMap is republished by the controller; until then
+		// the CAs already loaded stay in use.
+	}); err != nil {
+		return err
+	}
+	factory.Start(ctx.Done())
+	return nil
+}
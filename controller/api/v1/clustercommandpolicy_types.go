@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterCommandPolicySpec sets the limits of a CommandPolicy for every
+// namespace it selects.
+type ClusterCommandPolicySpec struct {
+	// NamespaceSelector picks the namespaces the policy applies to. Omit to
+	// apply it to every namespace.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	CommandPolicySpec `json:",inline"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterCommandPolicy is the Schema for the clustercommandpolicies API. It
+// applies to the Commands in every namespace it selects.
+type ClusterCommandPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the limits the policy sets and where
+	// +required
+	Spec ClusterCommandPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterCommandPolicyList contains a list of ClusterCommandPolicy
+type ClusterCommandPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCommandPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterCommandPolicy{}, &ClusterCommandPolicyList{})
+}
@@ -17,29 +17,473 @@ limitations under the License.
 package v1
 
 import (
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // CommandSpec defines the desired state of Command
+// +kubebuilder:validation:XValidation:rule="!has(oldSelf.createdBy) || (has(self.createdBy) && self.createdBy == oldSelf.createdBy)",message="createdBy is immutable"
 type CommandSpec struct {
 	// Node selector
 	// +optional
 	Selector metav1.LabelSelector `json:"selector,omitempty"`
 	Command  string               `json:"command,omitempty"`
+
+	// AllNodes confirms that a Command without a selector is meant to run
+	// on every node. It must not be set together with a selector.
+	// +optional
+	AllNodes bool `json:"allNodes,omitempty"`
+
+	// Timeout bounds how long the command may run on each node. When it
+	// elapses the agent kills the command's whole process group.
+	// Omit for no limit.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Privilege is how much of the host the command may change: ReadOnly
+	// runs it in a read-only view of the host's filesystem, ReadWrite in a
+	// writable one. ReadWrite needs create on nodes/jarvis-exec-rw rather
+	// than nodes/jarvis-exec. Defaults to ReadOnly.
+	// +optional
+	Privilege Privilege `json:"privilege,omitempty"`
+
+	// Profile is the sandbox the command runs in on the node. Diagnostic
+	// keeps only the capabilities needed to look around, sets
+	// no_new_privs, filters syscalls that change the kernel or the machine
+	// and gives the command a mount namespace of its own. NetworkIsolated
+	// adds a network namespace with only a loopback interface. Full runs it
+	// as root with every capability. Defaults to Full.
+	// +optional
+	Profile Profile `json:"profile,omitempty"`
+
+	// GracePeriod is how long the agent waits after SIGTERM before sending
+	// SIGKILL. Defaults to 10s on the agent.
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+
+	// OutputLimit caps how much output is kept per node, e.g. 512Ki. Output
+	// beyond the cap keeps its first and last halves and drops the middle.
+	// Defaults to 1Mi on the agent.
+	// +optional
+	OutputLimit *resource.Quantity `json:"outputLimit,omitempty"`
+
+	// Resources bounds what the command may use on each node, so that a
+	// heavy command cannot starve the kubelet. Omit for no limits.
+	// +optional
+	Resources *CommandResources `json:"resources,omitempty"`
+
+	// RunID triggers another run of an otherwise unchanged Command. Each
+	// spec runs once; set this to any new value to run again.
+	// +optional
+	RunID string `json:"runID,omitempty"`
+
+	// ApplyToNewNodes runs the current generation on selected nodes whose
+	// agent comes up after the initial fan-out, including nodes skipped
+	// because they had no agent at the time. Nodes that already ran it are
+	// not run again.
+	// +optional
+	ApplyToNewNodes bool `json:"applyToNewNodes,omitempty"`
+
+	// Strategy rolls the command out in batches instead of on every node
+	// at once.
+	// +optional
+	Strategy *RolloutStrategy `json:"strategy,omitempty"`
+
+	// Paused stops further batches from starting. Nodes already running
+	// finish. Changing it does not start a new run.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// RetryPolicy tries a node again when the attempt fails. Without it
+	// each node gets one attempt.
+	// +optional
+	RetryPolicy *RetryPolicy `json:"retryPolicy,omitempty"`
+
+	// CreatedBy is the user who created the Command, recorded by the
+	// admission webhook; whatever is set here on creation is replaced. The
+	// command only runs on nodes this user may create nodes/jarvis-exec on.
+	// It cannot be changed.
+	// +optional
+	CreatedBy *authenticationv1.UserInfo `json:"createdBy,omitempty"`
+
+	// Approval holds the Command until users other than its creator have
+	// approved it with CommandApprovals. A CommandPolicy can require
+	// approval as well.
+	// +optional
+	Approval *ApprovalRequirement `json:"approval,omitempty"`
+}
+
+// ApprovalRequirement says how many approvals a Command needs before it runs.
+type ApprovalRequirement struct {
+	// Approvals is how many different users, none of them the creator,
+	// must approve the Command.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	Approvals int32 `json:"approvals,omitempty"`
+}
+
+// Privilege is how much of the host a command may change.
+// +kubebuilder:validation:Enum=ReadOnly;ReadWrite
+type Privilege string
+
+const (
+	// PrivilegeReadOnly runs the command in a read-only view of the host.
+	PrivilegeReadOnly Privilege = "ReadOnly"
+	// PrivilegeReadWrite runs the command in a writable view of the host.
+	PrivilegeReadWrite Privilege = "ReadWrite"
+)
+
+// Profile names a sandbox for commands.
+// +kubebuilder:validation:Enum=Full;Diagnostic;NetworkIsolated
+type Profile string
+
+const (
+	// ProfileFull runs the command without a sandbox.
+	ProfileFull Profile = "Full"
+	// ProfileDiagnostic runs the command with only the privileges needed
+	// to inspect the node.
+	ProfileDiagnostic Profile = "Diagnostic"
+	// ProfileNetworkIsolated runs the command as ProfileDiagnostic, without
+	// a network.
+	ProfileNetworkIsolated Profile = "NetworkIsolated"
+)
+
+// RetryCondition names a kind of failure that can be retried.
+// +kubebuilder:validation:Enum=Transport;NonZeroExit
+type RetryCondition string
+
+const (
+	// RetryOnTransport retries when the agent cannot be reached or the
+	// connection breaks. An agent that is still running the command, or ran
+	// it in the last ten minutes, hands back its result instead of running it
+	// again; one that restarted in between runs it a second time.
+	RetryOnTransport RetryCondition = "Transport"
+	// RetryOnNonZeroExit runs the command again when it exits non-zero.
+	RetryOnNonZeroExit RetryCondition = "NonZeroExit"
+)
+
+// RetryPolicy controls how failed attempts on a node are retried.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt.
+	// +optional
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	MaxAttempts int32 `json:"maxAttempts,omitempty"`
+
+	// Backoff is the wait before the first retry. It doubles with every
+	// retry after that, up to MaxBackoff. Defaults to 1s.
+	// +optional
+	Backoff *metav1.Duration `json:"backoff,omitempty"`
+
+	// MaxBackoff caps the wait between retries. Defaults to 1m.
+	// +optional
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+
+	// RetryOn lists the kinds of failure to retry. Defaults to Transport.
+	// +optional
+	// +listType=set
+	RetryOn []RetryCondition `json:"retryOn,omitempty"`
+}
+
+// CommandResources bounds what a command may use. The agent runs a command
+// with CPU, Memory, IOWeight or Pids set in a cgroup of its own under
+// jarvis.slice; Nice and the IO class apply to it without one.
+// +kubebuilder:validation:XValidation:rule="!has(self.ioPriority) || (has(self.ioClass) && self.ioClass == 'BestEffort')",message="ioPriority needs ioClass BestEffort"
+type CommandResources struct {
+	// CPU caps the CPU time the command may use, such as 500m for half a
+	// CPU, summed over all its processes.
+	// +optional
+	CPU *resource.Quantity `json:"cpu,omitempty"`
+
+	// Memory caps the memory the command may use, such as 256Mi. A
+	// command that cannot reclaim enough to stay under it is OOM-killed.
+	// +optional
+	Memory *resource.Quantity `json:"memory,omitempty"`
+
+	// IOWeight is the command's share of disk bandwidth against other
+	// cgroups, from 1 to 10000. The default for a cgroup is 100.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10000
+	IOWeight *int32 `json:"ioWeight,omitempty"`
+
+	// Pids caps how many processes and threads the command may have at
+	// once.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	Pids *int64 `json:"pids,omitempty"`
+
+	// Nice is the command's scheduling priority, from -20 (highest) to 19
+	// (lowest).
+	// +optional
+	// +kubebuilder:validation:Minimum=-20
+	// +kubebuilder:validation:Maximum=19
+	Nice *int32 `json:"nice,omitempty"`
+
+	// IOClass is the command's IO scheduling class, as set by ionice:
+	// BestEffort, or Idle to only use the disk when nothing else does.
+	// +optional
+	IOClass IOClass `json:"ioClass,omitempty"`
+
+	// IOPriority is the priority within the BestEffort class, from 0
+	// (highest) to 7. Defaults to one derived from Nice.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=7
+	IOPriority *int32 `json:"ioPriority,omitempty"`
+}
+
+// IOClass names an IO scheduling class.
+// +kubebuilder:validation:Enum=BestEffort;Idle
+type IOClass string
+
+const (
+	// IOClassBestEffort shares the disk by IOPriority.
+	IOClassBestEffort IOClass = "BestEffort"
+	// IOClassIdle only uses the disk when no one else does.
+	IOClassIdle IOClass = "Idle"
+)
+
+// ResourceLimit names a limit from CommandResources a command ran into.
+type ResourceLimit string
+
+const (
+	// LimitCPU means the command was throttled to stay under its CPU cap.
+	LimitCPU ResourceLimit = "CPU"
+	// LimitMemory means the command reached its memory cap.
+	LimitMemory ResourceLimit = "Memory"
+	// LimitOOMKill means a process of the command was killed for using
+	// more memory than its cap.
+	LimitOOMKill ResourceLimit = "OOMKill"
+	// LimitPids means the command was refused a new process or thread.
+	LimitPids ResourceLimit = "Pids"
+)
+
+// RolloutStrategy controls how a command is rolled out across its nodes.
+type RolloutStrategy struct {
+	// MaxParallel is how many nodes run at a time, as a count or a
+	// percentage of the targeted nodes. Each batch starts once the previous
+	// one has finished. Defaults to every node at once.
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	MaxParallel *intstr.IntOrString `json:"maxParallel,omitempty"`
+
+	// Canary is the size of a first batch, as a count or a percentage, that
+	// must finish before the rest of the rollout starts.
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	Canary *intstr.IntOrString `json:"canary,omitempty"`
+
+	// PauseBetweenBatches is how long to wait after a batch finishes before
+	// starting the next one.
+	// +optional
+	PauseBetweenBatches *metav1.Duration `json:"pauseBetweenBatches,omitempty"`
+
+	// TopologyKey orders the rollout by the value of this node label, e.g.
+	// topology.kubernetes.io/zone, so it goes through one zone at a time.
+	// Batches after the canary never span two values.
+	// +optional
+	TopologyKey string `json:"topologyKey,omitempty"`
+
+	// MaxFailures aborts the batches that have not started yet once more
+	// than this many nodes, as a count or a percentage, have failed.
+	// Defaults to no limit.
+	// +optional
+	// +kubebuilder:validation:XIntOrString
+	MaxFailures *intstr.IntOrString `json:"maxFailures,omitempty"`
 }
 
+// Condition types reported on a Command.
+const (
+	// ConditionComplete is True once every targeted node has finished and
+	// none of them failed.
+	ConditionComplete = "Complete"
+	// ConditionFailed is True once every targeted node has finished and at
+	// least one of them failed.
+	ConditionFailed = "Failed"
+	// ConditionPaused is True while spec.paused holds back a rollout.
+	ConditionPaused = "Paused"
+	// ConditionApproved is False while a Command that needs approval waits
+	// for it, and True once it was approved and started.
+	ConditionApproved = "Approved"
+)
+
 type CommandStatus struct {
-	Results    []CommandResult    `json:"results,omitempty"`
+	// ObservedGeneration is the most recent generation the controller has
+	// acted on.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// RunGeneration is the generation the current run was started from.
+	// It only moves when what the command runs changes: its command, timeout,
+	// privilege, profile, grace period, output limit, resources or runID.
+	// Fields that only steer a run, such as the selector, strategy,
+	// applyToNewNodes and paused, do not start a new one.
+	// +optional
+	RunGeneration int64 `json:"runGeneration,omitempty"`
+	// SpecHash identifies the spec the current run was started from.
+	// +optional
+	SpecHash string `json:"specHash,omitempty"`
+
+	// Batches is how many batches the rollout is split into, and
+	// CurrentBatch the one in progress, counting from 0.
+	// +optional
+	Batches int32 `json:"batches,omitempty"`
+	// +optional
+	CurrentBatch int32 `json:"currentBatch,omitempty"`
+
+	// Succeeded, Failed and Skipped count the nodes in each final phase.
+	// +optional
+	Succeeded int32 `json:"succeeded,omitempty"`
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
+	// +optional
+	Skipped int32 `json:"skipped,omitempty"`
+
+	// Results holds one entry per targeted node.
+	// +listType=map
+	// +listMapKey=node
+	// +optional
+	Results []CommandResult `json:"results,omitempty"`
+	// +listType=map
+	// +listMapKey=type
+	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
+// NodePhase is where a command is in its life cycle on one node.
+// +kubebuilder:validation:Enum=Pending;Running;Succeeded;Failed;Skipped
+type NodePhase string
+
+const (
+	// NodePending means the node is targeted but the command has not been sent.
+	NodePending NodePhase = "Pending"
+	// NodeRunning means the command has been sent to the node's agent.
+	NodeRunning NodePhase = "Running"
+	// NodeSucceeded means the command completed and exited 0.
+	NodeSucceeded NodePhase = "Succeeded"
+	// NodeFailed means the command exited non-zero, was killed, never
+	// started, or the agent could not be reached.
+	NodeFailed NodePhase = "Failed"
+	// NodeSkipped means the command was not run on the node; see Reason.
+	NodeSkipped NodePhase = "Skipped"
+)
+
+// CommandOutcome describes how a command stopped running on a node.
+// +kubebuilder:validation:Enum=Completed;TimedOut;Cancelled;FailedToStart
+type CommandOutcome string
+
+const (
+	// OutcomeCompleted means the command exited on its own.
+	OutcomeCompleted CommandOutcome = "Completed"
+	// OutcomeTimedOut means the command was killed when its timeout elapsed.
+	OutcomeTimedOut CommandOutcome = "TimedOut"
+	// OutcomeCancelled means the command was killed because it was cancelled,
+	// or because the controller went away and did not come back for it in time.
+	OutcomeCancelled CommandOutcome = "Cancelled"
+	// OutcomeFailedToStart means the command never ran; see SpawnError.
+	OutcomeFailedToStart CommandOutcome = "FailedToStart"
+)
+
+// OutputEncoding declares how a result's output fields are encoded.
+// +kubebuilder:validation:Enum=UTF-8;Base64
+type OutputEncoding string
+
+const (
+	// EncodingUTF8 means the output is plain text.
+	EncodingUTF8 OutputEncoding = "UTF-8"
+	// EncodingBase64 means the output was not valid UTF-8 and is stored
+	// base64-encoded.
+	EncodingBase64 OutputEncoding = "Base64"
+)
+
 type CommandResult struct {
-	Node   string `json:"node,omitempty"`
-	Output string `json:"output,omitempty"`
+	Node  string    `json:"node"`
+	Phase NodePhase `json:"phase,omitempty"`
+	// Generation is the run generation this result was produced for.
+	// +optional
+	Generation int64 `json:"generation,omitempty"`
+	// Batch is the rollout batch the node belongs to.
+	// +optional
+	Batch int32 `json:"batch,omitempty"`
+	// Attempts is how many times the command has been tried on the node.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+	// Privilege is the view of the host the command ran in, as reported by
+	// the agent.
+	// +optional
+	Privilege Privilege `json:"privilege,omitempty"`
+	// Profile is the sandbox the command ran in, as reported by the agent.
+	// +optional
+	Profile Profile `json:"profile,omitempty"`
+	// LimitsHit lists the limits from spec.resources the command ran into.
+	// +optional
+	// +listType=set
+	LimitsHit []ResourceLimit `json:"limitsHit,omitempty"`
+	// Reason is a CamelCase word explaining a Failed or Skipped phase.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Stdout and Stderr hold the end of what the command wrote to each.
+	// Status keeps at most 1KiB of each, less once the Command targets more
+	// nodes than fit in its output budget; the full output, interleaved, is
+	// recorded in the node's event.
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	// Encoding applies to Stdout and Stderr alike.
+	// +optional
+	Encoding OutputEncoding `json:"encoding,omitempty"`
+	// Truncated is set when output went over the limit and the middle of it
+	// was dropped; DroppedBytes says how much.
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+	// +optional
+	DroppedBytes int64 `json:"droppedBytes,omitempty"`
+
+	// ExitCode is -1 when the command was killed by a signal or never started.
+	// It is unset until the command has finished.
+	// +optional
+	ExitCode *int32         `json:"exitCode,omitempty"`
+	Outcome  CommandOutcome `json:"outcome,omitempty"`
+	// Signal names the signal that terminated the command, e.g. SIGKILL.
+	// +optional
+	Signal string `json:"signal,omitempty"`
+	// SpawnError explains why the command could not be started.
+	// +optional
+	SpawnError string `json:"spawnError,omitempty"`
+
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// +optional
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+	// Duration is the wall-clock time between StartTime and EndTime.
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// MaxRSSBytes is the peak resident set size of the command.
+	// +optional
+	MaxRSSBytes int64 `json:"maxRSSBytes,omitempty"`
+	// +optional
+	UserCPUTime *metav1.Duration `json:"userCPUTime,omitempty"`
+	// +optional
+	SystemCPUTime *metav1.Duration `json:"systemCPUTime,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Command",type=string,JSONPath=`.spec.command`,priority=1
+// +kubebuilder:printcolumn:name="Succeeded",type=integer,JSONPath=`.status.succeeded`
+// +kubebuilder:printcolumn:name="Failed",type=integer,JSONPath=`.status.failed`
+// +kubebuilder:printcolumn:name="Skipped",type=integer,JSONPath=`.status.skipped`
+// +kubebuilder:printcolumn:name="Complete",type=string,JSONPath=`.status.conditions[?(@.type=="Complete")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Command is the Schema for the commands API
 type Command struct {
@@ -0,0 +1,87 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// CommandApprovalSpec approves one Command, as it stood when the approval
+// was created.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="a CommandApproval cannot be changed; delete it instead"
+type CommandApprovalSpec struct {
+	// Command is the name of the Command, in the same namespace, to approve.
+	// +kubebuilder:validation:MinLength=1
+	Command string `json:"command"`
+
+	// ExpiresAt is when the approval lapses if the Command has not started
+	// by then. Defaults to an hour after the approval is created.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Comment says why the Command is approved.
+	// +optional
+	Comment string `json:"comment,omitempty"`
+
+	// ApprovedBy is the user who created the approval, recorded by the
+	// admission webhook; whatever is set here is replaced.
+	// +optional
+	ApprovedBy *authenticationv1.UserInfo `json:"approvedBy,omitempty"`
+
+	// CommandUID and CommandGeneration identify the version of the Command
+	// approved, recorded by the admission webhook. Any change to the
+	// Command's spec, including a new runID, needs a new approval.
+	// +optional
+	CommandUID types.UID `json:"commandUID,omitempty"`
+	// +optional
+	CommandGeneration int64 `json:"commandGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Command",type=string,JSONPath=`.spec.command`
+// +kubebuilder:printcolumn:name="Approved By",type=string,JSONPath=`.spec.approvedBy.username`
+// +kubebuilder:printcolumn:name="Expires",type=date,JSONPath=`.spec.expiresAt`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CommandApproval is the Schema for the commandapprovals API. It records
+// that a user approved a Command that needs approval.
+type CommandApproval struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec says what is approved, and by whom
+	// +required
+	Spec CommandApprovalSpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// CommandApprovalList contains a list of CommandApproval
+type CommandApprovalList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CommandApproval `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CommandApproval{}, &CommandApprovalList{})
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionPolicyViolation is True on a Command while a CommandPolicy or
+// ClusterCommandPolicy keeps it from running somewhere, or holds it back.
+const ConditionPolicyViolation = "PolicyViolation"
+
+// CommandPolicySpec limits what the Commands in a namespace may do. Every
+// policy that applies to a namespace must be satisfied; where several set the
+// same limit, the strictest wins.
+type CommandPolicySpec struct {
+	// NodeSelector limits the nodes Commands may run on. Selected nodes
+	// outside it are skipped. Omit to allow every node.
+	// +optional
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	// AllowedCommands are the approved command templates: regular
+	// expressions (RE2), one of which the whole command must match, such as
+	// `systemctl status [a-z0-9@.-]+`. Omit to allow any command.
+	// +optional
+	AllowedCommands []string `json:"allowedCommands,omitempty"`
+
+	// DeniedCommands are regular expressions (RE2) no part of the command
+	// may match.
+	// +optional
+	DeniedCommands []string `json:"deniedCommands,omitempty"`
+
+	// AllowedPrivileges are the privileges Commands may ask for, such as
+	// only ReadOnly. Omit to allow both.
+	// +optional
+	AllowedPrivileges []Privilege `json:"allowedPrivileges,omitempty"`
+
+	// AllowedProfiles are the sandbox profiles Commands may ask for, such
+	// as Diagnostic and NetworkIsolated but not Full. Omit to allow all.
+	// +optional
+	AllowedProfiles []Profile `json:"allowedProfiles,omitempty"`
+
+	// MaxParallel caps how many nodes a Command runs on at a time. Larger
+	// batches are split up.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxParallel *int32 `json:"maxParallel,omitempty"`
+
+	// MaxTimeout is the longest timeout a Command may set. Commands must
+	// set one, or get one from the JarvisConfig's defaults.
+	// +optional
+	MaxTimeout *metav1.Duration `json:"maxTimeout,omitempty"`
+
+	// Quota caps how many node executions the namespace's Commands start
+	// in a window of time. Nodes over the quota wait for it.
+	// +optional
+	Quota *ExecutionQuota `json:"quota,omitempty"`
+
+	// Approval makes the Commands it picks wait for approval before they
+	// run, as if they set spec.approval.
+	// +optional
+	Approval *ApprovalPolicy `json:"approval,omitempty"`
+}
+
+// ApprovalPolicy picks the Commands that need approval: those that match the
+// selector and one of the patterns. Without either, every Command the other
+// one picks needs approval; without both, every Command does.
+type ApprovalPolicy struct {
+	// Selector picks Commands by their labels.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Commands are regular expressions (RE2), any part of the command may
+	// match, such as `systemctl restart kubelet` or `iptables -F`.
+	// +optional
+	Commands []string `json:"commands,omitempty"`
+
+	// Approvals is how many different users, none of them the creator,
+	// must approve each Command.
+	// +optional
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	Approvals int32 `json:"approvals,omitempty"`
+}
+
+// ExecutionQuota allows MaxExecutions node executions to start in any
+// Window. An execution counts from when it starts until it leaves the window,
+// or for as long as it is running.
+type ExecutionQuota struct {
+	// +kubebuilder:validation:Minimum=1
+	MaxExecutions int32 `json:"maxExecutions"`
+
+	// Window is the period the quota is counted over, e.g. 1h.
+	Window metav1.Duration `json:"window"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CommandPolicy is the Schema for the commandpolicies API. It applies to the
+// Commands in its own namespace.
+type CommandPolicy struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the limits the policy sets
+	// +required
+	Spec CommandPolicySpec `json:"spec"`
+}
+
+// +kubebuilder:object:root=true
+
+// CommandPolicyList contains a list of CommandPolicy
+type CommandPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CommandPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CommandPolicy{}, &CommandPolicyList{})
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConcurrencyPolicy describes what happens when a run is due while an earlier
+// one is still going.
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+type ConcurrencyPolicy string
+
+const (
+	// AllowConcurrent lets runs overlap.
+	AllowConcurrent ConcurrencyPolicy = "Allow"
+	// ForbidConcurrent skips a run while the previous one is still going.
+	ForbidConcurrent ConcurrencyPolicy = "Forbid"
+	// ReplaceConcurrent cancels the running one and starts the new one.
+	ReplaceConcurrent ConcurrencyPolicy = "Replace"
+)
+
+// CronCommandSpec defines the desired state of CronCommand
+// +kubebuilder:validation:XValidation:rule="has(self.schedule) != has(self.interval)",message="exactly one of schedule or interval must be set"
+type CronCommandSpec struct {
+	// Schedule is a cron expression, e.g. "*/5 * * * *".
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Interval runs the command at a fixed period, counted from the
+	// CronCommand's creation, e.g. 90s.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// TimeZone is the IANA time zone the schedule is read in, e.g.
+	// "Europe/London". Defaults to the controller's local time zone.
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// ConcurrencyPolicy says what to do when a run is due while the
+	// previous one has not finished.
+	// +optional
+	// +kubebuilder:default=Allow
+	ConcurrencyPolicy ConcurrencyPolicy `json:"concurrencyPolicy,omitempty"`
+
+	// StartingDeadlineSeconds is how late a run may start, for example
+	// after a controller outage, before it is skipped.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// HistoryLimit is how many finished runs are kept.
+	// +optional
+	// +kubebuilder:default=3
+	// +kubebuilder:validation:Minimum=0
+	HistoryLimit *int32 `json:"historyLimit,omitempty"`
+
+	// CommandTemplate is the spec of the Command created for each run.
+	// +required
+	CommandTemplate CommandSpec `json:"commandTemplate"`
+}
+
+// CronCommandStatus defines the observed state of CronCommand.
+type CronCommandStatus struct {
+	// Active lists the runs that have not finished yet.
+	// +optional
+	// +listType=atomic
+	Active []corev1.ObjectReference `json:"active,omitempty"`
+
+	// LastScheduleTime is when a run was last started.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is when a run last completed on every node.
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Schedule",type=string,JSONPath=`.spec.schedule`
+// +kubebuilder:printcolumn:name="Interval",type=string,JSONPath=`.spec.interval`
+// +kubebuilder:printcolumn:name="Last Schedule",type=date,JSONPath=`.status.lastScheduleTime`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// CronCommand is the Schema for the croncommands API
+type CronCommand struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of CronCommand
+	// +required
+	Spec CronCommandSpec `json:"spec"`
+
+	// status defines the observed state of CronCommand
+	// +optional
+	Status CronCommandStatus `json:"status,omitempty,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// CronCommandList contains a list of CronCommand
+type CronCommandList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CronCommand `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CronCommand{}, &CronCommandList{})
+}
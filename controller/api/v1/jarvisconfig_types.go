@@ -0,0 +1,207 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JarvisConfigName is the name of the one JarvisConfig the controller reads.
+const JarvisConfigName = "cluster"
+
+// ConditionValid reports whether the JarvisConfig was accepted. While it is
+// False the controller keeps running with the last valid configuration.
+const ConditionValid = "Valid"
+
+// JarvisConfigSpec defines the desired state of JarvisConfig
+type JarvisConfigSpec struct {
+	// Agent says how the controller finds and talks to the agents.
+	// +optional
+	Agent AgentConfig `json:"agent,omitempty"`
+
+	// Defaults fill in Commands that leave these fields unset.
+	// +optional
+	Defaults CommandDefaults `json:"defaults,omitempty"`
+
+	// Limits bound what Commands may ask for.
+	// +optional
+	Limits Limits `json:"limits,omitempty"`
+}
+
+// AgentConfig locates the agents: one endpoint per node in the EndpointSlices
+// of a Service.
+type AgentConfig struct {
+	// Namespace the agent Service is in.
+	// +optional
+	// +kubebuilder:default=jarvis
+	Namespace string `json:"namespace,omitempty"`
+
+	// Service is the name of the agent Service.
+	// +optional
+	// +kubebuilder:default=jarvis-agent
+	Service string `json:"service,omitempty"`
+
+	// Port the agents listen on.
+	// +optional
+	// +kubebuilder:default=50051
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+
+	// TLS says how connections to the agents are secured. Defaults to
+	// mutual TLS with certificates from the controller's own CA.
+	// +optional
+	TLS *AgentTLS `json:"tls,omitempty"`
+}
+
+// TLSMode says how connections to the agents are secured.
+// +kubebuilder:validation:Enum=Managed;Provided;Disabled
+type TLSMode string
+
+const (
+	// TLSManaged is mutual TLS with certificates the controller issues from
+	// its own CA: one per agent, naming its node, and one for itself.
+	TLSManaged TLSMode = "Managed"
+	// TLSProvided is TLS with certificates from a Secret the administrator
+	// manages.
+	TLSProvided TLSMode = "Provided"
+	// TLSDisabled is plaintext.
+	TLSDisabled TLSMode = "Disabled"
+)
+
+// AgentTLS says how the controller verifies agents and identifies itself to
+// them.
+// +kubebuilder:validation:XValidation:rule="self.mode != 'Provided' || has(self.secretName)",message="secretName is required when mode is Provided"
+type AgentTLS struct {
+	// Mode is Managed, Provided or Disabled.
+	// +optional
+	// +kubebuilder:default=Managed
+	Mode TLSMode `json:"mode,omitempty"`
+
+	// SecretName names a Secret in the agent namespace, used when mode is
+	// Provided. Its ca.crt verifies the agents' certificates; tls.crt and
+	// tls.key, if present, are the client certificate the controller
+	// presents.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// ServerName is checked against the agents' certificates instead of
+	// their address when mode is Provided.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+
+	// CertificateLifetime is how long the certificates issued in Managed
+	// mode are valid. They are replaced once two thirds of it has passed.
+	// +optional
+	// +kubebuilder:default="720h"
+	CertificateLifetime *metav1.Duration `json:"certificateLifetime,omitempty"`
+}
+
+// CommandDefaults fill in Commands that leave these fields unset.
+type CommandDefaults struct {
+	// Timeout bounds how long a command may run on each node.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// GracePeriod is the delay between SIGTERM and SIGKILL when a command
+	// is stopped.
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+
+	// OutputLimit caps how much output the agent keeps per node.
+	// +optional
+	OutputLimit *resource.Quantity `json:"outputLimit,omitempty"`
+
+	// Strategy is the rollout strategy given to new Commands that do not
+	// set one.
+	// +optional
+	Strategy *RolloutStrategy `json:"strategy,omitempty"`
+}
+
+// Limits bound what Commands may ask for.
+type Limits struct {
+	// MaxConcurrentExecutions caps how many node executions run at once
+	// across all Commands. Defaults to the controller's
+	// --max-concurrent-executions flag.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxConcurrentExecutions *int32 `json:"maxConcurrentExecutions,omitempty"`
+
+	// MaxExecutionsPerNode caps how many run at once on any one node.
+	// Defaults to the controller's --max-executions-per-node flag.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	MaxExecutionsPerNode *int32 `json:"maxExecutionsPerNode,omitempty"`
+
+	// MaxOutputLimit is the most output a Command may keep per node. Larger
+	// outputLimits are lowered to it.
+	// +optional
+	MaxOutputLimit *resource.Quantity `json:"maxOutputLimit,omitempty"`
+}
+
+// JarvisConfigStatus defines the observed state of JarvisConfig.
+type JarvisConfigStatus struct {
+	// ObservedGeneration is the generation the conditions describe.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// conditions represent the current state of the JarvisConfig resource.
+	// The Valid condition reports whether the configuration is in use.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:validation:XValidation:rule="self.metadata.name == 'cluster'",message="the JarvisConfig must be named cluster"
+// +kubebuilder:printcolumn:name="Valid",type=string,JSONPath=`.status.conditions[?(@.type=="Valid")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// JarvisConfig is the Schema for the jarvisconfigs API. It is cluster-wide
+// and there is only one, named cluster.
+type JarvisConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// metadata is a standard object metadata
+	// +optional
+	metav1.ObjectMeta `json:"metadata,omitempty,omitzero"`
+
+	// spec defines the desired state of JarvisConfig
+	// +required
+	Spec JarvisConfigSpec `json:"spec"`
+
+	// status defines the observed state of JarvisConfig
+	// +optional
+	Status JarvisConfigStatus `json:"status,omitempty,omitzero"`
+}
+
+// +kubebuilder:object:root=true
+
+// JarvisConfigList contains a list of JarvisConfig
+type JarvisConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []JarvisConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&JarvisConfig{}, &JarvisConfigList{})
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultFailureThreshold is how many transport failures in a row open
+	// an agent's circuit.
+	defaultFailureThreshold = 3
+	// defaultCooldown is how long an open circuit stays open before a single
+	// call is let through to probe the agent.
+	defaultCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned, without contacting the agent, while an agent's
+// circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitBreaker tracks the health of each agent and fails calls to unhealthy
+// ones straight away instead of letting every Command wait for them to time
+// out. The zero value is ready to use with the default threshold and cooldown.
+type CircuitBreaker struct {
+	// FailureThreshold is how many transport failures in a row open an
+	// agent's circuit.
+	FailureThreshold int
+	// Cooldown is how long an open circuit stays open before a probe is let
+	// through.
+	Cooldown time.Duration
+
+	mu     sync.Mutex
+	agents map[string]*agentHealth
+}
+
+type agentHealth struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// Allow reports whether a call to the agent at addr may go ahead. Once the
+// cooldown has passed, one call at a time is let through to probe the agent.
+func (b *CircuitBreaker) Allow(addr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := b.agents[addr]
+	if h == nil || h.failures < b.threshold() {
+		return nil
+	}
+	if wait := time.Until(h.openUntil); wait > 0 {
+		return fmt.Errorf("%w for agent %s: %d failures in a row, retrying in %s", ErrCircuitOpen, addr, h.failures, wait.Round(time.Second))
+	}
+	if h.probing {
+		return fmt.Errorf("%w for agent %s: probe in progress", ErrCircuitOpen, addr)
+	}
+	h.probing = true
+	return nil
+}
+
+// Success records that the agent at addr answered.
+func (b *CircuitBreaker) Success(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.agents, addr)
+}
+
+// Failure records that the agent at addr could not be reached.
+func (b *CircuitBreaker) Failure(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.agents == nil {
+		b.agents = map[string]*agentHealth{}
+	}
+	h := b.agents[addr]
+	if h == nil {
+		h = &agentHealth{}
+		b.agents[addr] = h
+	}
+	h.failures++
+	h.probing = false
+	if h.failures >= b.threshold() {
+		cooldown := b.Cooldown
+		if cooldown <= 0 {
+			cooldown = defaultCooldown
+		}
+		h.openUntil = time.Now().Add(cooldown)
+	}
+}
+
+// abandon records that a call to the agent at addr ended without saying
+// anything about its health, e.g. because the caller gave up.
+func (b *CircuitBreaker) abandon(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if h := b.agents[addr]; h != nil {
+		h.probing = false
+	}
+}
+
+func (b *CircuitBreaker) threshold() int {
+	if b.FailureThreshold <= 0 {
+		return defaultFailureThreshold
+	}
+	return b.FailureThreshold
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const addr = "10.0.0.1:50051"
+	// Each step is a call to the breaker, and whether Allow then lets a
+	// call through.
+	type step struct {
+		do    string
+		allow bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"healthy", []step{{"allow", true}, {"success", true}}},
+		{"failures below the threshold", []step{{"failure", true}, {"failure", true}}},
+		{"opens at the threshold", []step{{"failure", true}, {"failure", true}, {"failure", false}}},
+		{"success resets", []step{{"failure", true}, {"failure", true}, {"success", true}, {"failure", true}, {"failure", true}}},
+		{"one probe after the cooldown", []step{
+			{"failure", true}, {"failure", true}, {"failure", false},
+			{"cooldown", true}, {"allow", false},
+		}},
+		{"failed probe reopens", []step{
+			{"failure", true}, {"failure", true}, {"failure", false},
+			{"cooldown", true}, {"failure", false},
+		}},
+		{"successful probe closes", []step{
+			{"failure", true}, {"failure", true}, {"failure", false},
+			{"cooldown", true}, {"success", true}, {"allow", true},
+		}},
+		{"abandoned probe lets another through", []step{
+			{"failure", true}, {"failure", true}, {"failure", false},
+			{"cooldown", true}, {"abandon", true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &CircuitBreaker{Cooldown: 20 * time.Millisecond}
+			for i, s := range tt.steps {
+				switch s.do {
+				case "allow":
+					// Takes the probe, if there is one to take.
+					_ = b.Allow(addr)
+				case "success":
+					b.Success(addr)
+				case "failure":
+					b.Failure(addr)
+				case "abandon":
+					b.abandon(addr)
+				case "cooldown":
+					time.Sleep(30 * time.Millisecond)
+				}
+				err := b.Allow(addr)
+				if (err == nil) != s.allow {
+					t.Fatalf("step %d (%s): Allow() = %v, want allowed %v", i, s.do, err, s.allow)
+				}
+				if err != nil && !errors.Is(err, ErrCircuitOpen) {
+					t.Fatalf("step %d (%s): Allow() = %v, want ErrCircuitOpen", i, s.do, err)
+				}
+				if err == nil {
+					// Hand back a probe that was not used.
+					b.abandon(addr)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerPerAgent(t *testing.T) {
+	b := &CircuitBreaker{FailureThreshold: 1}
+	b.Failure("a")
+	if err := b.Allow("a"); err == nil {
+		t.Error("circuit for a not open")
+	}
+	if err := b.Allow("b"); err != nil {
+		t.Errorf("circuit for b open: %v", err)
+	}
+}
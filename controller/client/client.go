@@ -1,42 +1,297 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	pb "github.com/motilayo/jarvis/agent/pb"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
-func RunCommandOnNode(ctx context.Context, nodeIP, nodeName, command string) (string, error) {
+const (
+	// reportSlack is how long past the command's own timeout and grace
+	// period the client waits for the agent to report back before giving up
+	// on the RPC.
+	reportSlack = 10 * time.Second
+	// agentGracePeriod is the grace period the agent applies to a request
+	// that sets none. It must match defaultGracePeriod in the agent.
+	agentGracePeriod = 10 * time.Second
+)
+
+// errStreamClosed means the agent hung up before reporting a result.
+var errStreamClosed = errors.New("stream closed before the command finished")
+
+// OutputFunc is called with each chunk of output as the agent produces it.
+type OutputFunc func(stream pb.Stream, data []byte)
+
+// AttemptFunc is called before each retry with the attempt about to start,
+// counting from 1, and why the previous one is being retried.
+type AttemptFunc func(attempt int, reason error)
+
+// Options tune how a command is run on a node.
+type Options struct {
+	// ID identifies the execution on the agent so it can be cancelled with
+	// CancelCommandOnNode. Left empty, a unique one is generated.
+	ID string
+	// Timeout bounds how long the command may run. Zero means no limit.
+	Timeout time.Duration
+	// GracePeriod is the delay between SIGTERM and SIGKILL when the command
+	// is stopped. Zero leaves the agent's default in place.
+	GracePeriod time.Duration
+	// MaxOutputBytes caps how much output the agent keeps. Zero uses the
+	// agent's default.
+	MaxOutputBytes int64
+	// Privilege is the view of the host the command runs in. Unset is
+	// read-only.
+	Privilege pb.Privilege
+	// Profile is the sandbox the command runs in. Unset is PROFILE_FULL.
+	Profile pb.Profile
+	// Resources, if set, bounds what the command may use.
+	Resources *pb.ResourceLimits
+	// OnOutput, if set, is called with output as it arrives. Output from an
+	// attempt that is retried is passed on too.
+	OnOutput OutputFunc
+	// Retry says when to try again. The zero value makes one attempt.
+	Retry RetryPolicy
+	// OnAttempt, if set, is called before each retry.
+	OnAttempt AttemptFunc
+	// Breaker, if set, fails the call straight away while the agent is
+	// known to be unhealthy, and learns from its outcome.
+	Breaker *CircuitBreaker
+	// Pool, if set, supplies the connection to the agent. Without one a
+	// connection is opened for the call and closed after it.
+	Pool *Pool
+	// ServerName, if set, is the name the agent's certificate must carry.
+	// Without it the name comes from the TLS configuration, or from addr.
+	ServerName string
+	// Signer, if set, signs each request for nodeName, so that an agent
+	// requiring signatures runs it.
+	Signer *Signer
+	// CommandUID is the UID of the Command the request runs, recorded in
+	// its signature.
+	CommandUID string
+}
+
+// AgentAddress is the address of an agent listening on port at ip, which
+// may be IPv4 or IPv6.
+func AgentAddress(ip string, port int32) string {
+	return net.JoinHostPort(ip, strconv.Itoa(int(port)))
+}
+
+// RunCommandOnNode runs command on the agent at addr and waits for it to
+// finish, retrying as opts.Retry allows. The returned result carries the
+// output streamed by the agent, both interleaved and split by stream.
+func RunCommandOnNode(ctx context.Context, addr, nodeName, command string, opts Options) (*pb.CommandResult, error) {
+	id := opts.ID
+	if id == "" {
+		id = fmt.Sprintf("cmd-%d", time.Now().UnixNano())
+	}
+
+	executionID, run := id, 1
+	for attempt := 1; ; attempt++ {
+		if opts.Breaker != nil {
+			if err := opts.Breaker.Allow(addr); err != nil {
+				return nil, err
+			}
+		}
 
-	addr := fmt.Sprintf("%s:50051", nodeIP)
-	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		result, err := runOnce(ctx, addr, nodeName, command, executionID, opts)
+		var reason error
+		switch {
+		case err == nil:
+			if opts.Breaker != nil {
+				opts.Breaker.Success(addr)
+			}
+			if !opts.Retry.RetryNonZeroExit || !exitedNonZero(result) || attempt >= opts.Retry.MaxAttempts {
+				return result, nil
+			}
+			// Asked for: run it again, under an ID of its own.
+			run++
+			executionID = fmt.Sprintf("%s#%d", id, run)
+			reason = fmt.Errorf("exit code %d", result.GetExitCode())
+		case isTransportError(err):
+			if opts.Breaker != nil {
+				opts.Breaker.Failure(addr)
+			}
+			if !opts.Retry.RetryTransport || attempt >= opts.Retry.MaxAttempts {
+				return nil, err
+			}
+			// Same execution ID: if the agent got as far as running the
+			// command, it hands back the result instead of running it again.
+			reason = err
+		default:
+			if opts.Breaker != nil {
+				opts.Breaker.abandon(addr)
+			}
+			return nil, err
+		}
+
+		if opts.OnAttempt != nil {
+			opts.OnAttempt(attempt+1, reason)
+		}
+		if err := sleep(ctx, opts.Retry.backoff(attempt+1)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// runOnce makes a single StreamCommand call.
+func runOnce(ctx context.Context, addr, nodeName, command, id string, opts Options) (*pb.CommandResult, error) {
+	conn, release, err := dial(opts.Pool, addr, opts.ServerName)
 	if err != nil {
-		return "", fmt.Errorf("grpc.NewClient(): %w", err)
+		return nil, err
 	}
-	defer conn.Close()
+	defer release()
 
 	client := pb.NewJarvisClient(conn)
 
 	req := &pb.CommandRequest{
-		Id:  fmt.Sprintf("cmd-%d", time.Now().UnixNano()),
-		Cmd: command,
+		Id:             id,
+		Cmd:            command,
+		MaxOutputBytes: opts.MaxOutputBytes,
+		Privilege:      opts.Privilege,
+		Profile:        opts.Profile,
+		Resources:      opts.Resources,
+	}
+	if opts.Timeout > 0 {
+		req.Timeout = durationpb.New(opts.Timeout)
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rpcTimeout(opts))
+		defer cancel()
+	}
+	if opts.GracePeriod > 0 {
+		req.GracePeriod = durationpb.New(opts.GracePeriod)
+	}
+	if opts.Signer != nil {
+		// Last, as the signature covers the rest of the request.
+		if err := opts.Signer.sign(req, nodeName, opts.CommandUID); err != nil {
+			return nil, err
+		}
+	}
+
+	stream, err := client.StreamCommand(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("StreamCommand(): %w", err)
+	}
+
+	var out, stdout, stderr bytes.Buffer
+	var result *pb.CommandResult
+	for result == nil {
+		msg, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", nodeName, errStreamClosed)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("stream.Recv(): %w", err)
+		}
+
+		switch payload := msg.Payload.(type) {
+		case *pb.CommandOutput_Chunk:
+			out.Write(payload.Chunk.GetData())
+			if payload.Chunk.GetStream() == pb.Stream_STREAM_STDERR {
+				stderr.Write(payload.Chunk.GetData())
+			} else {
+				stdout.Write(payload.Chunk.GetData())
+			}
+			if opts.OnOutput != nil {
+				opts.OnOutput(payload.Chunk.GetStream(), payload.Chunk.GetData())
+			}
+		case *pb.CommandOutput_Result:
+			result = payload.Result
+		}
 	}
+	result.Output = out.Bytes()
+	result.Stdout = stdout.Bytes()
+	result.Stderr = stderr.Bytes()
+
+	return result, nil
+}
 
-	resp, err := client.RunCommand(ctx, req)
+// rpcTimeout is how long a call running a command with opts.Timeout may take.
+// It leaves the agent room to stop the command, waiting out the same grace
+// period between SIGTERM and SIGKILL as the agent does, and to report that
+// it timed out, rather than cutting the RPC off first.
+func rpcTimeout(opts Options) time.Duration {
+	grace := opts.GracePeriod
+	if grace <= 0 {
+		grace = agentGracePeriod
+	}
+	return opts.Timeout + grace + reportSlack
+}
+
+// CancelCommandOnNode asks the agent at addr to kill the command running as
+// id and waits, until ctx is done, for it to exit. The connection is taken
+// from pool if it is not nil. serverName is as for Options.ServerName.
+func CancelCommandOnNode(ctx context.Context, pool *Pool, addr, serverName, id string) (*pb.CancelResponse, error) {
+	conn, release, err := dial(pool, addr, serverName)
 	if err != nil {
-		return "", fmt.Errorf("RunCommand(): %w", err)
+		return nil, err
 	}
+	defer release()
 
-	formattedOutput := strings.TrimRight(resp.Output, "\r\n")
-	if strings.TrimSpace(formattedOutput) == "" {
+	resp, err := pb.NewJarvisClient(conn).Cancel(ctx, &pb.CancelRequest{Id: id})
+	if err != nil {
+		return nil, fmt.Errorf("Cancel(): %w", err)
+	}
+	return resp, nil
+}
+
+// DeniedByNodePolicy reports whether err is the agent refusing to run a
+// command because of its node's local policy, and if so which rule refused it.
+func DeniedByNodePolicy(err error) (string, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.PermissionDenied {
+		return "", false
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if ok && info.GetDomain() == pb.ErrorDomain && info.GetReason() == pb.ReasonNodePolicyDenied {
+			return info.GetMetadata()["rule"], true
+		}
+	}
+	return "", false
+}
+
+// FormatResult renders a result the way it is shown in events: the command
+// line followed by its output and, if it did not exit cleanly, why not.
+func FormatResult(command string, result *pb.CommandResult) string {
+	if result.GetOutcome() == pb.Outcome_OUTCOME_FAILED_TO_START {
+		return fmt.Sprintf("❯ %s\n<failed to start: %s>", command, result.GetSpawnError())
+	}
+
+	formattedOutput := strings.TrimRight(string(result.GetOutput()), "\r\n")
+	if result.GetEncoding() == pb.Encoding_ENCODING_BINARY {
+		formattedOutput = fmt.Sprintf("<%d bytes of binary output>", len(result.GetOutput()))
+	} else if strings.TrimSpace(formattedOutput) == "" {
 		formattedOutput = "<no output>"
 	}
+	if result.GetTruncated() {
+		formattedOutput += fmt.Sprintf("\n<output truncated: %d bytes dropped>", result.GetDroppedBytes())
+	}
 
-	output := fmt.Sprintf("❯ %s\n%s", req.Cmd, formattedOutput)
-	return output, nil
+	output := fmt.Sprintf("❯ %s\n%s", command, formattedOutput)
+	switch result.GetOutcome() {
+	case pb.Outcome_OUTCOME_TIMED_OUT:
+		output += "\n<timed out>"
+	case pb.Outcome_OUTCOME_CANCELLED:
+		output += "\n<cancelled>"
+	default:
+		if result.GetSignal() != "" {
+			output += fmt.Sprintf("\n<killed by %s>", result.GetSignal())
+		} else if result.GetExitCode() != 0 {
+			output += fmt.Sprintf("\n<exit code %d>", result.GetExitCode())
+		}
+	}
+	return output
 }
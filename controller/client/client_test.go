@@ -0,0 +1,25 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRPCTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want time.Duration
+	}{
+		{"agent's grace period", Options{Timeout: time.Minute}, time.Minute + agentGracePeriod + reportSlack},
+		{"own grace period", Options{Timeout: time.Minute, GracePeriod: 30 * time.Second}, time.Minute + 30*time.Second + reportSlack},
+		{"grace period longer than the slack", Options{Timeout: time.Second, GracePeriod: time.Minute}, time.Second + time.Minute + reportSlack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rpcTimeout(tt.opts); got != tt.want {
+				t.Errorf("rpcTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
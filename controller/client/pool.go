@@ -0,0 +1,231 @@
+package client
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+const (
+	// defaultKeepaliveTime is how long a connection may sit idle before it is
+	// pinged to check the agent is still there.
+	defaultKeepaliveTime = 30 * time.Second
+	// defaultKeepaliveTimeout is how long a ping may go unanswered before the
+	// connection is considered dead.
+	defaultKeepaliveTimeout = 10 * time.Second
+)
+
+// Pool keeps one long-lived connection per agent address so that fanning a
+// command out does not open a fresh connection to every node each time. The
+// zero value is ready to use with the default keepalive settings.
+type Pool struct {
+	// KeepaliveTime and KeepaliveTimeout tune the pings that notice an agent
+	// that went away without closing its connections.
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+	// Token, if set, is sent with every call made over TLS so that the
+	// agent can tell who is calling.
+	Token credentials.PerRPCCredentials
+
+	mu      sync.Mutex
+	tls     *tls.Config
+	conns   map[string]*pooledConn
+	dials   uint64
+	reuses  uint64
+	dropped uint64
+}
+
+// pooledConn is a connection along with how many calls are using it.
+type pooledConn struct {
+	*grpc.ClientConn
+	serverName string
+	users      int
+	// stale is set once the connection has left the pool; the last call
+	// using it closes it.
+	stale bool
+}
+
+// PoolStats describes the connections a Pool holds.
+type PoolStats struct {
+	// Open is how many connections are currently held.
+	Open int
+	// States counts the open connections by connectivity state.
+	States map[string]int
+	// Dials is how many connections have been opened.
+	Dials uint64
+	// Reuses is how many calls were served by a connection already open.
+	Reuses uint64
+	// Dropped is how many connections were closed because their agent went
+	// away or moved.
+	Dropped uint64
+}
+
+// acquire returns the connection to addr, opening one if there is none, and
+// a function to call once done with it. serverName, if set, is the name the
+// agent's certificate is checked against; a connection opened expecting a
+// different name is replaced.
+func (p *Pool) acquire(addr, serverName string) (*grpc.ClientConn, func(), error) {
+	p.mu.Lock()
+	var idle *grpc.ClientConn
+	defer func() {
+		p.mu.Unlock()
+		if idle != nil {
+			_ = idle.Close()
+		}
+	}()
+	if conn, ok := p.conns[addr]; ok {
+		if conn.serverName == serverName {
+			p.reuses++
+			conn.users++
+			return conn.ClientConn, func() { p.release(conn) }, nil
+		}
+		idle = p.drop(addr, conn)
+		p.dropped++
+	}
+
+	keepaliveTime, keepaliveTimeout := p.KeepaliveTime, p.KeepaliveTimeout
+	if keepaliveTime <= 0 {
+		keepaliveTime = defaultKeepaliveTime
+	}
+	if keepaliveTimeout <= 0 {
+		keepaliveTimeout = defaultKeepaliveTimeout
+	}
+	creds := insecure.NewCredentials()
+	if p.tls != nil {
+		creds = credentials.NewTLS(p.tls)
+	}
+	options := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                keepaliveTime,
+			Timeout:             keepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+	}
+	if serverName != "" {
+		options = append(options, grpc.WithAuthority(serverName))
+	}
+	if p.tls != nil && p.Token != nil {
+		options = append(options, grpc.WithPerRPCCredentials(p.Token))
+	}
+	conn, err := grpc.NewClient(addr, options...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("grpc.NewClient(): %w", err)
+	}
+	if p.conns == nil {
+		p.conns = map[string]*pooledConn{}
+	}
+	pc := &pooledConn{ClientConn: conn, serverName: serverName, users: 1}
+	p.conns[addr] = pc
+	p.dials++
+	return conn, func() { p.release(pc) }, nil
+}
+
+// release gives back a connection taken with acquire.
+func (p *Pool) release(conn *pooledConn) {
+	p.mu.Lock()
+	conn.users--
+	closeNow := conn.stale && conn.users == 0
+	p.mu.Unlock()
+	if closeNow {
+		_ = conn.Close()
+	}
+}
+
+// drop takes conn out of the pool, closing it unless calls are still using
+// it. p.mu must be held; the returned connection, if any, must be closed
+// once it is released.
+func (p *Pool) drop(addr string, conn *pooledConn) *grpc.ClientConn {
+	delete(p.conns, addr)
+	conn.stale = true
+	if conn.users > 0 {
+		return nil
+	}
+	return conn.ClientConn
+}
+
+// Retain closes the connections to every address not in addrs. It is called
+// with the agents' current endpoints, so a connection to an agent that was
+// removed, or whose pod came back with a new IP, is dropped and the next call
+// dials the new address.
+func (p *Pool) Retain(addrs map[string]bool) {
+	p.mu.Lock()
+	var idle []*grpc.ClientConn
+	for addr, conn := range p.conns {
+		if !addrs[addr] {
+			if c := p.drop(addr, conn); c != nil {
+				idle = append(idle, c)
+			}
+			p.dropped++
+		}
+	}
+	p.mu.Unlock()
+
+	// Calls still in flight keep their connection until they finish, so
+	// they are not cut off here.
+	for _, conn := range idle {
+		_ = conn.Close()
+	}
+}
+
+// SetTLS makes new connections use TLS configured by config, or plaintext if
+// config is nil. Connections already open are closed once the calls using
+// them finish.
+func (p *Pool) SetTLS(config *tls.Config) {
+	p.mu.Lock()
+	p.tls = config
+	p.mu.Unlock()
+	p.Close()
+}
+
+// Close closes every connection in the pool once the calls using it finish.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	var idle []*grpc.ClientConn
+	for addr, conn := range p.conns {
+		if c := p.drop(addr, conn); c != nil {
+			idle = append(idle, c)
+		}
+	}
+	p.mu.Unlock()
+	for _, conn := range idle {
+		_ = conn.Close()
+	}
+}
+
+// dial returns a connection to addr taken from pool, along with a function to
+// call when done with it. Without a pool the connection is opened for this
+// call alone and closed again when it is released.
+func dial(pool *Pool, addr, serverName string) (*grpc.ClientConn, func(), error) {
+	if pool != nil {
+		return pool.acquire(addr, serverName)
+	}
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("grpc.NewClient(): %w", err)
+	}
+	return conn, func() { _ = conn.Close() }, nil
+}
+
+// Stats reports what the pool currently holds.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := PoolStats{
+		Open:    len(p.conns),
+		States:  map[string]int{},
+		Dials:   p.dials,
+		Reuses:  p.reuses,
+		Dropped: p.dropped,
+	}
+	for _, conn := range p.conns {
+		stats.States[conn.GetState().String()]++
+	}
+	return stats
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestPoolAcquire(t *testing.T) {
+	tests := []struct {
+		name string
+		// second is the address and server name of the second acquire,
+		// after one for "10.0.0.1:50051" and "node-1".
+		addr, serverName string
+		wantReuses       uint64
+		// wantClosed is whether the first connection is closed by the
+		// second acquire.
+		wantClosed bool
+	}{
+		{"same agent", "10.0.0.1:50051", "node-1", 1, false},
+		{"other agent", "10.0.0.2:50051", "node-2", 0, false},
+		{"same address, other node", "10.0.0.1:50051", "node-2", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Pool
+			defer p.Close()
+			first, release, err := p.acquire("10.0.0.1:50051", "node-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+			second, release, err := p.acquire(tt.addr, tt.serverName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+			if reused := first == second; reused != (tt.wantReuses > 0) {
+				t.Errorf("reused = %v, want %v", reused, tt.wantReuses > 0)
+			}
+			if stats := p.Stats(); stats.Reuses != tt.wantReuses || stats.Dials != 2-tt.wantReuses {
+				t.Errorf("Stats() = %+v, want %d reuses", stats, tt.wantReuses)
+			}
+			if closed := first.GetState() == connectivity.Shutdown; closed != tt.wantClosed {
+				t.Errorf("first connection closed = %v, want %v", closed, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestPoolRetain(t *testing.T) {
+	var p Pool
+	defer p.Close()
+	idle, release, err := p.acquire("10.0.0.1:50051", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	busy, releaseBusy, err := p.acquire("10.0.0.2:50051", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, releaseKept, err := p.acquire("10.0.0.3:50051", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseKept()
+
+	p.Retain(map[string]bool{"10.0.0.3:50051": true})
+	if stats := p.Stats(); stats.Open != 1 || stats.Dropped != 2 {
+		t.Errorf("Stats() = %+v, want 1 open and 2 dropped", stats)
+	}
+	if idle.GetState() != connectivity.Shutdown {
+		t.Errorf("idle connection to a removed agent is %s, want closed", idle.GetState())
+	}
+	// A call in flight keeps its connection until it finishes.
+	if busy.GetState() == connectivity.Shutdown {
+		t.Error("connection in use was closed")
+	}
+	releaseBusy()
+	if busy.GetState() != connectivity.Shutdown {
+		t.Errorf("stale connection is %s once released, want closed", busy.GetState())
+	}
+	if kept.GetState() == connectivity.Shutdown {
+		t.Error("connection to a current agent was closed")
+	}
+}
+
+func TestPoolSetTLS(t *testing.T) {
+	var p Pool
+	defer p.Close()
+	conns := map[string]*grpc.ClientConn{}
+	releases := map[string]func(){}
+	for _, addr := range []string{"10.0.0.1:50051", "10.0.0.2:50051"} {
+		conn, release, err := p.acquire(addr, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns[addr], releases[addr] = conn, release
+	}
+	releases["10.0.0.1:50051"]()
+
+	p.SetTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	if conns["10.0.0.1:50051"].GetState() != connectivity.Shutdown {
+		t.Error("idle connection kept after a TLS change")
+	}
+	if conns["10.0.0.2:50051"].GetState() == connectivity.Shutdown {
+		t.Error("connection in use closed by a TLS change")
+	}
+	releases["10.0.0.2:50051"]()
+	if conns["10.0.0.2:50051"].GetState() != connectivity.Shutdown {
+		t.Error("stale connection kept once released")
+	}
+
+	conn, release, err := p.acquire("10.0.0.2:50051", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if conn == conns["10.0.0.2:50051"] {
+		t.Error("stale connection handed out after a TLS change")
+	}
+	if stats := p.Stats(); stats.Open != 1 || stats.Dials != 3 {
+		t.Errorf("Stats() = %+v, want 1 open and 3 dials", stats)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+)
+
+// RetryPolicy says when a command is tried again.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt. Zero or one means no retries.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt. It doubles with every
+	// attempt after that, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// RetryTransport retries when the agent could not be reached or the
+	// connection broke. The retry carries the same execution ID, so an agent
+	// that already ran the command returns its result instead of running it
+	// again.
+	RetryTransport bool
+	// RetryNonZeroExit runs the command again when it exits non-zero. Each
+	// re-run gets its own execution ID.
+	RetryNonZeroExit bool
+}
+
+// backoff returns the wait before attempt, counting from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d, ceiling := p.Backoff, p.MaxBackoff
+	if d <= 0 {
+		d = defaultBackoff
+	}
+	if ceiling <= 0 {
+		ceiling = defaultMaxBackoff
+	}
+	for i := 2; i < attempt && d < ceiling; i++ {
+		d *= 2
+	}
+	return min(d, ceiling)
+}
+
+// isTransportError reports whether err means the agent could not be reached or
+// the call broke off, rather than the caller giving up.
+func isTransportError(err error) bool {
+	if errors.Is(err, errStreamClosed) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// exitedNonZero reports whether the command ran to completion and failed.
+func exitedNonZero(result *pb.CommandResult) bool {
+	return result.GetOutcome() == pb.Outcome_OUTCOME_COMPLETED && result.GetExitCode() != 0
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
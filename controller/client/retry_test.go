@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"defaults, second attempt", RetryPolicy{}, 2, defaultBackoff},
+		{"defaults, third attempt", RetryPolicy{}, 3, 2 * defaultBackoff},
+		{"defaults, capped", RetryPolicy{}, 20, defaultMaxBackoff},
+		{"doubles", RetryPolicy{Backoff: time.Second, MaxBackoff: time.Hour}, 5, 8 * time.Second},
+		{"capped", RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 5, 5 * time.Second},
+		{"backoff above the cap", RetryPolicy{Backoff: time.Minute, MaxBackoff: time.Second}, 2, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.backoff(tt.attempt); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransportError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.Unavailable, "connection refused"), true},
+		{status.Error(codes.Aborted, "aborted"), true},
+		{status.Error(codes.ResourceExhausted, "too many"), false},
+		{status.Error(codes.AlreadyExists, "exists"), false},
+		{fmt.Errorf("node-1: %w", errStreamClosed), true},
+		{status.Error(codes.Canceled, "caller gave up"), false},
+		{status.Error(codes.DeadlineExceeded, "timed out"), false},
+		{status.Error(codes.PermissionDenied, "node policy"), false},
+		{status.Error(codes.FailedPrecondition, "reused id"), false},
+		{context.Canceled, false},
+		{errors.New("something else"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransportError(tt.err); got != tt.want {
+			t.Errorf("isTransportError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
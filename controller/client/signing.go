@@ -0,0 +1,45 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// signatureLifetime is how long a signed request is accepted for. It only
+// has to cover the trip to the agent: every attempt is signed afresh.
+const signatureLifetime = time.Minute
+
+// nonceBytes is the length of the random nonce in each signature.
+const nonceBytes = 16
+
+// Signer signs requests so that agents can tell the controller sent them,
+// and that nothing in them changed on the way.
+type Signer struct {
+	// KeyID names Key among the public keys published to agents.
+	KeyID string
+	Key   ed25519.PrivateKey
+}
+
+// sign signs req for node, on behalf of the Command with UID commandUID.
+func (s *Signer) sign(req *pb.CommandRequest, node, commandUID string) error {
+	nonce := make([]byte, nonceBytes)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generating nonce: %w", err)
+	}
+	now := time.Now()
+	req.Signature = &pb.RequestSignature{
+		KeyID:      s.KeyID,
+		Node:       node,
+		Nonce:      nonce,
+		ExpiresAt:  timestamppb.New(now.Add(signatureLifetime)),
+		CommandUID: commandUID,
+		IssuedAt:   timestamppb.New(now),
+	}
+	req.Signature.Signature = ed25519.Sign(s.Key, pb.SigningPayload(req))
+	return nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenReloadInterval is how often a TokenFile is read again. The kubelet
+// replaces projected tokens well before they expire, so a token is never
+// used long after it has been rotated.
+const tokenReloadInterval = time.Minute
+
+// TokenFile sends the bearer token kept in a file, such as a projected
+// ServiceAccount token, with every call to an agent. The agent checks it with
+// a TokenReview. It is only sent over TLS.
+type TokenFile struct {
+	Path string
+
+	mu     sync.Mutex
+	token  string
+	loaded time.Time
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (t *TokenFile) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" || time.Since(t.loaded) > tokenReloadInterval {
+		data, err := os.ReadFile(t.Path)
+		if err != nil {
+			if t.token == "" {
+				return nil, fmt.Errorf("reading agent token: %w", err)
+			}
+			// Keep using the last token until the file is back.
+		} else {
+			t.token, t.loaded = strings.TrimSpace(string(data)), time.Now()
+		}
+	}
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (t *TokenFile) RequireTransportSecurity() bool {
+	return true
+}
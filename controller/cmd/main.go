@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"os"
@@ -26,10 +27,14 @@ import (
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	k8scorev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
@@ -39,6 +44,7 @@ import (
 	corev1 "github.com/motilayo/jarvis/controller/api/v1"
 	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
 	"github.com/motilayo/jarvis/controller/internal/controller"
+	webhookv1 "github.com/motilayo/jarvis/controller/internal/webhook/v1"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -64,6 +70,8 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var maxConcurrentExecutions, maxExecutionsPerNode int
+	var caNamespace, agentTokenFile string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -82,6 +90,16 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&maxConcurrentExecutions, "max-concurrent-executions", 100,
+		"How many node executions may run at once across all Commands, unless the JarvisConfig says otherwise.")
+	flag.IntVar(&maxExecutionsPerNode, "max-executions-per-node", 4,
+		"How many node executions may run at once on any one node, unless the JarvisConfig says otherwise.")
+	flag.StringVar(&caNamespace, "ca-namespace", controller.DefaultCANamespace,
+		"The namespace holding the CA that signs agent certificates in Managed TLS mode, and the key requests to agents are signed with. "+
+			"It must not be the agent namespace.")
+	flag.StringVar(&agentTokenFile, "agent-token-file", "/var/run/secrets/jarvis/token",
+		"A ServiceAccount token with the jarvis-agent audience, sent to agents to authenticate the controller. "+
+			"Empty sends none.")
 	opts := zap.Options{
 		Development: false,
 	}
@@ -164,6 +182,19 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "6b8a5c4b.jarvis.io",
+		// Only the Secrets and ConfigMaps the controller manages are cached;
+		// others, such as TLS material provided for agents, are read when
+		// needed.
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				&k8scorev1.Secret{}: {
+					Label: labels.SelectorFromSet(labels.Set{controller.ManagedByLabel: controller.ManagedByValue}),
+				},
+				&k8scorev1.ConfigMap{}: {
+					Label: labels.SelectorFromSet(labels.Set{controller.ManagedByLabel: controller.ManagedByValue}),
+				},
+			},
+		},
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -181,13 +212,83 @@ func main() {
 		os.Exit(1)
 	}
 
+	config := &controller.ConfigStore{
+		MaxConcurrentExecutions: maxConcurrentExecutions,
+		MaxExecutionsPerNode:    maxExecutionsPerNode,
+	}
 	if err := (&controller.CommandReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		Config:         config,
+		AgentTokenFile: agentTokenFile,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Command")
+		os.Exit(1)
+	}
+	if err := (&controller.CronCommandReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Command")
+		setupLog.Error(err, "unable to create controller", "controller", "CronCommand")
+		os.Exit(1)
+	}
+	if err := (&controller.JarvisConfigReconciler{
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
+		Config:    config,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "JarvisConfig")
+		os.Exit(1)
+	}
+	if err := (&controller.AgentCertificateReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Config:      config,
+		CANamespace: caNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AgentCertificate")
 		os.Exit(1)
 	}
+	if err := (&controller.SigningKeyReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Config:      config,
+		CANamespace: caNamespace,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SigningKey")
+		os.Exit(1)
+	}
+	// nolint:goconst
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		// The webhooks trust the creator the controller records on the
+		// Commands it creates for a CronCommand.
+		controllerUser, err := webhookv1.ControllerUser(context.Background(), mgr.GetClient())
+		if err != nil {
+			setupLog.Error(err, "unable to determine the controller's own user")
+			os.Exit(1)
+		}
+		if err := webhookv1.SetupCommandWebhookWithManager(mgr, controllerUser); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Command")
+			os.Exit(1)
+		}
+		if err := webhookv1.SetupCronCommandWebhookWithManager(mgr, controllerUser); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CronCommand")
+			os.Exit(1)
+		}
+		if err := webhookv1.SetupCommandPolicyWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CommandPolicy")
+			os.Exit(1)
+		}
+		if err := webhookv1.SetupClusterCommandPolicyWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterCommandPolicy")
+			os.Exit(1)
+		}
+		if err := webhookv1.SetupCommandApprovalWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "CommandApproval")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,146 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	"github.com/motilayo/jarvis/controller/internal/policy"
+)
+
+// +kubebuilder:rbac:groups=jarvis.io,resources=commandapprovals,verbs=get;list;watch
+
+// approvalsRequired is how many approvals cmd needs before it runs, and what
+// asks for them. It is 0 if cmd needs none.
+func approvalsRequired(cmd *jarvisiov1.Command, policies policy.Set) (int, string) {
+	required, by := policies.RequiredApprovals(cmd.Labels, cmd.Spec.Command)
+	if a := cmd.Spec.Approval; a != nil && max(int(a.Approvals), 1) > required {
+		required, by = max(int(a.Approvals), 1), "spec.approval"
+	}
+	return required, by
+}
+
+// approvers returns the users whose approval of cmd's current generation
+// holds now, and when the first of those approvals lapses.
+func (r *CommandReconciler) approvers(ctx context.Context, cmd *jarvisiov1.Command) ([]string, time.Time, error) {
+	approvals := &jarvisiov1.CommandApprovalList{}
+	if err := r.List(ctx, approvals, client.InNamespace(cmd.Namespace)); err != nil {
+		return nil, time.Time{}, fmt.Errorf("listing CommandApprovals: %w", err)
+	}
+	var users []string
+	var lapses time.Time
+	now := time.Now()
+	for _, approval := range approvals.Items {
+		spec := approval.Spec
+		if spec.Command != cmd.Name || spec.CommandUID != cmd.UID || spec.CommandGeneration != cmd.Generation {
+			continue
+		}
+		if spec.ApprovedBy == nil || spec.ExpiresAt == nil || !spec.ExpiresAt.After(now) {
+			continue
+		}
+		// Two people: the creator's own approval never counts.
+		if cmd.Spec.CreatedBy == nil || spec.ApprovedBy.Username == cmd.Spec.CreatedBy.Username {
+			continue
+		}
+		if !slices.Contains(users, spec.ApprovedBy.Username) {
+			users = append(users, spec.ApprovedBy.Username)
+		}
+		if lapses.IsZero() || spec.ExpiresAt.Time.Before(lapses) {
+			lapses = spec.ExpiresAt.Time
+		}
+	}
+	slices.Sort(users)
+	return users, lapses, nil
+}
+
+// awaitApproval reports whether cmd has to wait for approval before its next
+// run, keeping the Approved condition up to date. While it waits, it also
+// returns when to look again because an approval lapses.
+func (r *CommandReconciler) awaitApproval(ctx context.Context, cmd *jarvisiov1.Command, policies policy.Set) (bool, time.Duration, error) {
+	required, by := approvalsRequired(cmd, policies)
+	if required == 0 {
+		return false, 0, nil
+	}
+	users, lapses, err := r.approvers(ctx, cmd)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to check approvals")
+		return false, 0, err
+	}
+	if len(users) >= required {
+		// startRun records the condition along with the new run.
+		meta.SetStatusCondition(&cmd.Status.Conditions, metav1.Condition{
+			Type:               jarvisiov1.ConditionApproved,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonApproved,
+			Message:            "approved by " + strings.Join(users, ", "),
+			ObservedGeneration: cmd.Generation,
+		})
+		r.Recorder.Eventf(cmd, corev1.EventTypeNormal, reasonApproved, "Approved by %s", strings.Join(users, ", "))
+		return false, 0, nil
+	}
+
+	creator := "its creator"
+	if cmd.Spec.CreatedBy != nil {
+		creator = cmd.Spec.CreatedBy.Username
+	}
+	msg := fmt.Sprintf("%s requires %d approvals from users other than %s; %d so far", by, required, creator, len(users))
+	if len(users) > 0 {
+		msg += " (" + strings.Join(users, ", ") + ")"
+	}
+	before := cmd.Status.DeepCopy()
+	cmd.Status.ObservedGeneration = cmd.Generation
+	meta.SetStatusCondition(&cmd.Status.Conditions, metav1.Condition{
+		Type:               jarvisiov1.ConditionApproved,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonPendingApproval,
+		Message:            msg,
+		ObservedGeneration: cmd.Generation,
+	})
+	if !equality.Semantic.DeepEqual(before, &cmd.Status) {
+		if err := r.Status().Update(ctx, cmd); err != nil {
+			return true, 0, err
+		}
+	}
+	var wait time.Duration
+	if !lapses.IsZero() {
+		wait = time.Until(lapses)
+	}
+	return true, wait, nil
+}
+
+// commandForApproval maps a CommandApproval onto the Command it approves.
+func (r *CommandReconciler) commandForApproval(_ context.Context, obj client.Object) []reconcile.Request {
+	approval, ok := obj.(*jarvisiov1.CommandApproval)
+	if !ok || approval.Spec.Command == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: approval.Namespace, Name: approval.Spec.Command}}}
+}
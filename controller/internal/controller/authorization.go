@@ -0,0 +1,141 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// execSubresource is the virtual node subresource a user needs "create" on
+// to run commands there. The agents check the controller against it; the
+// controller checks each Command's creator.
+const execSubresource = "jarvis-exec"
+
+// execRWSubresource is the one a user needs "create" on instead to run
+// ReadWrite commands, which can change the node.
+const execRWSubresource = "jarvis-exec-rw"
+
+// subresourceFor returns the subresource cmd's creator needs "create" on.
+func subresourceFor(cmd *jarvisiov1.Command) string {
+	if cmd.Spec.Privilege == jarvisiov1.PrivilegeReadWrite {
+		return execRWSubresource
+	}
+	return execSubresource
+}
+
+// forbiddenNodes returns the nodes cmd's creator may not run commands on,
+// with the reason for each.
+func (r *CommandReconciler) forbiddenNodes(ctx context.Context, cmd *jarvisiov1.Command, nodes []corev1.Node) (map[string]string, error) {
+	forbidden := map[string]string{}
+	user := cmd.Spec.CreatedBy
+	if user == nil {
+		for _, node := range nodes {
+			forbidden[node.Name] = "the Command has no recorded creator; is the admission webhook installed?"
+		}
+		return forbidden, nil
+	}
+	if len(nodes) == 0 {
+		return forbidden, nil
+	}
+
+	// One review settles it for a user allowed on every node.
+	allowed, _, err := r.canExec(ctx, cmd, "")
+	if err != nil || allowed {
+		return forbidden, err
+	}
+	for _, node := range nodes {
+		allowed, reason, err := r.canExec(ctx, cmd, node.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			msg := fmt.Sprintf("%s may not create nodes/%s on %s", user.Username, subresourceFor(cmd), node.Name)
+			if reason != "" {
+				msg += ": " + reason
+			}
+			forbidden[node.Name] = msg
+		}
+	}
+	return forbidden, nil
+}
+
+// canExec asks whether cmd's creator may run commands on node, or on every
+// node if node is empty.
+func (r *CommandReconciler) canExec(ctx context.Context, cmd *jarvisiov1.Command, node string) (bool, string, error) {
+	user := cmd.Spec.CreatedBy
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:        "create",
+				Resource:    "nodes",
+				Subresource: subresourceFor(cmd),
+				Name:        node,
+			},
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+		},
+	}
+	if err := r.Create(ctx, review); err != nil {
+		return false, "", fmt.Errorf("SubjectAccessReview for %s on %q: %w", user.Username, node, err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
+
+// skipForbidden returns the nodes cmd's creator may run commands on. Each
+// of the others is passed to skip as a Skipped result.
+func (r *CommandReconciler) skipForbidden(ctx context.Context, cmd *jarvisiov1.Command, nodes []corev1.Node,
+	skip func(jarvisiov1.CommandResult)) ([]corev1.Node, error) {
+	forbidden, err := r.forbiddenNodes(ctx, cmd, nodes)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to check the creator's access to nodes")
+		return nil, err
+	}
+	if len(forbidden) == 0 {
+		return nodes, nil
+	}
+	allowed := nodes[:0:0]
+	for _, node := range nodes {
+		msg, ok := forbidden[node.Name]
+		if !ok {
+			allowed = append(allowed, node)
+			continue
+		}
+		skip(jarvisiov1.CommandResult{
+			Node:       node.Name,
+			Phase:      jarvisiov1.NodeSkipped,
+			Reason:     reasonForbidden,
+			Message:    msg,
+			Generation: cmd.Status.RunGeneration,
+		})
+	}
+	r.Recorder.Event(cmd, corev1.EventTypeWarning, reasonForbidden,
+		fmt.Sprintf("Skipped %d of %d nodes the creator may not run commands on", len(forbidden), len(nodes)))
+	return allowed, nil
+}
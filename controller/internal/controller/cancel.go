@@ -0,0 +1,166 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	grpcClient "github.com/motilayo/jarvis/controller/client"
+)
+
+const (
+	// cancelTimeout bounds how long a deleted Command keeps its finalizer
+	// while waiting for its executions to stop.
+	cancelTimeout = time.Minute
+	// cancelCallTimeout bounds each attempt to cancel on, and hear back
+	// from, the agents.
+	cancelCallTimeout = 10 * time.Second
+	// cancelRetryInterval is how soon an unconfirmed cancellation is retried.
+	cancelRetryInterval = 5 * time.Second
+)
+
+// executionID names the execution of one generation of a Command on one node.
+// The agent uses it to find the process when asked to cancel it.
+func executionID(uid types.UID, generation int64, node string) string {
+	return fmt.Sprintf("%s/%d/%s", uid, generation, node)
+}
+
+// inflight tracks the fan-outs still running for each Command so they can be
+// cancelled when it is deleted. The zero value is ready to use.
+type inflight struct {
+	mu   sync.Mutex
+	runs map[types.UID]*activeRun
+}
+
+type activeRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	count  int
+	idle   chan struct{}
+}
+
+// begin registers a fan-out for uid. It returns the context the fan-out must
+// run under and a function to call once it is done.
+func (f *inflight) begin(uid types.UID) (context.Context, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.runs == nil {
+		f.runs = map[types.UID]*activeRun{}
+	}
+	run, ok := f.runs[uid]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		run = &activeRun{ctx: ctx, cancel: cancel, idle: make(chan struct{})}
+		f.runs[uid] = run
+	}
+	run.count++
+
+	return run.ctx, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		run.count--
+		if run.count == 0 {
+			delete(f.runs, uid)
+			run.cancel()
+			close(run.idle)
+		}
+	}
+}
+
+// stop cancels every fan-out for uid. The returned channel is closed once they
+// have all returned.
+func (f *inflight) stop(uid types.UID) <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	run, ok := f.runs[uid]
+	if !ok {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	run.cancel()
+	return run.idle
+}
+
+// cancelExecutions stops everything still running for cmd: it cancels this
+// process's RPCs and asks the agent on every node that has not reported back
+// to kill the command, in case the RPC that started it belonged to an earlier
+// controller. It reports whether every execution is confirmed stopped.
+func (r *CommandReconciler) cancelExecutions(ctx context.Context, cmd *jarvisiov1.Command) bool {
+	log := logf.FromContext(ctx)
+	idle := r.inflight.stop(cmd.UID)
+
+	ctx, cancel := context.WithTimeout(ctx, cancelCallTimeout)
+	defer cancel()
+
+	var outstanding []jarvisiov1.CommandResult
+	for _, result := range cmd.Status.Results {
+		if result.Phase == jarvisiov1.NodePending || result.Phase == jarvisiov1.NodeRunning {
+			outstanding = append(outstanding, result)
+		}
+	}
+
+	var confirmed atomic.Bool
+	confirmed.Store(true)
+	if len(outstanding) > 0 {
+		agents, err := r.agentAddresses(ctx)
+		if err != nil {
+			return false
+		}
+		config := r.Config.Get()
+		var wg sync.WaitGroup
+		for _, result := range outstanding {
+			addr := agents[result.Node]
+			if addr == "" {
+				// The agent is gone, and the command went with it.
+				continue
+			}
+			id := executionID(cmd.UID, result.Generation, result.Node)
+			wg.Go(func() {
+				resp, err := grpcClient.CancelCommandOnNode(ctx, &r.pool, addr, config.serverName(result.Node), id)
+				if err != nil {
+					log.Error(err, "failed to cancel command", "node", result.Node, "id", id)
+					confirmed.Store(false)
+					return
+				}
+				if resp.GetFound() && !resp.GetStopped() {
+					log.Info("command has not stopped yet", "node", result.Node, "id", id)
+					confirmed.Store(false)
+					return
+				}
+				log.Info("command cancelled on agent", "node", result.Node, "id", id, "found", resp.GetFound())
+			})
+		}
+		wg.Wait()
+	}
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		log.Info("executions still winding down")
+		return false
+	}
+	return confirmed.Load()
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+)
+
+// closed reports whether ch is closed, or closes within a short while.
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(50 * time.Millisecond):
+		return false
+	}
+}
+
+func TestInflight(t *testing.T) {
+	var f inflight
+	if !closed(f.stop("uid")) {
+		t.Fatal("stop() without fan-outs does not report them stopped")
+	}
+
+	first, done1 := f.begin("uid")
+	second, done2 := f.begin("uid")
+	other, doneOther := f.begin("other")
+	defer doneOther()
+	if first != second {
+		t.Error("fan-outs for one Command run under different contexts")
+	}
+
+	idle := f.stop("uid")
+	if first.Err() == nil {
+		t.Error("stop() did not cancel the fan-outs")
+	}
+	if other.Err() != nil {
+		t.Error("stop() cancelled another Command's fan-out")
+	}
+	done1()
+	if closed(idle) {
+		t.Error("stop() reported idle with a fan-out still running")
+	}
+	done2()
+	if !closed(idle) {
+		t.Error("stop() not reported idle once every fan-out returned")
+	}
+
+	// The next fan-out for the Command starts afresh.
+	ctx, done := f.begin("uid")
+	defer done()
+	if ctx.Err() != nil {
+		t.Error("fan-out begun after stop() is already cancelled")
+	}
+}
+
+func TestInflightDoneReleases(t *testing.T) {
+	var f inflight
+	ctx, done := f.begin("uid")
+	done()
+	if ctx.Err() == nil {
+		t.Error("context not released once the fan-out is done")
+	}
+	if len(f.runs) != 0 {
+		t.Errorf("%d runs kept after every fan-out is done", len(f.runs))
+	}
+}
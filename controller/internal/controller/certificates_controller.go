@@ -0,0 +1,452 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	"github.com/motilayo/jarvis/controller/internal/pki"
+)
+
+const (
+	// caSecretName is the Secret holding the CA: tls.crt and tls.key are the
+	// current CA, ca.crt every CA still trusted.
+	caSecretName = "jarvis-ca"
+	// DefaultCANamespace is where the CA Secret is kept unless told
+	// otherwise. It must not be the agent namespace.
+	DefaultCANamespace = "jarvis-system"
+	// caBundleConfigMapName is the ConfigMap in the agent namespace that
+	// publishes, as ca.crt, every CA still trusted, for the agents to check
+	// the controller's certificate against.
+	caBundleConfigMapName = "jarvis-ca-bundle"
+	// AgentSignerName is the signer agents ask for their serving
+	// certificates from, with CertificateSigningRequests.
+	AgentSignerName = "jarvis.io/agent"
+	// agentServiceAccount is the ServiceAccount the agents run as. Only it
+	// may ask for agent certificates.
+	agentServiceAccount = "jarvis-agent"
+	// nodeNameExtra is the user extra the API server records the node of a
+	// pod-bound ServiceAccount token under. It ties a request to the node
+	// it came from, as all agents share one ServiceAccount.
+	nodeNameExtra = "authentication.kubernetes.io/node-name"
+	// ManagedByLabel marks the Secrets the controller manages; it only
+	// caches Secrets carrying it.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "jarvis-controller"
+	// legacySecretPrefix starts the name of the Secrets agent certificates
+	// and keys were once handed out in, which every agent could read.
+	legacySecretPrefix = "jarvis-agent-"
+	// minCALifetime is the least a CA is issued for; it outlives the
+	// certificates it signs several times over.
+	minCALifetime = 365 * 24 * time.Hour
+)
+
+// AgentCertificateReconciler runs the CA used in Managed TLS mode. It signs
+// the certificate each node's agent asks for with a CertificateSigningRequest,
+// provided the request came from the agent on that node, publishes the CAs
+// for the agents to trust, issues the controller's own client certificate,
+// and replaces the CA and the client certificate before they expire. Agents
+// keep their private keys to themselves and renew their own certificates.
+type AgentCertificateReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Config *ConfigStore
+	// CANamespace is where the CA Secret is kept; it is created if missing.
+	CANamespace string
+
+	mu         sync.Mutex
+	ca         *corev1.Secret
+	clientCert *tls.Certificate
+	clientLeaf *x509.Certificate
+	resync     chan event.GenericEvent
+}
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=create
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=certificatesigningrequests/approval;certificatesigningrequests/status,verbs=update
+// +kubebuilder:rbac:groups=certificates.k8s.io,resources=signers,resourceNames=jarvis.io/agent,verbs=approve;sign
+func (r *AgentCertificateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	config := r.Config.Get()
+	if config.TLSMode != jarvisiov1.TLSManaged {
+		return ctrl.Result{}, nil
+	}
+	if config.AgentNamespace == r.caNamespace() {
+		// Whoever may read the agent namespace could take the CA's key
+		// and pass themselves off as the controller.
+		log.Error(nil, "Not issuing certificates: the CA namespace is the agent namespace", "namespace", config.AgentNamespace)
+		return ctrl.Result{}, nil
+	}
+
+	ca, bundle, err := r.authority(ctx, config)
+	if err != nil {
+		log.Error(err, "Unable to load the CA")
+		return ctrl.Result{}, err
+	}
+	// Published before the controller's certificate from a new CA is used,
+	// so that agents trust it by then.
+	if err := r.publishBundle(ctx, config.AgentNamespace, bundle); err != nil {
+		log.Error(err, "Unable to publish the CA bundle")
+		return ctrl.Result{}, err
+	}
+	clientRenewAt, err := r.ensureClientCertificate(ca, bundle, config)
+	if err != nil {
+		log.Error(err, "Unable to issue the controller's certificate")
+		return ctrl.Result{}, err
+	}
+	result := ctrl.Result{RequeueAfter: max(time.Until(minTime(pki.RenewAt(ca.Cert), clientRenewAt)), time.Minute)}
+	if req.Name == "" {
+		return result, r.removeLegacySecrets(ctx, config.AgentNamespace)
+	}
+
+	csr := &certificatesv1.CertificateSigningRequest{}
+	if err := r.Get(ctx, req.NamespacedName, csr); err != nil {
+		return result, client.IgnoreNotFound(err)
+	}
+	if csr.Spec.SignerName != AgentSignerName || len(csr.Status.Certificate) > 0 ||
+		csrCondition(csr, certificatesv1.CertificateDenied) || csrCondition(csr, certificatesv1.CertificateFailed) {
+		return result, nil
+	}
+	node, request, err := agentRequest(csr, config.AgentNamespace)
+	if err != nil {
+		if csrCondition(csr, certificatesv1.CertificateApproved) {
+			// Approved by someone else, but not ours to sign.
+			log.Info("Not signing approved agent certificate request", "csr", csr.Name, "reason", err.Error())
+			return result, nil
+		}
+		log.Info("Denying agent certificate request", "csr", csr.Name, "user", csr.Spec.Username, "reason", err.Error())
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateDenied,
+			Status:  corev1.ConditionTrue,
+			Reason:  "NotFromAgent",
+			Message: err.Error(),
+		})
+		return result, r.SubResource("approval").Update(ctx, csr)
+	}
+	if !csrCondition(csr, certificatesv1.CertificateApproved) {
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateApproved,
+			Status:  corev1.ConditionTrue,
+			Reason:  "AgentOnNode",
+			Message: fmt.Sprintf("requested by the agent on node %s", node),
+		})
+		if err := r.SubResource("approval").Update(ctx, csr); err != nil {
+			return result, err
+		}
+	}
+	certPEM, err := ca.SignAgent(node, request.PublicKey, config.CertificateLifetime)
+	if err != nil {
+		return result, err
+	}
+	csr.Status.Certificate = certPEM
+	if err := r.Status().Update(ctx, csr); err != nil {
+		log.Error(err, "Failed to save agent certificate", "csr", csr.Name, "node", node)
+		return result, err
+	}
+	log.Info("Issued agent certificate", "csr", csr.Name, "node", node)
+	return result, nil
+}
+
+// agentRequest checks that csr was made by the agent on the node it asks a
+// certificate for, and returns the node and the parsed request.
+func agentRequest(csr *certificatesv1.CertificateSigningRequest, agentNamespace string) (string, *x509.CertificateRequest, error) {
+	if want := serviceaccount.MakeUsername(agentNamespace, agentServiceAccount); csr.Spec.Username != want {
+		return "", nil, fmt.Errorf("requested by %s, not %s", csr.Spec.Username, want)
+	}
+	nodes := csr.Spec.Extra[nodeNameExtra]
+	if len(nodes) != 1 || nodes[0] == "" {
+		return "", nil, fmt.Errorf("the requester's token is not bound to a node; it needs the %s extra", nodeNameExtra)
+	}
+	node := nodes[0]
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return "", nil, errors.New("no CERTIFICATE REQUEST block")
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := request.CheckSignature(); err != nil {
+		return "", nil, err
+	}
+	if request.Subject.CommonName != node || !slices.Equal(request.DNSNames, []string{node}) ||
+		len(request.IPAddresses) > 0 || len(request.EmailAddresses) > 0 || len(request.URIs) > 0 {
+		return "", nil, fmt.Errorf("asks for names other than node %s, which the requester runs on", node)
+	}
+	return node, request, nil
+}
+
+// csrCondition reports whether csr has a condition of type t.
+func csrCondition(csr *certificatesv1.CertificateSigningRequest, t certificatesv1.RequestConditionType) bool {
+	for _, c := range csr.Status.Conditions {
+		if c.Type == t && c.Status != corev1.ConditionFalse {
+			return true
+		}
+	}
+	return false
+}
+
+// publishBundle makes bundle the CAs the agents in namespace trust.
+func (r *AgentCertificateReconciler) publishBundle(ctx context.Context, namespace string, bundle []byte) error {
+	cm := &corev1.ConfigMap{}
+	name := types.NamespacedName{Namespace: namespace, Name: caBundleConfigMapName}
+	err := r.Get(ctx, name, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && cm.Data["ca.crt"] == string(bundle) {
+		return nil
+	}
+	logf.FromContext(ctx).Info("Publishing CA bundle", "configMap", name)
+	cm.Namespace, cm.Name = name.Namespace, name.Name
+	cm.Labels = map[string]string{ManagedByLabel: ManagedByValue}
+	cm.Data = map[string]string{"ca.crt": string(bundle)}
+	if cm.ResourceVersion == "" {
+		return r.Create(ctx, cm)
+	}
+	return r.Update(ctx, cm)
+}
+
+// removeLegacySecrets deletes the Secrets in namespace that agent keys were
+// handed out in before agents came to make their own.
+func (r *AgentCertificateReconciler) removeLegacySecrets(ctx context.Context, namespace string) error {
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, client.InNamespace(namespace), client.MatchingLabels{ManagedByLabel: ManagedByValue}); err != nil {
+		return err
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if !strings.HasPrefix(secret.Name, legacySecretPrefix) {
+			continue
+		}
+		logf.FromContext(ctx).Info("Deleting legacy agent Secret", "secret", client.ObjectKeyFromObject(secret))
+		if err := r.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// authority loads the CA from its Secret, creating it the first time and
+// replacing it once it is due for renewal. It returns the CA along with the
+// bundle of every CA still trusted.
+func (r *AgentCertificateReconciler) authority(ctx context.Context, config Config) (*pki.Authority, []byte, error) {
+	log := logf.FromContext(ctx)
+	lifetime := max(minCALifetime, 3*config.CertificateLifetime)
+
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: r.caNamespace(), Name: caSecretName}
+	err := r.Get(ctx, key, secret)
+	r.mu.Lock()
+	if apierrors.IsNotFound(err) && r.ca != nil && r.ca.Namespace == key.Namespace {
+		// Created by us, but not in the cache yet.
+		secret, err = r.ca.DeepCopy(), nil
+	}
+	r.mu.Unlock()
+	if apierrors.IsNotFound(err) {
+		log.Info("Creating CA", "secret", key)
+		if err := r.ensureNamespace(ctx, key.Namespace); err != nil {
+			return nil, nil, err
+		}
+		ca, err := pki.NewAuthority(lifetime)
+		if err != nil {
+			return nil, nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: key.Namespace,
+				Name:      key.Name,
+				Labels:    map[string]string{ManagedByLabel: ManagedByValue},
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       ca.CertPEM,
+				corev1.TLSPrivateKeyKey: ca.KeyPEM,
+				"ca.crt":                ca.CertPEM,
+			},
+		}
+		if err := r.Create(ctx, secret); err != nil {
+			return nil, nil, err
+		}
+		r.remember(secret)
+		return ca, secret.Data["ca.crt"], nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ca, err := pki.LoadAuthority(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("secret %s: %w", key, err)
+	}
+	if time.Now().After(pki.RenewAt(ca.Cert)) {
+		// Keep trusting the old CA until what it signed has been replaced.
+		log.Info("Rotating CA", "secret", key, "expires", ca.Cert.NotAfter)
+		next, err := pki.NewAuthority(lifetime)
+		if err != nil {
+			return nil, nil, err
+		}
+		secret.Data[corev1.TLSCertKey] = next.CertPEM
+		secret.Data[corev1.TLSPrivateKeyKey] = next.KeyPEM
+		secret.Data["ca.crt"] = pki.Bundle(secret.Data["ca.crt"], next.CertPEM)
+		if err := r.Update(ctx, secret); err != nil {
+			return nil, nil, err
+		}
+		ca = next
+	}
+	r.remember(secret)
+	return ca, secret.Data["ca.crt"], nil
+}
+
+func (r *AgentCertificateReconciler) caNamespace() string {
+	if r.CANamespace == "" {
+		return DefaultCANamespace
+	}
+	return r.CANamespace
+}
+
+// ensureNamespace creates the namespace name unless it exists.
+func (r *AgentCertificateReconciler) ensureNamespace(ctx context.Context, name string) error {
+	err := r.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *AgentCertificateReconciler) remember(secret *corev1.Secret) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ca = secret.DeepCopy()
+}
+
+// ensureClientCertificate issues the controller's client certificate if it
+// has none or it is due for renewal, and puts the client TLS configuration in
+// effect. It returns when the certificate is next due for renewal.
+func (r *AgentCertificateReconciler) ensureClientCertificate(ca *pki.Authority, bundle []byte, config Config) (time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clientLeaf == nil || time.Now().After(pki.RenewAt(r.clientLeaf)) {
+		certPEM, keyPEM, err := ca.IssueController(config.CertificateLifetime)
+		if err != nil {
+			return time.Time{}, err
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return time.Time{}, err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return time.Time{}, err
+		}
+		r.clientCert, r.clientLeaf = &cert, leaf
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		return time.Time{}, errors.New("CA bundle holds no certificates")
+	}
+	// The client certificate is looked up on every handshake, so renewing it
+	// does not disturb open connections; only a change of CAs does.
+	r.Config.setManagedTLS(&tls.Config{
+		RootCAs:              roots,
+		GetClientCertificate: r.clientCertificate,
+		MinVersion:           tls.VersionTLS12,
+	}, fmt.Sprintf("%x", sha256.Sum256(bundle)))
+	return pki.RenewAt(r.clientLeaf), nil
+}
+
+func (r *AgentCertificateReconciler) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.clientCert, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AgentCertificateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Besides each agent's request, there is the CA to look after. It is
+	// looked at straight away, in case there is nothing yet to be notified
+	// about, and whenever the configuration changes, as that may mean a new
+	// agent namespace or a switch to Managed mode.
+	r.resync = make(chan event.GenericEvent, 1)
+	r.resync <- event.GenericEvent{Object: &corev1.Secret{}}
+	r.Config.watch(func(Config) {
+		select {
+		case r.resync <- event.GenericEvent{Object: &corev1.Secret{}}:
+		default:
+		}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&certificatesv1.CertificateSigningRequest{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			csr, ok := obj.(*certificatesv1.CertificateSigningRequest)
+			return ok && csr.Spec.SignerName == AgentSignerName
+		}))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.forCA)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.forCA)).
+		WatchesRawSource(source.Channel(r.resync, handler.EnqueueRequestsFromMapFunc(r.forCA))).
+		Named("agentcertificate").
+		Complete(r)
+}
+
+// forCA maps the CA Secret, the ConfigMap publishing it, or a resync onto
+// the request that looks after the CA alone, which has no name.
+func (r *AgentCertificateReconciler) forCA(_ context.Context, obj client.Object) []reconcile.Request {
+	switch {
+	case obj.GetName() == "",
+		obj.GetName() == caSecretName && obj.GetNamespace() == r.caNamespace(),
+		obj.GetName() == caBundleConfigMapName:
+		return []reconcile.Request{{}}
+	}
+	return nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
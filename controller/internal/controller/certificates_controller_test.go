@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("AgentCertificate Controller", func() {
+	Context("When reconciling", func() {
+		const (
+			nodeName = "test-node"
+			csrName  = "test-agent-csr"
+		)
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name: csrName,
+		}
+
+		var controllerReconciler *AgentCertificateReconciler
+		var config *ConfigStore
+
+		BeforeEach(func() {
+			By("creating the agent namespace")
+			err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultAgentNamespace}})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			config = &ConfigStore{}
+			controllerReconciler = &AgentCertificateReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				Config: config,
+			}
+		})
+
+		AfterEach(func() {
+			csr := &certificatesv1.CertificateSigningRequest{}
+			err := k8sClient.Get(ctx, typeNamespacedName, csr)
+			if err == nil {
+				By("Cleanup the CertificateSigningRequest")
+				Expect(k8sClient.Delete(ctx, csr)).To(Succeed())
+			}
+		})
+
+		It("should publish the CA bundle and issue the controller's certificate", func() {
+			By("Reconciling the CA")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that the CA bundle was published")
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: defaultAgentNamespace,
+				Name:      caBundleConfigMapName,
+			}, cm)).To(Succeed())
+			Expect(cm.Data).To(HaveKey("ca.crt"))
+			Expect(config.Get().tlsReady()).To(BeTrue())
+		})
+
+		It("should deny a request not made by an agent", func() {
+			By("Creating a CertificateSigningRequest for the node")
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: nodeName},
+				DNSNames: []string{nodeName},
+			}, key)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, &certificatesv1.CertificateSigningRequest{
+				ObjectMeta: metav1.ObjectMeta{Name: csrName},
+				Spec: certificatesv1.CertificateSigningRequestSpec{
+					Request:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}),
+					SignerName: AgentSignerName,
+					Usages:     []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth},
+				},
+			})).To(Succeed())
+
+			By("Reconciling the request")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that it was denied and not signed")
+			csr := &certificatesv1.CertificateSigningRequest{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, csr)).To(Succeed())
+			Expect(csrCondition(csr, certificatesv1.CertificateDenied)).To(BeTrue())
+			Expect(csr.Status.Certificate).To(BeEmpty())
+		})
+	})
+})
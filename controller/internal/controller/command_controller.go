@@ -17,27 +17,36 @@ limitations under the License.
 package controller
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	pb "github.com/motilayo/jarvis/agent/pb"
 	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
 
 	grpcClient "github.com/motilayo/jarvis/controller/client"
+	"github.com/motilayo/jarvis/controller/internal/policy"
 
-	"golang.org/x/sync/errgroup"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -46,15 +55,37 @@ type CommandReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// Config is the configuration in effect. Nil uses the defaults.
+	Config *ConfigStore
+	// AgentTokenFile holds the token sent to agents so they can tell the
+	// controller is calling. Empty sends none.
+	AgentTokenFile string
+
+	// cache reads the informer cache, for the map functions that must not
+	// reach the API server.
+	cache client.Reader
+
+	runs       runTracker
+	inflight   inflight
+	executions executionQueue
+	breaker    grpcClient.CircuitBreaker
+	pool       grpcClient.Pool
 }
 
 var finalizer = "jarvis.io/finalizer"
 
+// nodeNameField indexes Nodes by name in the cache, so the agents' nodes can be
+// looked up there.
+const nodeNameField = "metadata.name"
+
 // +kubebuilder:rbac:groups=jarvis.io,resources=commands,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=jarvis.io,resources=commands/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=jarvis.io,resources=commands/finalizers,verbs=update
 // +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
 // +kubebuilder:rbac:groups="",resources=services;endpoints;nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes/jarvis-exec;nodes/jarvis-exec-rw,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
@@ -70,11 +101,22 @@ func (r *CommandReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	if cmd.DeletionTimestamp != nil && controllerutil.ContainsFinalizer(cmd, finalizer) {
-		controllerutil.RemoveFinalizer(cmd, finalizer)
-		if err := r.Update(ctx, cmd); err != nil {
-			return ctrl.Result{}, err
+	if cmd.DeletionTimestamp != nil {
+		r.runs.forget(cmd.UID)
+		if controllerutil.ContainsFinalizer(cmd, finalizer) {
+			if !r.cancelExecutions(ctx, cmd) {
+				if time.Since(cmd.DeletionTimestamp.Time) < cancelTimeout {
+					return ctrl.Result{RequeueAfter: cancelRetryInterval}, nil
+				}
+				r.Recorder.Event(cmd, corev1.EventTypeWarning, "CancelTimedOut",
+					fmt.Sprintf("Could not confirm that all executions stopped within %s; releasing the finalizer anyway", cancelTimeout))
+			}
+			controllerutil.RemoveFinalizer(cmd, finalizer)
+			if err := r.Update(ctx, cmd); err != nil {
+				return ctrl.Result{}, err
+			}
 		}
+		return ctrl.Result{}, nil
 	}
 
 	if !controllerutil.ContainsFinalizer(cmd, finalizer) {
@@ -86,103 +128,509 @@ func (r *CommandReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 
 	log.Info("Reconciling Command", "name", cmd.Name, "namespace", cmd.Namespace, "command", cmd.Spec.Command)
 
+	policies, err := policy.For(ctx, r.Client, cmd.Namespace)
+	if err != nil {
+		log.Error(err, "Failed to load command policies")
+		return ctrl.Result{}, err
+	}
+
+	// Each spec runs once. Reconciles are triggered by our own status writes
+	// too, so everything past this point must be safe to repeat.
+	hash := specHash(&cmd.Spec)
+	if cmd.Status.SpecHash != hash {
+		if r.runs.started(cmd.UID, hash) {
+			// Our own status write has not reached the cache yet.
+			log.V(1).Info("Run already started", "generation", cmd.Generation)
+			return ctrl.Result{}, nil
+		}
+		waiting, wait, err := r.awaitApproval(ctx, cmd, policies)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if waiting {
+			log.Info("Waiting for approval", "generation", cmd.Generation)
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+		if err := r.startRun(ctx, cmd, hash, policies); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	return r.advance(ctx, cmd, policies)
+}
+
+// startRun plans a new run: it targets every matching node, splits them into
+// batches and records them in status as Pending. advance sends them out.
+func (r *CommandReconciler) startRun(ctx context.Context, cmd *jarvisiov1.Command, hash string, policies policy.Set) error {
+	log := logf.FromContext(ctx)
+
 	// Step 1: Get all nodes in the cluster
 
 	nodeList := &corev1.NodeList{}
 	selector, _ := metav1.LabelSelectorAsSelector(&cmd.Spec.Selector)
 	if err := r.List(ctx, nodeList, &client.ListOptions{LabelSelector: selector}); err != nil {
 		log.Error(err, "Failed to list nodes")
+		return err
+	}
+
+	agents, err := r.agentAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Step 2: Skip nodes without an agent, that a policy keeps the command
+	// off or that the creator may not run commands on, and batch up the rest
+
+	r.runs.begin(cmd.UID, hash)
+	cmd.Status.SpecHash = hash
+	cmd.Status.RunGeneration = cmd.Generation
+	cmd.Status.ObservedGeneration = cmd.Generation
+	cmd.Status.Results = nil
+	var reachable []corev1.Node
+	for _, node := range nodeList.Items {
+		if agents[node.Name] == "" {
+			cmd.Status.Results = append(cmd.Status.Results, r.agentNotFound(cmd, node.Name))
+			continue
+		}
+		reachable = append(reachable, node)
+	}
+	skip := func(result jarvisiov1.CommandResult) {
+		cmd.Status.Results = append(cmd.Status.Results, result)
+	}
+	reachable = r.skipByPolicy(cmd, policies, reachable, skip)
+	reachable, err = r.skipForbidden(ctx, cmd, reachable, skip)
+	if err != nil {
+		r.runs.forget(cmd.UID)
+		return err
+	}
+	batches := planBatches(reachable, capParallel(cmd.Spec.Strategy, policies, len(reachable)))
+	for i, batch := range batches {
+		for _, node := range batch {
+			cmd.Status.Results = append(cmd.Status.Results, jarvisiov1.CommandResult{
+				Node:       node.Name,
+				Phase:      jarvisiov1.NodePending,
+				Generation: cmd.Generation,
+				Batch:      int32(i),
+			})
+		}
+	}
+	cmd.Status.Batches = int32(len(batches))
+	cmd.Status.CurrentBatch = 0
+	summarize(&cmd.Status, cmd.Generation)
+	if err := r.Status().Update(ctx, cmd); err != nil {
+		log.Error(err, "Failed to update Command status")
+		r.runs.forget(cmd.UID)
+		return err
+	}
+	log.Info("Started run", "generation", cmd.Generation, "nodes", len(reachable), "batches", len(batches))
+	return nil
+}
+
+// advance moves the current run along: it picks up after a controller
+// restart, adds new nodes when asked to, enforces the failure budget and the
+// policies' quotas, and starts the next batch once the previous one has
+// finished.
+func (r *CommandReconciler) advance(ctx context.Context, cmd *jarvisiov1.Command, policies policy.Set) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	before := cmd.Status.DeepCopy()
+	cmd.Status.ObservedGeneration = cmd.Generation
+
+	agents, err := r.agentAddresses(ctx)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
+	// Running nodes this process never sent the command to were sent it by
+	// a controller that has since restarted. They may or may not have run
+	// it; mark them Failed rather than risk running the command twice.
+	for i, result := range cmd.Status.Results {
+		if result.Phase == jarvisiov1.NodeRunning && !r.runs.sent(cmd.UID, cmd.Status.SpecHash, result.Node) {
+			result.Phase = jarvisiov1.NodeFailed
+			result.Reason = reasonInterrupted
+			result.Message = "controller restarted before the node reported back; not re-run"
+			result.EndTime = ptr.To(metav1.Now())
+			cmd.Status.Results[i] = result
+		}
+	}
+
+	if cmd.Spec.ApplyToNewNodes {
+		if err := r.addNewNodes(ctx, cmd, agents, policies); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	targets, wait := r.nextBatch(cmd, agents)
+	violations := policyViolations(cmd, policies, r.Config.Get())
+	if len(targets) > 0 {
+		quota, held, quotaWait, err := r.executionQuota(ctx, cmd, policies)
+		if err != nil {
+			for _, t := range targets {
+				r.runs.releaseNode(cmd.UID, cmd.Status.SpecHash, t.node)
+			}
+			return ctrl.Result{}, err
+		}
+		if quota >= 0 && len(targets) > quota {
+			// The rest stay Pending until the quota has room.
+			for _, t := range targets[quota:] {
+				r.runs.releaseNode(cmd.UID, cmd.Status.SpecHash, t.node)
+			}
+			targets = targets[:quota]
+			wait = cmp.Or(quotaWait, quotaRecheckInterval)
+		}
+		if held != nil {
+			violations = append(violations, *held)
+		}
+	}
+	summarize(&cmd.Status, cmd.Generation)
+	setPaused(&cmd.Status, cmd.Spec.Paused, cmd.Generation)
+	setPolicyViolation(&cmd.Status, violations, cmd.Generation)
+
+	if !equality.Semantic.DeepEqual(before, &cmd.Status) {
+		if err := r.Status().Update(ctx, cmd); err != nil {
+			log.Error(err, "Failed to update Command status")
+			for _, t := range targets {
+				r.runs.releaseNode(cmd.UID, cmd.Status.SpecHash, t.node)
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	if len(targets) > 0 {
+		log.Info("Starting batch", "batch", cmd.Status.CurrentBatch, "nodes", len(targets))
+		if reason := r.Config.Get().notReady(); reason != "" {
+			// The executions wait in the queue until it is; say why.
+			log.Info("Batch held until agents can be called", "reason", reason)
+			r.Recorder.Eventf(cmd, corev1.EventTypeWarning, "WaitingForCredentials",
+				"Batch %d is queued but cannot start: %s", cmd.Status.CurrentBatch, reason)
+		}
+		r.dispatch(cmd, targets, policies.MaxTimeout())
+	}
+	return ctrl.Result{RequeueAfter: wait}, nil
+}
+
+// addNewNodes adds a batch for the selected nodes that now have an agent but
+// have not been sent the current run, either because they were not there when
+// it started or because they were skipped for lack of an agent. Nodes that
+// already have a result are left alone.
+func (r *CommandReconciler) addNewNodes(ctx context.Context, cmd *jarvisiov1.Command, agents map[string]string, policies policy.Set) error {
+	nodeList := &corev1.NodeList{}
+	selector, _ := metav1.LabelSelectorAsSelector(&cmd.Spec.Selector)
+	if err := r.List(ctx, nodeList, &client.ListOptions{LabelSelector: selector}); err != nil {
+		logf.FromContext(ctx).Error(err, "Failed to list nodes")
+		return err
+	}
+
+	known := map[string]jarvisiov1.CommandResult{}
+	for _, result := range cmd.Status.Results {
+		known[result.Node] = result
+	}
+
+	var candidates []corev1.Node
+	for _, node := range nodeList.Items {
+		if agents[node.Name] == "" {
+			continue
+		}
+		if result, ok := known[node.Name]; ok &&
+			(result.Phase != jarvisiov1.NodeSkipped || result.Reason != reasonAgentNotFound) {
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+	skip := func(result jarvisiov1.CommandResult) {
+		setNodeResult(&cmd.Status, result)
+	}
+	candidates = r.skipByPolicy(cmd, policies, candidates, skip)
+	candidates, err := r.skipForbidden(ctx, cmd, candidates, skip)
+	if err != nil {
+		return err
+	}
+
+	// New nodes go in batches of their own after the run's, sized by its
+	// strategy and no larger than the policies allow.
+	targeted := targetedNodes(&cmd.Status) + len(candidates)
+	strategy := capParallel(newNodeStrategy(cmd.Spec.Strategy, targeted), policies, targeted)
+	batches := planBatches(candidates, strategy)
+	for i, batch := range batches {
+		for _, node := range batch {
+			setNodeResult(&cmd.Status, jarvisiov1.CommandResult{
+				Node:       node.Name,
+				Phase:      jarvisiov1.NodePending,
+				Generation: cmd.Status.RunGeneration,
+				Batch:      cmd.Status.Batches + int32(i),
+			})
+		}
+	}
+	if len(batches) > 0 {
+		logf.FromContext(ctx).Info("Adding new nodes to run", "nodes", len(candidates), "firstBatch", cmd.Status.Batches, "batches", len(batches))
+		cmd.Status.Batches += int32(len(batches))
+	}
+	return nil
+}
+
+// agentAddresses maps node names to the address of the agent running there.
+func (r *CommandReconciler) agentAddresses(ctx context.Context) (map[string]string, error) {
+	config := r.Config.Get()
 	sliceList := &discoveryv1.EndpointSliceList{}
 	if err := r.List(ctx, sliceList,
-		client.InNamespace("jarvis"),
-		client.MatchingLabels{"kubernetes.io/service-name": "jarvis-agent"},
+		client.InNamespace(config.AgentNamespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: config.AgentService},
 	); err != nil {
-		log.Error(err, "failed to list EndpointSlices for jarvis-agent")
-		return ctrl.Result{}, err
+		logf.FromContext(ctx).Error(err, "failed to list EndpointSlices for the agents", "service", config.AgentService)
+		return nil, err
 	}
 
-	nodeIP := map[string]string{}
+	agents := map[string]string{}
 	for _, slice := range sliceList.Items {
 		for _, ep := range slice.Endpoints {
 			if ep.NodeName != nil && len(ep.Addresses) > 0 {
-				nodeIP[*ep.NodeName] = ep.Addresses[0]
+				addr := grpcClient.AgentAddress(ep.Addresses[0], config.AgentPort)
+				agents[*ep.NodeName] = addr
 			}
 		}
 	}
+	return agents, nil
+}
 
-	type target struct {
-		node string
-		ip   string
+// pruneConnections drops pooled connections to agents that are no longer
+// listed, because they went away or came back with a new IP, before anything
+// tries to use them.
+func (r *CommandReconciler) pruneConnections(ctx context.Context, _ reconcile.Request) (ctrl.Result, error) {
+	agents, err := r.agentAddresses(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
-	var targets []target
-	for _, node := range nodeList.Items {
+	live := map[string]bool{}
+	for _, addr := range agents {
+		live[addr] = true
+	}
+	r.pool.Retain(live)
+	return ctrl.Result{}, nil
+}
 
-		ip, ok := nodeIP[node.Name]
-		if !ok || ip == "" {
-			eventName := fmt.Sprintf("%s-%s", cmd.Name, node.Name)
-			msg := fmt.Sprintf("Agent not found for node %s (skipping)", node.Name)
-			r.Recorder.Event(cmd, corev1.EventTypeWarning, eventName, msg)
-			continue
-		}
-		targets = append(targets, target{node: node.Name, ip: ip})
+// agentNotFound records that nodeName has no agent to run the command on.
+func (r *CommandReconciler) agentNotFound(cmd *jarvisiov1.Command, nodeName string) jarvisiov1.CommandResult {
+	eventName := fmt.Sprintf("%s-%s", cmd.Name, nodeName)
+	msg := fmt.Sprintf("Agent not found for node %s (skipping)", nodeName)
+	r.Recorder.Event(cmd, corev1.EventTypeWarning, eventName, msg)
+	return jarvisiov1.CommandResult{
+		Node:       nodeName,
+		Phase:      jarvisiov1.NodeSkipped,
+		Reason:     reasonAgentNotFound,
+		Message:    "no jarvis-agent endpoint on this node",
+		Generation: cmd.Status.RunGeneration,
 	}
+}
 
-	commandName := cmd.Name
-	commandStr := cmd.Spec.Command
+// retryPolicy translates a Command's retry policy for the client.
+func retryPolicy(p *jarvisiov1.RetryPolicy) grpcClient.RetryPolicy {
+	policy := grpcClient.RetryPolicy{MaxAttempts: int(p.MaxAttempts)}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 3
+	}
+	if p.Backoff != nil {
+		policy.Backoff = p.Backoff.Duration
+	}
+	if p.MaxBackoff != nil {
+		policy.MaxBackoff = p.MaxBackoff.Duration
+	}
+	retryOn := p.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []jarvisiov1.RetryCondition{jarvisiov1.RetryOnTransport}
+	}
+	for _, c := range retryOn {
+		switch c {
+		case jarvisiov1.RetryOnTransport:
+			policy.RetryTransport = true
+		case jarvisiov1.RetryOnNonZeroExit:
+			policy.RetryNonZeroExit = true
+		}
+	}
+	return policy
+}
 
-	go func() {
-		g, gctx := errgroup.WithContext(context.Background())
-		for _, target := range targets {
-			nodeName := target.node
-			ip := target.ip
+type target struct {
+	node string
+}
 
-			// Fire one goroutine per node via errgroup
-			g.Go(func() error {
-				output, err := grpcClient.RunCommandOnNode(gctx, ip, nodeName, commandStr)
-				eventName := fmt.Sprintf("%s-%s", commandName, nodeName)
-				if err != nil {
-					msg := fmt.Sprintf("Failed on %s: %v", nodeName, err)
-					r.Recorder.Event(cmd, corev1.EventTypeWarning, eventName, msg)
-					return err
-				}
-				r.Recorder.Event(cmd, corev1.EventTypeNormal, eventName, output)
-				return nil
-			})
-		}
+// executionOptions translates cmd's spec into options for the client,
+// filling in what it leaves unset from config.
+func executionOptions(cmd *jarvisiov1.Command, config Config) grpcClient.Options {
+	opts := grpcClient.Options{}
+	if timeout := cmp.Or(cmd.Spec.Timeout, config.Defaults.Timeout); timeout != nil {
+		opts.Timeout = timeout.Duration
+	}
+	if grace := cmp.Or(cmd.Spec.GracePeriod, config.Defaults.GracePeriod); grace != nil {
+		opts.GracePeriod = grace.Duration
+	}
+	if limit := cmp.Or(cmd.Spec.OutputLimit, config.Defaults.OutputLimit); limit != nil {
+		opts.MaxOutputBytes = limit.Value()
+	}
+	if config.MaxOutputLimit != nil && (opts.MaxOutputBytes == 0 || opts.MaxOutputBytes > config.MaxOutputLimit.Value()) {
+		opts.MaxOutputBytes = config.MaxOutputLimit.Value()
+	}
+	if cmd.Spec.RetryPolicy != nil {
+		opts.Retry = retryPolicy(cmd.Spec.RetryPolicy)
+	}
+	opts.Privilege = pb.Privilege_PRIVILEGE_READ_ONLY
+	if cmd.Spec.Privilege == jarvisiov1.PrivilegeReadWrite {
+		opts.Privilege = pb.Privilege_PRIVILEGE_READ_WRITE
+	}
+	switch cmd.Spec.Profile {
+	case jarvisiov1.ProfileDiagnostic:
+		opts.Profile = pb.Profile_PROFILE_DIAGNOSTIC
+	case jarvisiov1.ProfileNetworkIsolated:
+		opts.Profile = pb.Profile_PROFILE_NETWORK_ISOLATED
+	default:
+		opts.Profile = pb.Profile_PROFILE_FULL
+	}
+	if cmd.Spec.Resources != nil {
+		opts.Resources = resourceLimitsToProto(cmd.Spec.Resources)
+	}
+	return opts
+}
 
-		if err := g.Wait(); err != nil {
-			log.Error(err, "one or more node executions failed")
-		} else {
-			log.Info("all node executions completed")
-		}
-	}()
+// resourceLimitsToProto translates res into the limits the agent enforces.
+func resourceLimitsToProto(res *jarvisiov1.CommandResources) *pb.ResourceLimits {
+	limits := &pb.ResourceLimits{Nice: res.Nice, IoPriority: res.IOPriority}
+	if res.CPU != nil {
+		limits.CpuMillis = res.CPU.MilliValue()
+	}
+	if res.Memory != nil {
+		limits.MemoryBytes = res.Memory.Value()
+	}
+	if res.IOWeight != nil {
+		limits.IoWeight = uint32(*res.IOWeight)
+	}
+	if res.Pids != nil {
+		limits.PidsMax = *res.Pids
+	}
+	switch res.IOClass {
+	case jarvisiov1.IOClassBestEffort:
+		limits.IoClass = pb.IOClass_IO_CLASS_BEST_EFFORT
+	case jarvisiov1.IOClassIdle:
+		limits.IoClass = pb.IOClass_IO_CLASS_IDLE
+	}
+	return limits
+}
 
-	return ctrl.Result{}, nil
+// dispatch queues the command for every target. The nodes stay Pending in
+// status until a worker gets to them. A maxTimeout other than 0 caps the
+// command's timeout.
+func (r *CommandReconciler) dispatch(cmd *jarvisiov1.Command, targets []target, maxTimeout time.Duration) {
+	executions := make([]nodeExecution, 0, len(targets))
+	for _, t := range targets {
+		executions = append(executions, nodeExecution{
+			command:    client.ObjectKeyFromObject(cmd),
+			uid:        cmd.UID,
+			hash:       cmd.Status.SpecHash,
+			generation: cmd.Status.RunGeneration,
+			node:       t.node,
+			maxTimeout: maxTimeout,
+		})
+	}
+	r.executions.add(executions...)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *CommandReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorderFor("command-controller")
+	r.cache = mgr.GetCache()
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &corev1.Node{}, nodeNameField, func(obj client.Object) []string {
+		return []string{obj.GetName()}
+	}); err != nil {
+		return err
+	}
+	if r.AgentTokenFile != "" {
+		r.pool.Token = &grpcClient.TokenFile{Path: r.AgentTokenFile}
+	}
+	if err := metrics.Registry.Register(poolCollector{pool: &r.pool}); err != nil {
+		return err
+	}
+	if err := mgr.Add(executionWorkers{r: r}); err != nil {
+		return err
+	}
+	r.Config.watch(func(config Config) {
+		r.pool.SetTLS(config.TLS)
+		r.executions.wake()
+	})
+	// Close the agent connections once the manager stops.
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		r.pool.Close()
+		return nil
+	})); err != nil {
+		return err
+	}
+	if err := ctrl.NewControllerManagedBy(mgr).
+		Named("agent-connections").
+		For(&discoveryv1.EndpointSlice{}, builder.WithPredicates(predicate.NewPredicateFuncs(r.isAgentSlice))).
+		Complete(reconcile.Func(r.pruneConnections)); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates trigger reconciles too: they are what moves a
+		// rollout on to its next batch.
 		For(&jarvisiov1.Command{}).
 		Named("command").
 		Watches(&discoveryv1.EndpointSlice{},
-			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
-				if obj.GetName() == "jarvis-agent" {
-					return []reconcile.Request{
-						{
-							NamespacedName: types.NamespacedName{
-								Name:      obj.GetName(),
-								Namespace: obj.GetNamespace(),
-							},
-						},
-					}
-				}
-				return []reconcile.Request{}
-			},
-			)).
+			handler.EnqueueRequestsFromMapFunc(r.commandsForAgentSlice),
+		).
+		Watches(&jarvisiov1.CommandApproval{},
+			handler.EnqueueRequestsFromMapFunc(r.commandForApproval),
+		).
 		Complete(r)
 }
+
+// isAgentSlice reports whether obj is an EndpointSlice of the agents' Service.
+func (r *CommandReconciler) isAgentSlice(obj client.Object) bool {
+	config := r.Config.Get()
+	return obj.GetNamespace() == config.AgentNamespace && obj.GetLabels()[discoveryv1.LabelServiceName] == config.AgentService
+}
+
+// commandsForAgentSlice maps a change to the agent's EndpointSlice onto the
+// Commands whose selectors match the nodes the change touched. Updates are
+// mapped for both the old and new slice, so nodes that lost their agent are
+// covered as well as nodes that gained one. It only reads from the cache.
+func (r *CommandReconciler) commandsForAgentSlice(ctx context.Context, obj client.Object) []reconcile.Request {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok || !r.isAgentSlice(slice) {
+		return nil
+	}
+	log := logf.FromContext(ctx)
+
+	var nodes []corev1.Node
+	for _, ep := range slice.Endpoints {
+		if ep.NodeName == nil {
+			continue
+		}
+		nodeList := &corev1.NodeList{}
+		if err := r.cache.List(ctx, nodeList, client.MatchingFields{nodeNameField: *ep.NodeName}); err != nil {
+			log.Error(err, "Failed to look up node for agent endpoint", "node", *ep.NodeName)
+			continue
+		}
+		nodes = append(nodes, nodeList.Items...)
+	}
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	commands := &jarvisiov1.CommandList{}
+	if err := r.cache.List(ctx, commands); err != nil {
+		log.Error(err, "Failed to list Commands for agent endpoint change")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cmd := range commands.Items {
+		selector, err := metav1.LabelSelectorAsSelector(&cmd.Spec.Selector)
+		if err != nil {
+			continue
+		}
+		for _, node := range nodes {
+			if selector.Matches(labels.Set(node.Labels)) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cmd)})
+				break
+			}
+		}
+	}
+	return requests
+}
@@ -18,18 +18,54 @@ package controller
 
 import (
 	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	pb "github.com/motilayo/jarvis/agent/pb"
 	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
 )
 
+// fakeAgent records the executions it is asked to cancel.
+type fakeAgent struct {
+	pb.UnimplementedJarvisServer
+
+	mu        sync.Mutex
+	cancelled []string
+}
+
+func (a *fakeAgent) Cancel(_ context.Context, req *pb.CancelRequest) (*pb.CancelResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cancelled = append(a.cancelled, req.GetId())
+	return &pb.CancelResponse{Found: true, Stopped: true}, nil
+}
+
+func (a *fakeAgent) cancelledIDs() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.cancelled...)
+}
+
 var _ = Describe("Command Controller", func() {
 	Context("When reconciling a resource", func() {
 		const resourceName = "test-resource"
@@ -38,7 +74,7 @@ var _ = Describe("Command Controller", func() {
 
 		typeNamespacedName := types.NamespacedName{
 			Name:      resourceName,
-			Namespace: "default", // TODO(user):Modify as needed
+			Namespace: "default",
 		}
 		command := &jarvisiov1.Command{}
 
@@ -51,14 +87,12 @@ var _ = Describe("Command Controller", func() {
 						Name:      resourceName,
 						Namespace: "default",
 					},
-					// TODO(user): Specify other spec details if needed.
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 			}
 		})
 
 		AfterEach(func() {
-			// TODO(user): Cleanup logic after each test, like removing the resource instance.
 			resource := &jarvisiov1.Command{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
@@ -77,8 +111,181 @@ var _ = Describe("Command Controller", func() {
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("Checking the status reflects the fan-out")
+			resource := &jarvisiov1.Command{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.ObservedGeneration).To(Equal(resource.Generation))
+			// envtest has no nodes, so there is nothing left to run.
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, jarvisiov1.ConditionComplete)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(resource.Status.Conditions, jarvisiov1.ConditionFailed)).To(BeTrue())
+		})
+	})
+
+	Context("When deleting a Command with executions in flight", func() {
+		const (
+			resourceName = "test-deleted"
+			nodeName     = "test-node"
+		)
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+
+		var agent *fakeAgent
+		var server *grpc.Server
+		var config *ConfigStore
+
+		BeforeEach(func() {
+			By("starting an agent for the node")
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			agent = &fakeAgent{}
+			server = grpc.NewServer()
+			pb.RegisterJarvisServer(server, agent)
+			go func() { _ = server.Serve(lis) }()
+
+			config = &ConfigStore{}
+			c := config.Get()
+			c.TLSMode = jarvisiov1.TLSDisabled
+			c.AgentPort = int32(lis.Addr().(*net.TCPAddr).Port)
+			config.set(c)
+
+			By("listing the agent in the agent Service's EndpointSlice")
+			err = k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: c.AgentNamespace}})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(k8sClient.Create(ctx, &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: c.AgentNamespace,
+					Name:      "jarvis-agent-test",
+					Labels:    map[string]string{discoveryv1.LabelServiceName: c.AgentService},
+				},
+				AddressType: discoveryv1.AddressTypeIPv4,
+				Endpoints: []discoveryv1.Endpoint{{
+					Addresses: []string{"127.0.0.1"},
+					NodeName:  ptr.To(nodeName),
+				}},
+			})).To(Succeed())
+
+			By("creating a Command still running on the node")
+			resource := &jarvisiov1.Command{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       resourceName,
+					Namespace:  "default",
+					Finalizers: []string{finalizer},
+				},
+			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			resource.Status.Results = []jarvisiov1.CommandResult{{
+				Node:       nodeName,
+				Phase:      jarvisiov1.NodeRunning,
+				Generation: resource.Generation,
+			}}
+			Expect(k8sClient.Status().Update(ctx, resource)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			server.Stop()
+			slice := &discoveryv1.EndpointSlice{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: config.Get().AgentNamespace,
+				Name:      "jarvis-agent-test",
+			}, slice)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, slice)).To(Succeed())
+		})
+
+		It("should cancel the executions and release the finalizer", func() {
+			resource := &jarvisiov1.Command{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			By("Deleting the Command")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+
+			By("Reconciling the deleted Command")
+			controllerReconciler := &CommandReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: record.NewFakeRecorder(10),
+				Config:   config,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that the agent was asked to cancel and the Command is gone")
+			Expect(agent.cancelledIDs()).To(ConsistOf(executionID(resource.UID, resource.Generation, nodeName)))
+			err = k8sClient.Get(ctx, typeNamespacedName, &jarvisiov1.Command{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
 		})
 	})
 })
+
+func TestCommandsForAgentSlice(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := jarvisiov1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	node := func(name, role string) *corev1.Node {
+		return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"role": role}}}
+	}
+	command := func(name string, selector map[string]string) *jarvisiov1.Command {
+		return &jarvisiov1.Command{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       jarvisiov1.CommandSpec{Command: "uptime", Selector: metav1.LabelSelector{MatchLabels: selector}},
+		}
+	}
+	cache := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&corev1.Node{}, nodeNameField, func(obj client.Object) []string { return []string{obj.GetName()} }).
+		WithObjects(
+			node("web-1", "web"), node("db-1", "db"),
+			command("on-web", map[string]string{"role": "web"}),
+			command("on-db", map[string]string{"role": "db"}),
+			command("everywhere", nil),
+		).Build()
+	slice := func(namespace, service string, nodes ...string) *discoveryv1.EndpointSlice {
+		s := &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+			Name: "agents", Namespace: namespace, Labels: map[string]string{discoveryv1.LabelServiceName: service},
+		}}
+		for _, n := range nodes {
+			s.Endpoints = append(s.Endpoints, discoveryv1.Endpoint{Addresses: []string{"10.0.0.1"}, NodeName: ptr.To(n)})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		slice *discoveryv1.EndpointSlice
+		want  []string
+	}{
+		{"agent on a web node", slice("jarvis", "jarvis-agent", "web-1"), []string{"everywhere", "on-web"}},
+		{"agents on both", slice("jarvis", "jarvis-agent", "web-1", "db-1"), []string{"everywhere", "on-db", "on-web"}},
+		{"node not in the cache", slice("jarvis", "jarvis-agent", "gone"), nil},
+		{"another Service", slice("jarvis", "other", "web-1"), nil},
+		{"another namespace", slice("default", "jarvis-agent", "web-1"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without a Client, anything but a cache read fails.
+			r := &CommandReconciler{cache: cache}
+			var got []string
+			for _, req := range r.commandsForAgentSlice(context.Background(), tt.slice) {
+				got = append(got, req.Name)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("commandsForAgentSlice() = %v, want %v", got, tt.want)
+			}
+			if stats := r.pool.Stats(); stats.Dropped != 0 || stats.Dials != 0 {
+				t.Errorf("commandsForAgentSlice() touched the pool: %+v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	grpcClient "github.com/motilayo/jarvis/controller/client"
+)
+
+// The defaults used for anything the JarvisConfig leaves unset.
+const (
+	defaultAgentNamespace      = "jarvis"
+	defaultAgentService        = "jarvis-agent"
+	defaultAgentPort           = 50051
+	defaultCertificateLifetime = 30 * 24 * time.Hour
+)
+
+// Config is what the controller runs with: the JarvisConfig with its
+// defaults filled in and its TLS credentials loaded.
+type Config struct {
+	AgentNamespace string
+	AgentService   string
+	AgentPort      int32
+
+	TLSMode             jarvisiov1.TLSMode
+	CertificateLifetime time.Duration
+	// TLS is nil when agents are reached in plaintext, or in Managed mode
+	// until the controller has its certificate.
+	TLS *tls.Config
+	// tlsSource identifies what TLS was built from, so that reloading the
+	// same credentials is not mistaken for a change.
+	tlsSource string
+	// Signer signs requests to agents. It is nil until the signing key has
+	// been loaded and published to them.
+	Signer *grpcClient.Signer
+
+	Defaults                jarvisiov1.CommandDefaults
+	MaxConcurrentExecutions int
+	MaxExecutionsPerNode    int
+	MaxOutputLimit          *resource.Quantity
+}
+
+// equal reports whether c and o configure the same thing.
+func (c Config) equal(o Config) bool {
+	return c.AgentNamespace == o.AgentNamespace &&
+		c.AgentService == o.AgentService &&
+		c.AgentPort == o.AgentPort &&
+		c.TLSMode == o.TLSMode &&
+		c.CertificateLifetime == o.CertificateLifetime &&
+		c.tlsSource == o.tlsSource &&
+		c.signingKey() == o.signingKey() &&
+		c.MaxConcurrentExecutions == o.MaxConcurrentExecutions &&
+		c.MaxExecutionsPerNode == o.MaxExecutionsPerNode &&
+		equality.Semantic.DeepEqual(c.Defaults, o.Defaults) &&
+		equality.Semantic.DeepEqual(c.MaxOutputLimit, o.MaxOutputLimit)
+}
+
+// signingKey is the ID of the key requests are signed with, if any.
+func (c Config) signingKey() string {
+	if c.Signer == nil {
+		return ""
+	}
+	return c.Signer.KeyID
+}
+
+// tlsReady reports whether agents can be reached: in Managed mode, calls
+// wait until the controller has been issued its certificate.
+func (c Config) tlsReady() bool {
+	return c.TLSMode != jarvisiov1.TLSManaged || c.TLS != nil
+}
+
+// notReady says why executions cannot start yet, or returns "" if they can:
+// calls need a certificate to be made with and a key to be signed with.
+func (c Config) notReady() string {
+	switch {
+	case !c.tlsReady():
+		return "the controller has not been issued its client certificate yet"
+	case c.Signer == nil:
+		return "the controller has no key to sign requests with yet"
+	}
+	return ""
+}
+
+// serverName is the name to check the agent on node's certificate against,
+// or empty to leave that to the TLS configuration.
+func (c Config) serverName(node string) string {
+	if c.TLSMode == jarvisiov1.TLSManaged {
+		return node
+	}
+	return ""
+}
+
+// ConfigStore holds the Config currently in effect and tells interested
+// parties when it changes. The zero value holds the defaults.
+type ConfigStore struct {
+	// MaxConcurrentExecutions and MaxExecutionsPerNode apply unless the
+	// JarvisConfig sets them. Zero uses the built-in defaults.
+	MaxConcurrentExecutions int
+	MaxExecutionsPerNode    int
+
+	mu       sync.RWMutex
+	config   *Config
+	managed  managedTLS
+	signer   *grpcClient.Signer
+	watchers []func(Config)
+}
+
+// managedTLS is the client TLS configuration for Managed mode, kept apart
+// from the JarvisConfig it is combined with.
+type managedTLS struct {
+	config *tls.Config
+	source string
+}
+
+// Get returns the Config in effect.
+func (s *ConfigStore) Get() Config {
+	if s == nil {
+		return (*ConfigStore)(nil).defaults()
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current()
+}
+
+// current combines the JarvisConfig with the managed credentials. s.mu must
+// be held.
+func (s *ConfigStore) current() Config {
+	config := s.defaults()
+	if s.config != nil {
+		config = *s.config
+	}
+	if config.TLSMode == jarvisiov1.TLSManaged {
+		config.TLS, config.tlsSource = s.managed.config, s.managed.source
+	}
+	config.Signer = s.signer
+	return config
+}
+
+// defaults returns the Config used when there is no JarvisConfig.
+func (s *ConfigStore) defaults() Config {
+	config := Config{
+		AgentNamespace:          defaultAgentNamespace,
+		AgentService:            defaultAgentService,
+		AgentPort:               defaultAgentPort,
+		TLSMode:                 jarvisiov1.TLSManaged,
+		CertificateLifetime:     defaultCertificateLifetime,
+		MaxConcurrentExecutions: defaultMaxConcurrentExecutions,
+		MaxExecutionsPerNode:    defaultMaxExecutionsPerNode,
+	}
+	if s != nil && s.MaxConcurrentExecutions > 0 {
+		config.MaxConcurrentExecutions = s.MaxConcurrentExecutions
+	}
+	if s != nil && s.MaxExecutionsPerNode > 0 {
+		config.MaxExecutionsPerNode = s.MaxExecutionsPerNode
+	}
+	return config
+}
+
+// set puts config, as read from the JarvisConfig, in effect.
+func (s *ConfigStore) set(config Config) {
+	s.update(func() { s.config = &config })
+}
+
+// setManagedTLS puts the client TLS configuration for Managed mode in
+// effect. source identifies what it was built from.
+func (s *ConfigStore) setManagedTLS(config *tls.Config, source string) {
+	s.update(func() { s.managed = managedTLS{config: config, source: source} })
+}
+
+// setSigner puts the key requests to agents are signed with in effect.
+func (s *ConfigStore) setSigner(signer *grpcClient.Signer) {
+	s.update(func() { s.signer = signer })
+}
+
+// update applies change and calls the watchers if it changed the Config in
+// effect.
+func (s *ConfigStore) update(change func()) {
+	s.mu.Lock()
+	before := s.current()
+	change()
+	after := s.current()
+	watchers := s.watchers
+	s.mu.Unlock()
+	if !before.equal(after) {
+		for _, watch := range watchers {
+			watch(after)
+		}
+	}
+}
+
+// watch calls fn with every new Config.
+func (s *ConfigStore) watch(fn func(Config)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers = append(s.watchers, fn)
+}
@@ -0,0 +1,373 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ref "k8s.io/client-go/tools/reference"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+const (
+	// cronCommandLabel names the CronCommand a run was created by.
+	cronCommandLabel = "jarvis.io/cron-command"
+	// scheduledTimeAnnotation records the tick a run was created for.
+	scheduledTimeAnnotation = "jarvis.io/scheduled-at"
+	// maxMissedRuns bounds how many missed ticks are walked through, e.g.
+	// after a long outage with no starting deadline. Beyond it, the earlier
+	// ticks are given up and only the most recent one is run.
+	maxMissedRuns = 100
+)
+
+// Clock knows how to get the current time. It can be swapped out in tests;
+// nil means the real clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// CronCommandReconciler reconciles a CronCommand object
+type CronCommandReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Clock    Clock
+}
+
+// +kubebuilder:rbac:groups=jarvis.io,resources=croncommands,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=jarvis.io,resources=croncommands/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=jarvis.io,resources=croncommands/finalizers,verbs=update
+// +kubebuilder:rbac:groups=jarvis.io,resources=commands,verbs=get;list;watch;create;update;patch;delete
+func (r *CronCommandReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	cronCommand := &jarvisiov1.CronCommand{}
+	if err := r.Get(ctx, req.NamespacedName, cronCommand); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Unable to fetch CronCommand")
+		return ctrl.Result{}, err
+	}
+
+	// Step 1: Sort the runs we created into active and finished ones.
+
+	var children jarvisiov1.CommandList
+	if err := r.List(ctx, &children,
+		client.InNamespace(req.Namespace),
+		client.MatchingLabels{cronCommandLabel: req.Name},
+	); err != nil {
+		log.Error(err, "Unable to list runs")
+		return ctrl.Result{}, err
+	}
+
+	var active, successful, failed []*jarvisiov1.Command
+	var mostRecent *time.Time
+	for i := range children.Items {
+		child := &children.Items[i]
+		if !metav1.IsControlledBy(child, cronCommand) {
+			continue
+		}
+		switch {
+		case meta.IsStatusConditionTrue(child.Status.Conditions, jarvisiov1.ConditionComplete):
+			successful = append(successful, child)
+		case meta.IsStatusConditionTrue(child.Status.Conditions, jarvisiov1.ConditionFailed):
+			failed = append(failed, child)
+		case child.DeletionTimestamp == nil:
+			active = append(active, child)
+		}
+
+		if scheduled, err := scheduledTimeFor(child); err != nil {
+			log.Error(err, "Unable to parse scheduled time for run", "command", child.Name)
+		} else if scheduled != nil && (mostRecent == nil || mostRecent.Before(*scheduled)) {
+			mostRecent = scheduled
+		}
+	}
+
+	// Only ever move forward: runs pruned from history must not make their
+	// ticks look missed again.
+	if last := cronCommand.Status.LastScheduleTime; mostRecent != nil && (last == nil || last.Time.Before(*mostRecent)) {
+		cronCommand.Status.LastScheduleTime = &metav1.Time{Time: *mostRecent}
+	}
+	cronCommand.Status.Active = nil
+	for _, child := range active {
+		childRef, err := ref.GetReference(r.Scheme, child)
+		if err != nil {
+			log.Error(err, "Unable to make reference to active run", "command", child.Name)
+			continue
+		}
+		cronCommand.Status.Active = append(cronCommand.Status.Active, *childRef)
+	}
+	for _, child := range successful {
+		cond := meta.FindStatusCondition(child.Status.Conditions, jarvisiov1.ConditionComplete)
+		if last := cronCommand.Status.LastSuccessfulTime; last == nil || last.Before(&cond.LastTransitionTime) {
+			cronCommand.Status.LastSuccessfulTime = cond.LastTransitionTime.DeepCopy()
+		}
+	}
+
+	log.V(1).Info("run count", "active", len(active), "successful", len(successful), "failed", len(failed))
+	if err := r.Status().Update(ctx, cronCommand); err != nil {
+		log.Error(err, "Unable to update CronCommand status")
+		return ctrl.Result{}, err
+	}
+
+	// Step 2: Drop finished runs beyond the history limit, oldest first.
+
+	finished := append(successful, failed...)
+	if limit := cronCommand.Spec.HistoryLimit; limit != nil && len(finished) > int(*limit) {
+		sort.Slice(finished, func(i, j int) bool {
+			return finished[i].CreationTimestamp.Before(&finished[j].CreationTimestamp)
+		})
+		for _, child := range finished[:len(finished)-int(*limit)] {
+			if err := r.Delete(ctx, child, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Unable to delete old run", "command", child.Name)
+			} else {
+				log.V(1).Info("deleted old run", "command", child.Name)
+			}
+		}
+	}
+
+	// Step 3: Work out whether a run is due.
+
+	sched, err := scheduleFor(cronCommand)
+	if err != nil {
+		// Nothing will fix this until the spec changes, which triggers a
+		// reconcile of its own.
+		log.Error(err, "Unable to parse schedule")
+		r.Recorder.Event(cronCommand, corev1.EventTypeWarning, "InvalidSchedule", err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	now := r.now()
+	missedRun, nextRun, tooMany := nextSchedule(cronCommand, sched, now)
+	if tooMany {
+		log.Info("too many missed runs, skipping to the most recent", "current run", missedRun)
+		r.Recorder.Eventf(cronCommand, corev1.EventTypeWarning, "TooManyMissedRuns",
+			"More than %d runs were missed; skipping to the run scheduled at %s; set or decrease startingDeadlineSeconds",
+			maxMissedRuns, missedRun.Format(time.RFC3339))
+	}
+	scheduledResult := ctrl.Result{RequeueAfter: nextRun.Sub(now)}
+	log = log.WithValues("now", now, "next run", nextRun)
+
+	if missedRun.IsZero() {
+		log.V(1).Info("no upcoming scheduled times, sleeping until next")
+		return scheduledResult, nil
+	}
+
+	log = log.WithValues("current run", missedRun)
+	if d := cronCommand.Spec.StartingDeadlineSeconds; d != nil && missedRun.Add(time.Duration(*d)*time.Second).Before(now) {
+		log.V(1).Info("missed starting deadline for last run, sleeping till next")
+		r.Recorder.Eventf(cronCommand, corev1.EventTypeWarning, "MissedSchedule",
+			"Missed starting deadline for run scheduled at %s", missedRun.Format(time.RFC3339))
+		return scheduledResult, nil
+	}
+
+	// Step 4: Apply the concurrency policy.
+
+	switch cronCommand.Spec.ConcurrencyPolicy {
+	case jarvisiov1.ForbidConcurrent:
+		if len(active) > 0 {
+			log.V(1).Info("concurrency policy blocks concurrent runs, skipping", "active", len(active))
+			return scheduledResult, nil
+		}
+	case jarvisiov1.ReplaceConcurrent:
+		for _, child := range active {
+			// Deleting the Command cancels whatever it still has running.
+			if err := r.Delete(ctx, child, client.PropagationPolicy(metav1.DeletePropagationBackground)); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Unable to delete active run", "command", child.Name)
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// Step 5: Start the run.
+
+	child, err := r.commandForRun(cronCommand, missedRun)
+	if err != nil {
+		log.Error(err, "Unable to construct run from template")
+		return scheduledResult, nil
+	}
+	if err := r.Create(ctx, child); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return scheduledResult, nil
+		}
+		log.Error(err, "Unable to create Command for run", "command", child.Name)
+		return ctrl.Result{}, err
+	}
+	log.V(1).Info("created Command for run", "command", child.Name)
+	r.Recorder.Eventf(cronCommand, corev1.EventTypeNormal, "SuccessfulCreate", "Created Command %s", child.Name)
+
+	cronCommand.Status.LastScheduleTime = &metav1.Time{Time: missedRun}
+	if err := r.Status().Update(ctx, cronCommand); err != nil {
+		// The run's annotation carries the same time into the next
+		// reconcile, so this is not worth failing over.
+		log.Error(err, "Unable to record schedule time")
+	}
+
+	return scheduledResult, nil
+}
+
+func (r *CronCommandReconciler) now() time.Time {
+	if r.Clock == nil {
+		return time.Now()
+	}
+	return r.Clock.Now()
+}
+
+// commandForRun builds the Command for the run scheduled at scheduledTime. Its
+// name is derived from the tick, so a run is never created twice.
+func (r *CronCommandReconciler) commandForRun(cronCommand *jarvisiov1.CronCommand, scheduledTime time.Time) (*jarvisiov1.Command, error) {
+	child := &jarvisiov1.Command{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%d", cronCommand.Name, scheduledTime.Unix()),
+			Namespace: cronCommand.Namespace,
+			Labels: map[string]string{
+				cronCommandLabel: cronCommand.Name,
+			},
+			Annotations: map[string]string{
+				scheduledTimeAnnotation: scheduledTime.Format(time.RFC3339),
+			},
+		},
+		Spec: *cronCommand.Spec.CommandTemplate.DeepCopy(),
+	}
+	if err := ctrl.SetControllerReference(cronCommand, child, r.Scheme); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// scheduledTimeFor returns the tick a run was created for.
+func scheduledTimeFor(child *jarvisiov1.Command) (*time.Time, error) {
+	raw := child.Annotations[scheduledTimeAnnotation]
+	if raw == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// scheduleFor turns a CronCommand's schedule or interval into a cron.Schedule.
+func scheduleFor(cronCommand *jarvisiov1.CronCommand) (cron.Schedule, error) {
+	spec := cronCommand.Spec
+	if spec.Interval != nil {
+		if spec.Interval.Duration <= 0 {
+			return nil, fmt.Errorf("interval %s must be positive", spec.Interval.Duration)
+		}
+		return intervalSchedule{start: cronCommand.CreationTimestamp.Time, every: spec.Interval.Duration}, nil
+	}
+
+	schedule := spec.Schedule
+	if spec.TimeZone != nil {
+		schedule = fmt.Sprintf("CRON_TZ=%s %s", *spec.TimeZone, schedule)
+	}
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("unparseable schedule %q: %w", schedule, err)
+	}
+	return sched, nil
+}
+
+// intervalSchedule ticks every period, counted from start.
+type intervalSchedule struct {
+	start time.Time
+	every time.Duration
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		return s.start.Add(s.every)
+	}
+	return s.start.Add((t.Sub(s.start)/s.every + 1) * s.every)
+}
+
+// nextSchedule returns the latest tick that has passed without a run, if any,
+// and the next tick to come. tooMany reports that more than maxMissedRuns
+// ticks were missed, in which case the ones before the latest are given up.
+func nextSchedule(cronCommand *jarvisiov1.CronCommand, sched cron.Schedule, now time.Time) (lastMissed time.Time, next time.Time, tooMany bool) {
+	var earliest time.Time
+	if cronCommand.Status.LastScheduleTime != nil {
+		earliest = cronCommand.Status.LastScheduleTime.Time
+	} else {
+		earliest = cronCommand.CreationTimestamp.Time
+	}
+	if d := cronCommand.Spec.StartingDeadlineSeconds; d != nil {
+		// Ticks older than the deadline would be skipped anyway.
+		if deadline := now.Add(-time.Duration(*d) * time.Second); deadline.After(earliest) {
+			earliest = deadline
+		}
+	}
+	if earliest.After(now) {
+		return time.Time{}, sched.Next(now), false
+	}
+
+	missed := 0
+	for t := sched.Next(earliest); !t.After(now); t = sched.Next(t) {
+		lastMissed = t
+		missed++
+		if missed > maxMissedRuns {
+			return latestTick(sched, earliest, now), sched.Next(now), true
+		}
+	}
+	return lastMissed, sched.Next(now), false
+}
+
+// latestTick returns the last tick of sched after earliest and no later than
+// now, or the zero time if there is none. Rather than walking every tick since
+// earliest, it looks back from now over a window that doubles until it holds
+// a tick.
+func latestTick(sched cron.Schedule, earliest, now time.Time) time.Time {
+	for span := time.Minute; ; span *= 2 {
+		from := now.Add(-span)
+		if !from.After(earliest) {
+			from = earliest
+		}
+		var latest time.Time
+		for t := sched.Next(from); !t.After(now); t = sched.Next(t) {
+			latest = t
+		}
+		if !latest.IsZero() || from.Equal(earliest) {
+			return latest
+		}
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CronCommandReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("croncommand-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&jarvisiov1.CronCommand{}).
+		Owns(&jarvisiov1.Command{}).
+		Named("croncommand").
+		Complete(r)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+var _ = Describe("CronCommand Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-resource"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: "default",
+		}
+		croncommand := &jarvisiov1.CronCommand{}
+
+		BeforeEach(func() {
+			By("creating the custom resource for the Kind CronCommand")
+			err := k8sClient.Get(ctx, typeNamespacedName, croncommand)
+			if err != nil && errors.IsNotFound(err) {
+				resource := &jarvisiov1.CronCommand{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName,
+						Namespace: "default",
+					},
+					Spec: jarvisiov1.CronCommandSpec{
+						Interval:        &metav1.Duration{Duration: time.Hour},
+						CommandTemplate: jarvisiov1.CommandSpec{Command: "true"},
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			resource := &jarvisiov1.CronCommand{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance CronCommand")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+		It("should successfully reconcile the resource", func() {
+			By("Reconciling the created resource")
+			controllerReconciler := &CronCommandReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+			}
+
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that nothing runs before the first tick")
+			Expect(result.RequeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+			runs := &jarvisiov1.CommandList{}
+			Expect(k8sClient.List(ctx, runs, client.InNamespace("default"),
+				client.MatchingLabels{cronCommandLabel: resourceName})).To(Succeed())
+			Expect(runs.Items).To(BeEmpty())
+		})
+	})
+})
+
+func TestNextSchedule(t *testing.T) {
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cronCommand := func(schedule string, timeZone *string, last *time.Time) *jarvisiov1.CronCommand {
+		c := &jarvisiov1.CronCommand{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.Time{Time: created}},
+			Spec:       jarvisiov1.CronCommandSpec{Schedule: schedule, TimeZone: timeZone},
+		}
+		if last != nil {
+			c.Status.LastScheduleTime = &metav1.Time{Time: *last}
+		}
+		return c
+	}
+	at := func(d time.Duration) *time.Time {
+		t := created.Add(d)
+		return &t
+	}
+	newYork := "America/New_York"
+
+	tests := []struct {
+		name        string
+		cronCommand *jarvisiov1.CronCommand
+		now         time.Time
+		wantMissed  time.Time
+		wantNext    time.Time
+		wantTooMany bool
+	}{
+		{
+			name:        "before the first tick",
+			cronCommand: cronCommand("0 * * * *", nil, nil),
+			now:         *at(30 * time.Minute),
+			wantNext:    *at(time.Hour),
+		},
+		{
+			name:        "one tick missed",
+			cronCommand: cronCommand("0 * * * *", nil, nil),
+			now:         *at(90 * time.Minute),
+			wantMissed:  *at(time.Hour),
+			wantNext:    *at(2 * time.Hour),
+		},
+		{
+			name:        "already run",
+			cronCommand: cronCommand("0 * * * *", nil, at(time.Hour)),
+			now:         *at(90 * time.Minute),
+			wantNext:    *at(2 * time.Hour),
+		},
+		{
+			name:        "too many missed skips to the latest",
+			cronCommand: cronCommand("* * * * *", nil, nil),
+			now:         *at(48*time.Hour + 30*time.Second),
+			wantMissed:  *at(48 * time.Hour),
+			wantNext:    *at(48*time.Hour + time.Minute),
+			wantTooMany: true,
+		},
+		{
+			name:        "too many missed on a sparse schedule",
+			cronCommand: cronCommand("0 9 * * *", nil, nil),
+			now:         *at(200*24*time.Hour + 12*time.Hour),
+			wantMissed:  *at(200*24*time.Hour + 9*time.Hour),
+			wantNext:    *at(201*24*time.Hour + 9*time.Hour),
+			wantTooMany: true,
+		},
+		{
+			name:        "read in its time zone",
+			cronCommand: cronCommand("0 9 * * *", &newYork, nil),
+			now:         *at(15 * time.Hour),
+			wantMissed:  *at(14 * time.Hour),
+			wantNext:    *at(38 * time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := scheduleFor(tt.cronCommand)
+			if err != nil {
+				t.Fatalf("scheduleFor() error = %v", err)
+			}
+			missed, next, tooMany := nextSchedule(tt.cronCommand, sched, tt.now)
+			if !missed.Equal(tt.wantMissed) || !next.Equal(tt.wantNext) || tooMany != tt.wantTooMany {
+				t.Errorf("nextSchedule() = %v, %v, %v, want %v, %v, %v",
+					missed, next, tooMany, tt.wantMissed, tt.wantNext, tt.wantTooMany)
+			}
+		})
+	}
+}
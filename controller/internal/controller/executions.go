@@ -0,0 +1,411 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	"google.golang.org/grpc/status"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	grpcClient "github.com/motilayo/jarvis/controller/client"
+)
+
+const (
+	// defaultMaxConcurrentExecutions caps how many node executions run at
+	// once across all Commands.
+	defaultMaxConcurrentExecutions = 100
+	// defaultMaxExecutionsPerNode caps how many run at once on one node.
+	defaultMaxExecutionsPerNode = 4
+	// resultBuffer is how many node results may wait to be written to status
+	// before workers block on them.
+	resultBuffer = 1024
+	// drainTimeout is how long executions still running at shutdown are given
+	// to finish before their calls are dropped. It is below the manager's
+	// default graceful shutdown timeout, so their results are still written.
+	drainTimeout = 20 * time.Second
+)
+
+// nodeExecution is one node's share of a run. Everything else about it is
+// read from the Command when a worker picks it up, so a queued execution
+// always runs the spec it was claimed for, or not at all.
+type nodeExecution struct {
+	command    types.NamespacedName
+	uid        types.UID
+	hash       string
+	generation int64
+	node       string
+	// maxTimeout, if not 0, is the longest the command may run, as the
+	// command policies had it when the node was dispatched.
+	maxTimeout time.Duration
+}
+
+// resultUpdate is a node result on its way to the Command's status.
+type resultUpdate struct {
+	command types.NamespacedName
+	result  jarvisiov1.CommandResult
+}
+
+// executionQueue holds the node executions waiting to start. An execution
+// starts once fewer than the global limit are running in total and fewer than
+// the per-node limit on its node; executions for a node at its limit are
+// parked until one there finishes. The zero value is ready to use.
+type executionQueue struct {
+	mu       sync.Mutex
+	slot     *sync.Cond
+	queue    workqueue.TypedInterface[nodeExecution]
+	total    int
+	running  map[string]int
+	parked   map[string][]nodeExecution
+	shutdown bool
+}
+
+// add queues executions.
+func (q *executionQueue) add(executions ...nodeExecution) {
+	queue := q.get()
+	for _, e := range executions {
+		queue.Add(e)
+	}
+}
+
+// get returns the underlying queue, creating it on first use.
+func (q *executionQueue) get() workqueue.TypedInterface[nodeExecution] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.init()
+	return q.queue
+}
+
+// init creates what the zero value lacks. q.mu must be held.
+func (q *executionQueue) init() {
+	if q.queue == nil {
+		q.queue = workqueue.NewTypedWithConfig(workqueue.TypedQueueConfig[nodeExecution]{Name: "command-executions"})
+		q.slot = sync.NewCond(&q.mu)
+		q.running = map[string]int{}
+		q.parked = map[string][]nodeExecution{}
+	}
+}
+
+// next blocks until an execution may start and returns it, or returns false
+// once the queue is shut down. limits is asked for the global and per-node
+// limits each time, so changes to them apply straight away. The caller must
+// pass the execution to done when it finishes.
+func (q *executionQueue) next(limits func() (total, perNode int)) (nodeExecution, bool) {
+	queue := q.get()
+	for {
+		e, shutdown := queue.Get()
+		if shutdown {
+			return nodeExecution{}, false
+		}
+		queue.Done(e)
+
+		q.mu.Lock()
+		total, perNode := limits()
+		if q.running[e.node] >= perNode {
+			q.parked[e.node] = append(q.parked[e.node], e)
+			q.mu.Unlock()
+			continue
+		}
+		for q.total >= total && !q.shutdown {
+			q.slot.Wait()
+			total, _ = limits()
+		}
+		if q.shutdown {
+			q.mu.Unlock()
+			return nodeExecution{}, false
+		}
+		q.total++
+		q.running[e.node]++
+		q.mu.Unlock()
+		return e, true
+	}
+}
+
+// done frees the slots e held and queues the next execution parked for its
+// node, if any.
+func (q *executionQueue) done(e nodeExecution) {
+	q.mu.Lock()
+	q.total--
+	q.running[e.node]--
+	if q.running[e.node] == 0 {
+		delete(q.running, e.node)
+	}
+	var next []nodeExecution
+	if parked := q.parked[e.node]; len(parked) > 0 {
+		next = []nodeExecution{parked[0]}
+		if len(parked) == 1 {
+			delete(q.parked, e.node)
+		} else {
+			q.parked[e.node] = parked[1:]
+		}
+	}
+	q.slot.Broadcast()
+	q.mu.Unlock()
+	q.add(next...)
+}
+
+// wake re-checks the limits after they changed: a waiting execution may now
+// start, and parked ones are queued again to see if their node has room.
+func (q *executionQueue) wake() {
+	q.mu.Lock()
+	q.init()
+	var parked []nodeExecution
+	for node, executions := range q.parked {
+		parked = append(parked, executions...)
+		delete(q.parked, node)
+	}
+	q.slot.Broadcast()
+	q.mu.Unlock()
+	q.add(parked...)
+}
+
+// shutDown stops handing out executions. Whatever is still queued stays
+// Pending in status and is queued again by whichever controller leads next.
+func (q *executionQueue) shutDown() {
+	q.mu.Lock()
+	q.init()
+	q.shutdown = true
+	q.slot.Broadcast()
+	q.mu.Unlock()
+	q.queue.ShutDown()
+}
+
+// executionWorkers starts the queued executions. It only runs on the leader:
+// the queue is rebuilt from each Command's status by the reconciles that
+// follow a restart or a change of leader.
+type executionWorkers struct {
+	r *CommandReconciler
+}
+
+func (w executionWorkers) NeedLeaderElection() bool {
+	return true
+}
+
+// Start runs the queued executions, and writes their results to status,
+// until ctx is done.
+func (w executionWorkers) Start(ctx context.Context) error {
+	r := w.r
+	log := logf.FromContext(ctx).WithName("executions")
+	limits := func() (int, int) {
+		config := r.Config.Get()
+		if config.notReady() != "" {
+			// Hold everything until there is a certificate to call with
+			// and a key to sign with; advance reports the wait on each
+			// Command held up by it.
+			return 0, config.MaxExecutionsPerNode
+		}
+		return config.MaxConcurrentExecutions, config.MaxExecutionsPerNode
+	}
+
+	// Results are written even while shutting down, so nothing that
+	// finished is lost; the writer stops once every execution has.
+	updates := make(chan resultUpdate, resultBuffer)
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		r.recordResults(logf.IntoContext(context.Background(), log), updates)
+	}()
+	// Executions still running at shutdown get drainTimeout to finish;
+	// after that their calls are dropped.
+	execCtx, drop := context.WithCancel(context.WithoutCancel(ctx))
+	defer drop()
+	go func() {
+		<-ctx.Done()
+		r.executions.shutDown()
+		timer := time.NewTimer(drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			drop()
+		case <-execCtx.Done():
+		}
+	}()
+
+	log.Info("Running queued executions")
+	var wg sync.WaitGroup
+	for {
+		e, ok := r.executions.next(limits)
+		if !ok {
+			break
+		}
+		wg.Go(func() {
+			defer r.executions.done(e)
+			r.execute(logf.IntoContext(execCtx, log.WithValues("command", e.command, "node", e.node)), e, updates)
+		})
+	}
+	wg.Wait()
+	close(updates)
+	<-recorded
+	return nil
+}
+
+// execute runs the command on one node and reports its progress on updates.
+// The call is dropped when ctx is done, i.e. when the controller shuts down.
+func (r *CommandReconciler) execute(ctx context.Context, e nodeExecution, updates chan<- resultUpdate) {
+	log := logf.FromContext(ctx)
+
+	// Deleting the Command cancels runCtx; see cancelExecutions.
+	runCtx, finished := r.inflight.begin(e.uid)
+	defer finished()
+	callCtx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+	if !r.runs.sent(e.uid, e.hash, e.node) {
+		// The Command was deleted, or its run replaced, while this waited.
+		return
+	}
+	cmd := &jarvisiov1.Command{}
+	if err := r.Get(ctx, e.command, cmd); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "Failed to get Command for execution")
+		}
+		return
+	}
+	if cmd.UID != e.uid || cmd.DeletionTimestamp != nil || specHash(&cmd.Spec) != e.hash {
+		return
+	}
+	report := func(result jarvisiov1.CommandResult) {
+		result.Node = e.node
+		result.Generation = e.generation
+		updates <- resultUpdate{command: e.command, result: result}
+	}
+
+	agents, err := r.agentAddresses(ctx)
+	if err != nil {
+		return
+	}
+	addr := agents[e.node]
+	if addr == "" {
+		report(r.agentNotFound(cmd, e.node))
+		return
+	}
+
+	config := r.Config.Get()
+	opts := executionOptions(cmd, config)
+	if e.maxTimeout > 0 && (opts.Timeout == 0 || opts.Timeout > e.maxTimeout) {
+		opts.Timeout = e.maxTimeout
+	}
+	opts.Breaker = &r.breaker
+	opts.Pool = &r.pool
+	opts.ServerName = config.serverName(e.node)
+	opts.ID = executionID(e.uid, e.generation, e.node)
+	opts.Signer = config.Signer
+	opts.CommandUID = string(e.uid)
+
+	startTime := ptr.To(metav1.Now())
+	attempts := int32(1)
+	report(jarvisiov1.CommandResult{Phase: jarvisiov1.NodeRunning, Attempts: attempts, StartTime: startTime})
+
+	received := 0
+	opts.OnOutput = func(stream pb.Stream, data []byte) {
+		received += len(data)
+		log.V(1).Info("command output", "stream", stream.String(), "bytes", received)
+	}
+	opts.OnAttempt = func(attempt int, reason error) {
+		log.Info("retrying command", "attempt", attempt, "reason", reason.Error())
+		attempts = int32(attempt)
+		report(jarvisiov1.CommandResult{
+			Phase:     jarvisiov1.NodeRunning,
+			Message:   fmt.Sprintf("retrying after: %v", reason),
+			Attempts:  attempts,
+			StartTime: startTime,
+		})
+	}
+	result, err := grpcClient.RunCommandOnNode(callCtx, addr, e.node, cmd.Spec.Command, opts)
+	if runCtx.Err() != nil {
+		// The Command is being deleted; nothing is left to report to.
+		log.Info("command cancelled")
+		return
+	}
+	if ctx.Err() != nil {
+		log.Info("controller shut down before the node reported back")
+		report(jarvisiov1.CommandResult{
+			Phase:     jarvisiov1.NodeFailed,
+			Reason:    reasonInterrupted,
+			Message:   "controller shut down before the node reported back; not re-run",
+			Attempts:  attempts,
+			StartTime: startTime,
+			EndTime:   ptr.To(metav1.Now()),
+		})
+		return
+	}
+	eventName := fmt.Sprintf("%s-%s", cmd.Name, e.node)
+	if errors.Is(err, grpcClient.ErrCircuitOpen) {
+		r.Recorder.Event(cmd, corev1.EventTypeWarning, eventName, fmt.Sprintf("Skipped %s: %v", e.node, err))
+		report(jarvisiov1.CommandResult{
+			Phase:     jarvisiov1.NodeSkipped,
+			Reason:    reasonAgentUnhealthy,
+			Message:   err.Error(),
+			Attempts:  attempts,
+			StartTime: startTime,
+			EndTime:   ptr.To(metav1.Now()),
+		})
+		return
+	}
+	if rule, denied := grpcClient.DeniedByNodePolicy(err); denied {
+		// The node itself refuses the command; trying again will not help.
+		msg := status.Convert(err).Message()
+		log.Info("command refused by node policy", "rule", rule)
+		r.Recorder.Event(cmd, corev1.EventTypeWarning, eventName, fmt.Sprintf("Refused by %s: %s", e.node, msg))
+		report(jarvisiov1.CommandResult{
+			Phase:     jarvisiov1.NodeFailed,
+			Reason:    reasonNodePolicy,
+			Message:   msg,
+			Attempts:  attempts,
+			StartTime: startTime,
+			EndTime:   ptr.To(metav1.Now()),
+		})
+		return
+	}
+	if err != nil {
+		log.Error(err, "command failed")
+		r.Recorder.Event(cmd, corev1.EventTypeWarning, eventName, fmt.Sprintf("Failed on %s: %v", e.node, err))
+		report(jarvisiov1.CommandResult{
+			Phase:     jarvisiov1.NodeFailed,
+			Reason:    reasonAgentError,
+			Message:   err.Error(),
+			Attempts:  attempts,
+			StartTime: startTime,
+			EndTime:   ptr.To(metav1.Now()),
+		})
+		return
+	}
+	nodeResult := resultFromProto(e.node, result)
+	nodeResult.Attempts = attempts
+	log.Info("command finished", "phase", nodeResult.Phase, "outcome", nodeResult.Outcome,
+		"exitCode", nodeResult.ExitCode, "signal", nodeResult.Signal, "spawnError", nodeResult.SpawnError,
+		"duration", nodeResult.Duration, "maxRSSBytes", nodeResult.MaxRSSBytes)
+	eventType := corev1.EventTypeNormal
+	if nodeResult.Outcome != jarvisiov1.OutcomeCompleted {
+		eventType = corev1.EventTypeWarning
+	}
+	r.Recorder.Event(cmd, eventType, eventName, grpcClient.FormatResult(cmd.Spec.Command, result))
+	report(nodeResult)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// startNext calls q.next in the background. What it hands out arrives on the
+// returned channel; nothing does if the queue is shut down first.
+func startNext(q *executionQueue, limits func() (int, int)) <-chan nodeExecution {
+	next := make(chan nodeExecution, 1)
+	go func() {
+		if e, ok := q.next(limits); ok {
+			next <- e
+		}
+	}()
+	return next
+}
+
+// receive returns what arrives on next within wait, and whether anything did.
+func receive(next <-chan nodeExecution, wait time.Duration) (nodeExecution, bool) {
+	select {
+	case e := <-next:
+		return e, true
+	case <-time.After(wait):
+		return nodeExecution{}, false
+	}
+}
+
+// queueNodes queues one execution on each of nodes, in order.
+func queueNodes(q *executionQueue, nodes ...string) {
+	for i, node := range nodes {
+		q.add(nodeExecution{uid: types.UID(fmt.Sprint(i)), node: node})
+	}
+}
+
+func TestExecutionQueueLimits(t *testing.T) {
+	tests := []struct {
+		name           string
+		total, perNode int
+		nodes          []string
+		// want is the nodes handed out, in order, before next blocks.
+		want []string
+		// then is the node handed out once the first finishes; "" means next
+		// keeps waiting.
+		then string
+	}{
+		{"under both limits", 10, 4, []string{"a", "b", "a"}, []string{"a", "b", "a"}, ""},
+		{"global limit", 2, 4, []string{"a", "b", "c"}, []string{"a", "b"}, "c"},
+		{"per-node limit parks", 10, 1, []string{"a", "a", "b"}, []string{"a", "b"}, "a"},
+		{"parked behind the global limit", 2, 1, []string{"a", "a", "b", "c"}, []string{"a", "b"}, "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var q executionQueue
+			defer q.shutDown()
+			limits := func() (int, int) { return tt.total, tt.perNode }
+			queueNodes(&q, tt.nodes...)
+
+			var started []nodeExecution
+			for _, want := range tt.want {
+				e, ok := receive(startNext(&q, limits), time.Second)
+				if !ok || e.node != want {
+					t.Fatalf("next() = %q, %v, want %q", e.node, ok, want)
+				}
+				started = append(started, e)
+			}
+			next := startNext(&q, limits)
+			if e, ok := receive(next, 50*time.Millisecond); ok {
+				t.Fatalf("next() = %q, want it to wait", e.node)
+			}
+
+			q.done(started[0])
+			wait := time.Second
+			if tt.then == "" {
+				wait = 50 * time.Millisecond
+			}
+			if e, _ := receive(next, wait); e.node != tt.then {
+				t.Errorf("next() after done = %q, want %q", e.node, tt.then)
+			}
+		})
+	}
+}
+
+func TestExecutionQueueWake(t *testing.T) {
+	var total, perNode atomic.Int32
+	perNode.Store(1)
+	limits := func() (int, int) { return int(total.Load()), int(perNode.Load()) }
+
+	var q executionQueue
+	defer q.shutDown()
+	queueNodes(&q, "a", "a")
+
+	// With no room at all, as before there is a certificate, next waits.
+	next := startNext(&q, limits)
+	if e, ok := receive(next, 50*time.Millisecond); ok {
+		t.Fatalf("next() = %q with a global limit of 0", e.node)
+	}
+	total.Store(10)
+	q.wake()
+	if _, ok := receive(next, time.Second); !ok {
+		t.Fatal("raising the global limit did not start an execution")
+	}
+
+	next = startNext(&q, limits)
+	if e, ok := receive(next, 50*time.Millisecond); ok {
+		t.Fatalf("next() = %q over the per-node limit", e.node)
+	}
+	perNode.Store(2)
+	q.wake()
+	if _, ok := receive(next, time.Second); !ok {
+		t.Fatal("raising the per-node limit did not start the parked execution")
+	}
+}
+
+func TestExecutionQueueShutDown(t *testing.T) {
+	var q executionQueue
+	queueNodes(&q, "a")
+	done := make(chan bool)
+	go func() {
+		_, ok := q.next(func() (int, int) { return 0, 1 })
+		done <- ok
+	}()
+	time.Sleep(50 * time.Millisecond)
+	q.shutDown()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("next() handed out an execution after shutDown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("next() still waiting after shutDown")
+	}
+	if _, ok := q.next(func() (int, int) { return 10, 4 }); ok {
+		t.Error("next() on a shut down queue handed out an execution")
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// configRefreshInterval is how often the JarvisConfig is reloaded even if it
+// has not changed, to pick up a rotated TLS Secret.
+const configRefreshInterval = 5 * time.Minute
+
+// Reasons recorded on the JarvisConfig's Valid condition.
+const (
+	reasonAccepted      = "Accepted"
+	reasonInvalidConfig = "InvalidConfig"
+)
+
+// JarvisConfigReconciler reconciles the JarvisConfig object, putting it into
+// effect through Config.
+type JarvisConfigReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// APIReader reads the TLS Secret straight from the API server, so the
+	// controller does not have to cache every Secret in the cluster.
+	APIReader client.Reader
+	Config    *ConfigStore
+}
+
+// +kubebuilder:rbac:groups=jarvis.io,resources=jarvisconfigs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=jarvis.io,resources=jarvisconfigs/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+func (r *JarvisConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+
+	jarvisConfig := &jarvisiov1.JarvisConfig{}
+	if err := r.Get(ctx, req.NamespacedName, jarvisConfig); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("No JarvisConfig; using defaults")
+			r.Config.set(r.Config.defaults())
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Unable to fetch JarvisConfig")
+		return ctrl.Result{}, err
+	}
+
+	config, err := r.load(ctx, jarvisConfig)
+	condition := metav1.Condition{
+		Type:               jarvisiov1.ConditionValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonAccepted,
+		Message:            "configuration in use",
+		ObservedGeneration: jarvisConfig.Generation,
+	}
+	if err != nil {
+		// Keep running with whatever was in effect before.
+		log.Error(err, "Invalid JarvisConfig")
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonInvalidConfig
+		condition.Message = err.Error()
+	} else {
+		r.Config.set(config)
+	}
+
+	before := jarvisConfig.Status.DeepCopy()
+	jarvisConfig.Status.ObservedGeneration = jarvisConfig.Generation
+	meta.SetStatusCondition(&jarvisConfig.Status.Conditions, condition)
+	if !equality.Semantic.DeepEqual(before, &jarvisConfig.Status) {
+		if err := r.Status().Update(ctx, jarvisConfig); err != nil {
+			log.Error(err, "Failed to update JarvisConfig status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{RequeueAfter: configRefreshInterval}, nil
+}
+
+// load builds the Config that jarvisConfig describes, reporting everything
+// wrong with it at once.
+func (r *JarvisConfigReconciler) load(ctx context.Context, jarvisConfig *jarvisiov1.JarvisConfig) (Config, error) {
+	spec := jarvisConfig.Spec
+	config := r.Config.defaults()
+	if spec.Agent.Namespace != "" {
+		config.AgentNamespace = spec.Agent.Namespace
+	}
+	if spec.Agent.Service != "" {
+		config.AgentService = spec.Agent.Service
+	}
+	if spec.Agent.Port != 0 {
+		config.AgentPort = spec.Agent.Port
+	}
+	config.Defaults = spec.Defaults
+	if n := spec.Limits.MaxConcurrentExecutions; n != nil {
+		config.MaxConcurrentExecutions = int(*n)
+	}
+	if n := spec.Limits.MaxExecutionsPerNode; n != nil {
+		config.MaxExecutionsPerNode = int(*n)
+	}
+	config.MaxOutputLimit = spec.Limits.MaxOutputLimit
+
+	var errs []error
+	if d := spec.Defaults.Timeout; d != nil && d.Duration < 0 {
+		errs = append(errs, errors.New("defaults.timeout must not be negative"))
+	}
+	if d := spec.Defaults.GracePeriod; d != nil && d.Duration < 0 {
+		errs = append(errs, errors.New("defaults.gracePeriod must not be negative"))
+	}
+	if q := spec.Defaults.OutputLimit; q != nil && q.Sign() <= 0 {
+		errs = append(errs, errors.New("defaults.outputLimit must be positive"))
+	}
+	if q := spec.Limits.MaxOutputLimit; q != nil && q.Sign() <= 0 {
+		errs = append(errs, errors.New("limits.maxOutputLimit must be positive"))
+	}
+	if def, limit := spec.Defaults.OutputLimit, spec.Limits.MaxOutputLimit; def != nil && limit != nil && def.Cmp(*limit) > 0 {
+		errs = append(errs, fmt.Errorf("defaults.outputLimit %s is above limits.maxOutputLimit %s", def, limit))
+	}
+	if t := spec.Agent.TLS; t != nil {
+		if t.Mode != "" {
+			config.TLSMode = t.Mode
+		}
+		if t.CertificateLifetime != nil {
+			config.CertificateLifetime = t.CertificateLifetime.Duration
+		}
+		if config.CertificateLifetime < time.Hour {
+			errs = append(errs, errors.New("agent.tls.certificateLifetime must be at least 1h"))
+		}
+		if config.TLSMode == jarvisiov1.TLSProvided {
+			tlsConfig, source, err := r.loadTLS(ctx, config.AgentNamespace, t)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			config.TLS, config.tlsSource = tlsConfig, source
+		}
+	}
+	return config, errors.Join(errs...)
+}
+
+// loadTLS builds the client TLS configuration from the Secret named in t.
+func (r *JarvisConfigReconciler) loadTLS(ctx context.Context, namespace string, t *jarvisiov1.AgentTLS) (*tls.Config, string, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: namespace, Name: t.SecretName}
+	if err := r.APIReader.Get(ctx, key, secret); err != nil {
+		return nil, "", fmt.Errorf("agent.tls.secretName: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(secret.Data["ca.crt"]) {
+		return nil, "", fmt.Errorf("agent.tls.secretName: Secret %s has no valid certificates in ca.crt", key)
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:    roots,
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, "", fmt.Errorf("agent.tls.secretName: Secret %s: %w", key, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	source := fmt.Sprintf("%s@%s/%s", key, secret.ResourceVersion, t.ServerName)
+	return tlsConfig, source, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *JarvisConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&jarvisiov1.JarvisConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Named("jarvisconfig").
+		Complete(r)
+}
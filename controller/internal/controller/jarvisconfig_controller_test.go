@@ -0,0 +1,88 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+var _ = Describe("JarvisConfig Controller", func() {
+	Context("When reconciling a resource", func() {
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name: jarvisiov1.JarvisConfigName,
+		}
+		jarvisconfig := &jarvisiov1.JarvisConfig{}
+
+		BeforeEach(func() {
+			By("creating the custom resource for the Kind JarvisConfig")
+			err := k8sClient.Get(ctx, typeNamespacedName, jarvisconfig)
+			if err != nil && errors.IsNotFound(err) {
+				resource := &jarvisiov1.JarvisConfig{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: jarvisiov1.JarvisConfigName,
+					},
+					Spec: jarvisiov1.JarvisConfigSpec{
+						Agent: jarvisiov1.AgentConfig{Port: 50052},
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			resource := &jarvisiov1.JarvisConfig{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance JarvisConfig")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+		It("should successfully reconcile the resource", func() {
+			By("Reconciling the created resource")
+			config := &ConfigStore{}
+			controllerReconciler := &JarvisConfigReconciler{
+				Client:    k8sClient,
+				Scheme:    k8sClient.Scheme(),
+				APIReader: k8sClient,
+				Config:    config,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that the configuration is in effect")
+			Expect(config.Get().AgentPort).To(Equal(int32(50052)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, jarvisconfig)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(jarvisconfig.Status.Conditions, jarvisiov1.ConditionValid)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,56 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	grpcClient "github.com/motilayo/jarvis/controller/client"
+)
+
+var (
+	poolOpenDesc = prometheus.NewDesc("jarvis_agent_connections",
+		"Open connections to agents, by connectivity state.", []string{"state"}, nil)
+	poolDialsDesc = prometheus.NewDesc("jarvis_agent_connection_dials_total",
+		"Connections opened to agents.", nil, nil)
+	poolReusesDesc = prometheus.NewDesc("jarvis_agent_connection_reuses_total",
+		"Calls to agents served by a connection that was already open.", nil, nil)
+	poolDroppedDesc = prometheus.NewDesc("jarvis_agent_connection_drops_total",
+		"Connections closed because their agent went away or changed address.", nil, nil)
+)
+
+// poolCollector exports the agent connection pool's stats as metrics.
+type poolCollector struct {
+	pool *grpcClient.Pool
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolOpenDesc
+	ch <- poolDialsDesc
+	ch <- poolReusesDesc
+	ch <- poolDroppedDesc
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pool.Stats()
+	for state, n := range stats.States {
+		ch <- prometheus.MustNewConstMetric(poolOpenDesc, prometheus.GaugeValue, float64(n), state)
+	}
+	ch <- prometheus.MustNewConstMetric(poolDialsDesc, prometheus.CounterValue, float64(stats.Dials))
+	ch <- prometheus.MustNewConstMetric(poolReusesDesc, prometheus.CounterValue, float64(stats.Reuses))
+	ch <- prometheus.MustNewConstMetric(poolDroppedDesc, prometheus.CounterValue, float64(stats.Dropped))
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	"github.com/motilayo/jarvis/controller/internal/policy"
+)
+
+// quotaRecheckInterval bounds how long a Command held back by a quota waits
+// before looking again. Executions of other Commands finishing can free the
+// quota sooner than the window would.
+const quotaRecheckInterval = 30 * time.Second
+
+// +kubebuilder:rbac:groups=jarvis.io,resources=commandpolicies;clustercommandpolicies,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// skipByPolicy returns the nodes the policies let cmd run on. Each of the
+// others is passed to skip as a Skipped result.
+func (r *CommandReconciler) skipByPolicy(cmd *jarvisiov1.Command, policies policy.Set, nodes []corev1.Node,
+	skip func(jarvisiov1.CommandResult)) []corev1.Node {
+	if len(policies) == 0 {
+		return nodes
+	}
+	commandViolations := policies.CheckExecution(&cmd.Spec)
+	allowed := nodes[:0:0]
+	for _, node := range nodes {
+		violations := commandViolations
+		if len(violations) == 0 {
+			violations = policies.CheckNode(node.Labels)
+		}
+		if len(violations) == 0 {
+			allowed = append(allowed, node)
+			continue
+		}
+		skip(jarvisiov1.CommandResult{
+			Node:       node.Name,
+			Phase:      jarvisiov1.NodeSkipped,
+			Reason:     reasonPolicyViolation,
+			Message:    violations[0].String(),
+			Generation: cmd.Status.RunGeneration,
+		})
+	}
+	if skipped := len(nodes) - len(allowed); skipped > 0 {
+		r.Recorder.Eventf(cmd, corev1.EventTypeWarning, reasonPolicyViolation,
+			"Skipped %d of %d nodes a command policy keeps the command off", skipped, len(nodes))
+	}
+	return allowed
+}
+
+// capParallel returns strategy with its batch sizes for total nodes brought
+// within the policies' maxParallel.
+func capParallel(strategy *jarvisiov1.RolloutStrategy, policies policy.Set, total int) *jarvisiov1.RolloutStrategy {
+	limit := policies.MaxParallel()
+	if limit == 0 {
+		return strategy
+	}
+	capped := &jarvisiov1.RolloutStrategy{}
+	if strategy != nil {
+		capped = strategy.DeepCopy()
+	}
+	if scaledValue(capped.MaxParallel, total, total, true) > limit {
+		capped.MaxParallel = ptr.To(intstr.FromInt(limit))
+	}
+	if scaledValue(capped.Canary, total, 0, true) > limit {
+		capped.Canary = ptr.To(intstr.FromInt(limit))
+	}
+	return capped
+}
+
+// executionQuota returns how many more node executions the policies let
+// cmd's namespace start now, or -1 if there is no limit. When the quota is
+// used up it also returns the violation and how long to wait before looking
+// again.
+func (r *CommandReconciler) executionQuota(ctx context.Context, cmd *jarvisiov1.Command, policies policy.Set) (int, *policy.Violation, time.Duration, error) {
+	remaining := -1
+	var held *policy.Violation
+	var wait time.Duration
+	var commands *jarvisiov1.CommandList
+	now := time.Now()
+	for _, p := range policies {
+		quota := p.Spec.Quota
+		if quota == nil {
+			continue
+		}
+		if commands == nil {
+			commands = &jarvisiov1.CommandList{}
+			if err := r.List(ctx, commands, client.InNamespace(cmd.Namespace)); err != nil {
+				return 0, nil, 0, fmt.Errorf("listing Commands to count executions against the quota: %w", err)
+			}
+		}
+		since := now.Add(-quota.Window.Duration)
+		used, next := 0, quotaRecheckInterval
+		for _, c := range commands.Items {
+			for _, result := range c.Status.Results {
+				switch {
+				case result.Phase == jarvisiov1.NodeRunning:
+					used++
+				case result.StartTime != nil && result.StartTime.After(since):
+					used++
+					next = min(next, result.StartTime.Add(quota.Window.Duration).Sub(now))
+				}
+			}
+		}
+		left := max(int(quota.MaxExecutions)-used, 0)
+		if remaining < 0 || left < remaining {
+			remaining = left
+		}
+		if left == 0 {
+			wait = max(wait, next, time.Second)
+			if held == nil {
+				held = &policy.Violation{
+					Policy: p.Name,
+					Reason: policy.ReasonQuotaExceeded,
+					Message: fmt.Sprintf("%d of %d executions per %s used; remaining nodes wait",
+						used, quota.MaxExecutions, quota.Window.Duration),
+				}
+			}
+		}
+	}
+	return remaining, held, wait, nil
+}
+
+// policyViolations lists how the policies currently hold cmd back, leaving
+// aside the quota.
+func policyViolations(cmd *jarvisiov1.Command, policies policy.Set, config Config) []policy.Violation {
+	violations := policies.CheckExecution(&cmd.Spec)
+	if len(violations) == 0 {
+		skipped := 0
+		for _, result := range cmd.Status.Results {
+			if result.Reason == reasonPolicyViolation {
+				skipped++
+			}
+		}
+		if skipped > 0 {
+			violations = append(violations, policy.Violation{
+				Reason:  policy.ReasonNodeNotAllowed,
+				Message: fmt.Sprintf("%d selected nodes are outside a command policy's nodeSelector", skipped),
+			})
+		}
+	}
+	if limit := policies.MaxTimeout(); limit > 0 {
+		timeout := cmp.Or(cmd.Spec.Timeout, config.Defaults.Timeout)
+		if timeout == nil || timeout.Duration > limit {
+			violations = append(violations, policy.Violation{
+				Reason:  policy.ReasonTimeoutNotAllowed,
+				Message: fmt.Sprintf("timeout lowered to the %s a command policy allows", limit),
+			})
+		}
+	}
+	return violations
+}
+
+// setPolicyViolation reports violations in the PolicyViolation condition.
+func setPolicyViolation(status *jarvisiov1.CommandStatus, violations []policy.Violation, generation int64) {
+	if len(violations) > 0 {
+		messages := make([]string, 0, len(violations))
+		for _, v := range violations {
+			messages = append(messages, v.String())
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               jarvisiov1.ConditionPolicyViolation,
+			Status:             metav1.ConditionTrue,
+			Reason:             violations[0].Reason,
+			Message:            strings.Join(messages, "; "),
+			ObservedGeneration: generation,
+		})
+		return
+	}
+	if meta.FindStatusCondition(status.Conditions, jarvisiov1.ConditionPolicyViolation) != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               jarvisiov1.ConditionPolicyViolation,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonPolicyCompliant,
+			ObservedGeneration: generation,
+		})
+	}
+}
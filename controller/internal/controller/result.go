@@ -0,0 +1,180 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	pb "github.com/motilayo/jarvis/agent/pb"
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+const (
+	// outputExcerptBytes is the most of the end of Stdout and of Stderr kept
+	// in a node's entry in status.
+	outputExcerptBytes = 1024
+	// statusOutputBytes is how much output status holds across every node's
+	// entry. The whole Command has to fit in one etcd object, so each node's
+	// excerpts shrink as the number of nodes grows.
+	statusOutputBytes = 256 << 10
+)
+
+var outcomes = map[pb.Outcome]jarvisiov1.CommandOutcome{
+	pb.Outcome_OUTCOME_COMPLETED:       jarvisiov1.OutcomeCompleted,
+	pb.Outcome_OUTCOME_TIMED_OUT:       jarvisiov1.OutcomeTimedOut,
+	pb.Outcome_OUTCOME_CANCELLED:       jarvisiov1.OutcomeCancelled,
+	pb.Outcome_OUTCOME_FAILED_TO_START: jarvisiov1.OutcomeFailedToStart,
+}
+
+var privileges = map[pb.Privilege]jarvisiov1.Privilege{
+	pb.Privilege_PRIVILEGE_READ_ONLY:  jarvisiov1.PrivilegeReadOnly,
+	pb.Privilege_PRIVILEGE_READ_WRITE: jarvisiov1.PrivilegeReadWrite,
+}
+
+var resourceLimits = map[pb.Limit]jarvisiov1.ResourceLimit{
+	pb.Limit_LIMIT_CPU:      jarvisiov1.LimitCPU,
+	pb.Limit_LIMIT_MEMORY:   jarvisiov1.LimitMemory,
+	pb.Limit_LIMIT_OOM_KILL: jarvisiov1.LimitOOMKill,
+	pb.Limit_LIMIT_PIDS:     jarvisiov1.LimitPids,
+}
+
+var profiles = map[pb.Profile]jarvisiov1.Profile{
+	pb.Profile_PROFILE_FULL:             jarvisiov1.ProfileFull,
+	pb.Profile_PROFILE_DIAGNOSTIC:       jarvisiov1.ProfileDiagnostic,
+	pb.Profile_PROFILE_NETWORK_ISOLATED: jarvisiov1.ProfileNetworkIsolated,
+}
+
+// resultFromProto converts what an agent reported for node into the API form,
+// keeping only an excerpt of the output. Output that is not valid UTF-8 is
+// stored base64-encoded, since it would otherwise be mangled when serialized
+// to JSON.
+func resultFromProto(node string, r *pb.CommandResult) jarvisiov1.CommandResult {
+	encoding, encode := jarvisiov1.EncodingUTF8, func(b []byte) string { return string(excerpt(b, outputExcerptBytes)) }
+	if r.GetEncoding() == pb.Encoding_ENCODING_BINARY {
+		encoding, encode = jarvisiov1.EncodingBase64, func(b []byte) string {
+			return base64.StdEncoding.EncodeToString(excerpt(b, base64.StdEncoding.DecodedLen(outputExcerptBytes)))
+		}
+	}
+
+	result := jarvisiov1.CommandResult{
+		Node:          node,
+		Phase:         jarvisiov1.NodeSucceeded,
+		Stdout:        encode(r.GetStdout()),
+		Stderr:        encode(r.GetStderr()),
+		Encoding:      encoding,
+		Truncated:     r.GetTruncated(),
+		DroppedBytes:  r.GetDroppedBytes(),
+		ExitCode:      ptr.To(r.GetExitCode()),
+		Outcome:       outcomes[r.GetOutcome()],
+		Signal:        r.GetSignal(),
+		SpawnError:    r.GetSpawnError(),
+		StartTime:     timeFromProto(r.GetStartTime()),
+		EndTime:       timeFromProto(r.GetEndTime()),
+		Duration:      durationFromProto(r.GetDuration()),
+		MaxRSSBytes:   r.GetMaxRssBytes(),
+		UserCPUTime:   durationFromProto(r.GetUserCpuTime()),
+		SystemCPUTime: durationFromProto(r.GetSystemCpuTime()),
+		Privilege:     privileges[r.GetPrivilege()],
+		Profile:       profiles[r.GetProfile()],
+	}
+	for _, limit := range r.GetLimitsHit() {
+		if l, ok := resourceLimits[limit]; ok {
+			result.LimitsHit = append(result.LimitsHit, l)
+		}
+	}
+
+	switch {
+	case result.Outcome != jarvisiov1.OutcomeCompleted:
+		result.Phase, result.Reason = jarvisiov1.NodeFailed, string(result.Outcome)
+		result.Message = r.GetSpawnError()
+	case slices.Contains(result.LimitsHit, jarvisiov1.LimitOOMKill) && (result.Signal != "" || r.GetExitCode() != 0):
+		result.Phase, result.Reason = jarvisiov1.NodeFailed, reasonOOMKilled
+		result.Message = "a process was killed for going over the memory limit"
+	case result.Signal != "":
+		result.Phase, result.Reason = jarvisiov1.NodeFailed, reasonSignaled
+		result.Message = fmt.Sprintf("killed by %s", result.Signal)
+	case r.GetExitCode() != 0:
+		result.Phase, result.Reason = jarvisiov1.NodeFailed, reasonNonZeroExit
+		result.Message = fmt.Sprintf("exited with code %d", r.GetExitCode())
+	}
+	return result
+}
+
+// excerpt returns the last n bytes of b, starting on a rune boundary where
+// there is one nearby.
+func excerpt(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	start := len(b) - n
+	for i := start; i < len(b) && i < start+utf8.UTFMax; i++ {
+		if utf8.RuneStart(b[i]) {
+			return b[i:]
+		}
+	}
+	return b[start:]
+}
+
+// excerptBytes is how long each of Stdout and Stderr may be in every one of
+// n node entries, for status to stay within statusOutputBytes.
+func excerptBytes(n int) int {
+	return min(outputExcerptBytes, statusOutputBytes/(2*max(n, 1)))
+}
+
+// trimExcerpts shortens the output excerpts in status to their share of
+// statusOutputBytes. Base64 is cut at a group boundary so that it still
+// decodes.
+func trimExcerpts(status *jarvisiov1.CommandStatus) {
+	n := excerptBytes(len(status.Results))
+	trim := func(s string, encoding jarvisiov1.OutputEncoding) string {
+		if len(s) <= n {
+			return s
+		}
+		if encoding == jarvisiov1.EncodingBase64 {
+			return s[len(s)-n/4*4:]
+		}
+		return string(excerpt([]byte(s), n))
+	}
+	for i := range status.Results {
+		result := &status.Results[i]
+		result.Stdout = trim(result.Stdout, result.Encoding)
+		result.Stderr = trim(result.Stderr, result.Encoding)
+	}
+}
+
+func timeFromProto(ts *timestamppb.Timestamp) *metav1.Time {
+	if ts == nil {
+		return nil
+	}
+	t := metav1.NewTime(ts.AsTime())
+	return &t
+}
+
+func durationFromProto(d *durationpb.Duration) *metav1.Duration {
+	if d == nil {
+		return nil
+	}
+	return &metav1.Duration{Duration: d.AsDuration()}
+}
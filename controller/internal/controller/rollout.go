@@ -0,0 +1,269 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// specHash identifies the run a spec asks for: what is run on each node and
+// how. Fields that only steer a run, such as which nodes it targets, how it is
+// rolled out and retried, spec.applyToNewNodes and spec.paused, are left out,
+// so changing them never sends the command out again.
+func specHash(spec *jarvisiov1.CommandSpec) string {
+	run := jarvisiov1.CommandSpec{
+		Command:     spec.Command,
+		Timeout:     spec.Timeout,
+		Privilege:   spec.Privilege,
+		Profile:     spec.Profile,
+		GracePeriod: spec.GracePeriod,
+		OutputLimit: spec.OutputLimit,
+		Resources:   spec.Resources,
+		RunID:       spec.RunID,
+	}
+	data, _ := json.Marshal(run)
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// planBatches orders nodes by topology, then name, and splits them into the
+// batches the strategy asks for. Without a strategy every node is in one
+// batch.
+func planBatches(nodes []corev1.Node, strategy *jarvisiov1.RolloutStrategy) [][]corev1.Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	nodes = append([]corev1.Node(nil), nodes...)
+	var key string
+	if strategy != nil {
+		key = strategy.TopologyKey
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if a, b := nodes[i].Labels[key], nodes[j].Labels[key]; key != "" && a != b {
+			return a < b
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	if strategy == nil {
+		return [][]corev1.Node{nodes}
+	}
+
+	total := len(nodes)
+	var batches [][]corev1.Node
+	if canary := scaledValue(strategy.Canary, total, 0, true); canary > 0 {
+		canary = min(canary, total)
+		batches = append(batches, nodes[:canary])
+		nodes = nodes[canary:]
+	}
+	size := max(scaledValue(strategy.MaxParallel, total, total, true), 1)
+	for len(nodes) > 0 {
+		n := min(size, len(nodes))
+		if key != "" {
+			for i := 1; i < n; i++ {
+				if nodes[i].Labels[key] != nodes[0].Labels[key] {
+					n = i
+					break
+				}
+			}
+		}
+		batches = append(batches, nodes[:n])
+		nodes = nodes[n:]
+	}
+	return batches
+}
+
+// newNodeStrategy returns the strategy nodes that join a run after it started
+// are rolled out with: the run's own, without its canary, which has already
+// gone out, and with maxParallel taken of every node the run targets rather
+// than of the newcomers alone.
+func newNodeStrategy(strategy *jarvisiov1.RolloutStrategy, targeted int) *jarvisiov1.RolloutStrategy {
+	if strategy == nil {
+		return nil
+	}
+	s := strategy.DeepCopy()
+	s.Canary = nil
+	if s.MaxParallel != nil {
+		s.MaxParallel = ptr.To(intstr.FromInt(max(scaledValue(s.MaxParallel, targeted, targeted, true), 1)))
+	}
+	return s
+}
+
+// targetedNodes counts the nodes the run is meant to go out to: every result
+// but those skipped because the node has no agent, the creator may not run
+// commands there or a policy keeps the command off it.
+func targetedNodes(status *jarvisiov1.CommandStatus) int {
+	n := 0
+	for _, result := range status.Results {
+		if result.Phase == jarvisiov1.NodeSkipped {
+			switch result.Reason {
+			case reasonAgentNotFound, reasonForbidden, reasonPolicyViolation:
+				continue
+			}
+		}
+		n++
+	}
+	return n
+}
+
+// scaledValue resolves a count-or-percentage against total, falling back to
+// def when it is unset or malformed.
+func scaledValue(v *intstr.IntOrString, total, def int, roundUp bool) int {
+	if v == nil {
+		return def
+	}
+	n, err := intstr.GetScaledValueFromIntOrPercent(v, total, roundUp)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// nextBatch works out which nodes to send the command to now. It returns them
+// already claimed, along with how long to wait before looking again when the
+// next batch is held back by pauseBetweenBatches.
+func (r *CommandReconciler) nextBatch(cmd *jarvisiov1.Command, agents map[string]string) ([]target, time.Duration) {
+	status := &cmd.Status
+	strategy := cmd.Spec.Strategy
+
+	if strategy != nil && strategy.MaxFailures != nil {
+		targeted := targetedNodes(status)
+		budget := scaledValue(strategy.MaxFailures, targeted, targeted, false)
+		failed := 0
+		for _, result := range status.Results {
+			if result.Phase == jarvisiov1.NodeFailed {
+				failed++
+			}
+		}
+		if failed > budget {
+			r.abortRemaining(cmd, failed, budget)
+			return nil, 0
+		}
+	}
+
+	// The current batch is the earliest one that has not finished.
+	current := int32(-1)
+	for _, result := range status.Results {
+		if result.Phase != jarvisiov1.NodePending && result.Phase != jarvisiov1.NodeRunning {
+			continue
+		}
+		if current < 0 || result.Batch < current {
+			current = result.Batch
+		}
+	}
+	if current < 0 {
+		return nil, 0
+	}
+	status.CurrentBatch = current
+	if cmd.Spec.Paused {
+		return nil, 0
+	}
+
+	var pending []int
+	var started bool
+	var previousEnd time.Time
+	for i, result := range status.Results {
+		switch {
+		case result.Batch == current && result.Phase == jarvisiov1.NodePending:
+			pending = append(pending, i)
+		case result.Batch == current:
+			started = true
+		case result.Batch < current && result.EndTime != nil && result.EndTime.After(previousEnd):
+			previousEnd = result.EndTime.Time
+		}
+	}
+	if len(pending) == 0 {
+		// Everything in this batch is running; its results trigger the
+		// next reconcile.
+		return nil, 0
+	}
+	if !started && current > 0 && strategy != nil && strategy.PauseBetweenBatches != nil && !previousEnd.IsZero() {
+		if wait := time.Until(previousEnd.Add(strategy.PauseBetweenBatches.Duration)); wait > 0 {
+			return nil, wait
+		}
+	}
+
+	var targets []target
+	for _, i := range pending {
+		result := status.Results[i]
+		if agents[result.Node] == "" {
+			skipped := r.agentNotFound(cmd, result.Node)
+			skipped.Batch = result.Batch
+			status.Results[i] = skipped
+			continue
+		}
+		if !r.runs.claimNode(cmd.UID, status.SpecHash, result.Node) {
+			continue
+		}
+		targets = append(targets, target{node: result.Node})
+	}
+	return targets, 0
+}
+
+// abortRemaining skips every node that has not been sent the command yet
+// because the rollout went over its failure budget.
+func (r *CommandReconciler) abortRemaining(cmd *jarvisiov1.Command, failed, budget int) {
+	aborted := 0
+	for i, result := range cmd.Status.Results {
+		if result.Phase != jarvisiov1.NodePending {
+			continue
+		}
+		result.Phase = jarvisiov1.NodeSkipped
+		result.Reason = reasonAborted
+		result.Message = fmt.Sprintf("rollout aborted: %d nodes failed, more than maxFailures allows (%d)", failed, budget)
+		cmd.Status.Results[i] = result
+		aborted++
+	}
+	if aborted > 0 {
+		r.Recorder.Eventf(cmd, corev1.EventTypeWarning, "RolloutAborted",
+			"%d nodes failed, more than maxFailures allows (%d); %d nodes not run", failed, budget, aborted)
+	}
+}
+
+// setPaused reports spec.paused in the Paused condition.
+func setPaused(status *jarvisiov1.CommandStatus, paused bool, generation int64) {
+	if paused {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               jarvisiov1.ConditionPaused,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonPaused,
+			Message:            "no further batches start until spec.paused is cleared",
+			ObservedGeneration: generation,
+		})
+		return
+	}
+	if meta.FindStatusCondition(status.Conditions, jarvisiov1.ConditionPaused) != nil {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               jarvisiov1.ConditionPaused,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonResumed,
+			ObservedGeneration: generation,
+		})
+	}
+}
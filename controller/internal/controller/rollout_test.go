@@ -0,0 +1,362 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+const zoneLabel = "topology.kubernetes.io/zone"
+
+// zonedNodes returns nodes named after the keys of zones, in the zones given.
+func zonedNodes(zones map[string]string) []corev1.Node {
+	var nodes []corev1.Node
+	for name, zone := range zones {
+		nodes = append(nodes, corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{zoneLabel: zone}}})
+	}
+	return nodes
+}
+
+func TestPlanBatches(t *testing.T) {
+	five := zonedNodes(map[string]string{"a": "z2", "b": "z1", "c": "z1", "d": "z2", "e": "z1"})
+	tests := []struct {
+		name     string
+		nodes    []corev1.Node
+		strategy *jarvisiov1.RolloutStrategy
+		want     [][]string
+	}{
+		{"no nodes", nil, &jarvisiov1.RolloutStrategy{}, nil},
+		{"no strategy", five, nil, [][]string{{"a", "b", "c", "d", "e"}}},
+		{"empty strategy", five, &jarvisiov1.RolloutStrategy{}, [][]string{{"a", "b", "c", "d", "e"}}},
+		{
+			"maxParallel",
+			five, &jarvisiov1.RolloutStrategy{MaxParallel: ptr.To(intstr.FromInt(2))},
+			[][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			"maxParallel percentage rounds up",
+			five, &jarvisiov1.RolloutStrategy{MaxParallel: ptr.To(intstr.FromString("30%"))},
+			[][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+		},
+		{
+			"maxParallel 0 runs one at a time",
+			zonedNodes(map[string]string{"a": "z1", "b": "z1"}), &jarvisiov1.RolloutStrategy{MaxParallel: ptr.To(intstr.FromInt(0))},
+			[][]string{{"a"}, {"b"}},
+		},
+		{
+			"canary then maxParallel of every node",
+			five, &jarvisiov1.RolloutStrategy{Canary: ptr.To(intstr.FromInt(1)), MaxParallel: ptr.To(intstr.FromString("60%"))},
+			[][]string{{"a"}, {"b", "c", "d"}, {"e"}},
+		},
+		{
+			"canary larger than the fleet",
+			five, &jarvisiov1.RolloutStrategy{Canary: ptr.To(intstr.FromInt(10))},
+			[][]string{{"a", "b", "c", "d", "e"}},
+		},
+		{
+			"batches do not cross topology domains",
+			five, &jarvisiov1.RolloutStrategy{TopologyKey: zoneLabel, MaxParallel: ptr.To(intstr.FromInt(2))},
+			[][]string{{"b", "c"}, {"e"}, {"a", "d"}},
+		},
+		{
+			"topology order without maxParallel",
+			five, &jarvisiov1.RolloutStrategy{TopologyKey: zoneLabel},
+			[][]string{{"b", "c", "e"}, {"a", "d"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			for _, batch := range planBatches(tt.nodes, tt.strategy) {
+				var names []string
+				for _, node := range batch {
+					names = append(names, node.Name)
+				}
+				got = append(got, names)
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Errorf("planBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaledValue(t *testing.T) {
+	tests := []struct {
+		v       *intstr.IntOrString
+		roundUp bool
+		want    int
+	}{
+		{nil, true, 7},
+		{ptr.To(intstr.FromInt(3)), true, 3},
+		{ptr.To(intstr.FromString("25%")), true, 3},
+		{ptr.To(intstr.FromString("25%")), false, 2},
+		{ptr.To(intstr.FromString("three")), true, 7},
+	}
+	for _, tt := range tests {
+		if got := scaledValue(tt.v, 10, 7, tt.roundUp); got != tt.want {
+			t.Errorf("scaledValue(%v, 10, 7, %v) = %d, want %d", tt.v, tt.roundUp, got, tt.want)
+		}
+	}
+}
+
+func TestNewNodeStrategy(t *testing.T) {
+	strategy := &jarvisiov1.RolloutStrategy{
+		Canary:      ptr.To(intstr.FromInt(1)),
+		MaxParallel: ptr.To(intstr.FromString("50%")),
+		TopologyKey: zoneLabel,
+	}
+	got := newNodeStrategy(strategy, 10)
+	if got.Canary != nil {
+		t.Error("new nodes get a canary of their own")
+	}
+	if got.MaxParallel.IntValue() != 5 || got.TopologyKey != zoneLabel {
+		t.Errorf("newNodeStrategy() = %+v, want maxParallel 5 of the targeted nodes", got)
+	}
+	if strategy.Canary == nil {
+		t.Error("newNodeStrategy() changed the run's strategy")
+	}
+	if newNodeStrategy(nil, 10) != nil {
+		t.Error("newNodeStrategy(nil) is not nil")
+	}
+}
+
+func TestNextBatch(t *testing.T) {
+	result := func(node string, phase jarvisiov1.NodePhase, batch int32) jarvisiov1.CommandResult {
+		return jarvisiov1.CommandResult{Node: node, Phase: phase, Batch: batch}
+	}
+	ended := func(r jarvisiov1.CommandResult, ago time.Duration) jarvisiov1.CommandResult {
+		r.EndTime = ptr.To(metav1.NewTime(time.Now().Add(-ago)))
+		return r
+	}
+	skipped := func(node, reason string) jarvisiov1.CommandResult {
+		return jarvisiov1.CommandResult{Node: node, Phase: jarvisiov1.NodeSkipped, Reason: reason}
+	}
+	agents := map[string]string{"a": "10.0.0.1:50051", "b": "10.0.0.2:50051", "c": "10.0.0.3:50051"}
+	tests := []struct {
+		name     string
+		strategy *jarvisiov1.RolloutStrategy
+		paused   bool
+		results  []jarvisiov1.CommandResult
+		want     []string
+		wantWait bool
+		// wantBatch is the batch reported as current.
+		wantBatch int32
+		// wantSkipped maps nodes the call skips to the reason it gives.
+		wantSkipped map[string]string
+	}{
+		{
+			name:    "first batch",
+			results: []jarvisiov1.CommandResult{result("a", jarvisiov1.NodePending, 0), result("b", jarvisiov1.NodePending, 1)},
+			want:    []string{"a"},
+		},
+		{
+			name:    "batch still running",
+			results: []jarvisiov1.CommandResult{result("a", jarvisiov1.NodeRunning, 0), result("b", jarvisiov1.NodePending, 1)},
+		},
+		{
+			name:      "next batch",
+			results:   []jarvisiov1.CommandResult{result("a", jarvisiov1.NodeSucceeded, 0), result("b", jarvisiov1.NodePending, 1), result("c", jarvisiov1.NodePending, 1)},
+			want:      []string{"b", "c"},
+			wantBatch: 1,
+		},
+		{
+			name:      "paused",
+			paused:    true,
+			results:   []jarvisiov1.CommandResult{result("a", jarvisiov1.NodeSucceeded, 0), result("b", jarvisiov1.NodePending, 1)},
+			wantBatch: 1,
+		},
+		{
+			name:     "pause between batches",
+			strategy: &jarvisiov1.RolloutStrategy{PauseBetweenBatches: &metav1.Duration{Duration: time.Hour}},
+			results: []jarvisiov1.CommandResult{
+				ended(result("a", jarvisiov1.NodeSucceeded, 0), time.Minute), result("b", jarvisiov1.NodePending, 1),
+			},
+			wantWait:  true,
+			wantBatch: 1,
+		},
+		{
+			name:     "pause over",
+			strategy: &jarvisiov1.RolloutStrategy{PauseBetweenBatches: &metav1.Duration{Duration: time.Minute}},
+			results: []jarvisiov1.CommandResult{
+				ended(result("a", jarvisiov1.NodeSucceeded, 0), time.Hour), result("b", jarvisiov1.NodePending, 1),
+			},
+			want:      []string{"b"},
+			wantBatch: 1,
+		},
+		{
+			name:        "agent gone",
+			results:     []jarvisiov1.CommandResult{result("a", jarvisiov1.NodePending, 0), result("x", jarvisiov1.NodePending, 0)},
+			want:        []string{"a"},
+			wantSkipped: map[string]string{"x": reasonAgentNotFound},
+		},
+		{
+			name:     "over the failure budget",
+			strategy: &jarvisiov1.RolloutStrategy{MaxFailures: ptr.To(intstr.FromInt(0))},
+			results: []jarvisiov1.CommandResult{
+				result("a", jarvisiov1.NodeFailed, 0), result("b", jarvisiov1.NodePending, 1), result("c", jarvisiov1.NodePending, 1),
+			},
+			wantSkipped: map[string]string{"b": reasonAborted, "c": reasonAborted},
+		},
+		{
+			name:     "within the failure budget",
+			strategy: &jarvisiov1.RolloutStrategy{MaxFailures: ptr.To(intstr.FromInt(1))},
+			results: []jarvisiov1.CommandResult{
+				result("a", jarvisiov1.NodeFailed, 0), result("b", jarvisiov1.NodePending, 1),
+			},
+			want:      []string{"b"},
+			wantBatch: 1,
+		},
+		{
+			// Nodes the run never meant to reach do not widen the budget.
+			name:     "failure budget of the targeted nodes",
+			strategy: &jarvisiov1.RolloutStrategy{MaxFailures: ptr.To(intstr.FromString("50%"))},
+			results: []jarvisiov1.CommandResult{
+				result("a", jarvisiov1.NodeFailed, 0), result("b", jarvisiov1.NodeFailed, 0), result("c", jarvisiov1.NodePending, 1),
+				skipped("x", reasonAgentNotFound), skipped("y", reasonForbidden), skipped("z", reasonPolicyViolation),
+			},
+			wantSkipped: map[string]string{"c": reasonAborted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &CommandReconciler{Recorder: record.NewFakeRecorder(10)}
+			cmd := &jarvisiov1.Command{
+				ObjectMeta: metav1.ObjectMeta{Name: "uptime", UID: "uid"},
+				Spec:       jarvisiov1.CommandSpec{Command: "uptime", Strategy: tt.strategy, Paused: tt.paused},
+				Status:     jarvisiov1.CommandStatus{SpecHash: "hash", Results: slices.Clone(tt.results)},
+			}
+			targets, wait := r.nextBatch(cmd, agents)
+			var got []string
+			for _, target := range targets {
+				got = append(got, target.node)
+			}
+			if !slices.Equal(got, tt.want) || (wait > 0) != tt.wantWait {
+				t.Errorf("nextBatch() = %v, %s, want %v, waiting %v", got, wait, tt.want, tt.wantWait)
+			}
+			if cmd.Status.CurrentBatch != tt.wantBatch {
+				t.Errorf("CurrentBatch = %d, want %d", cmd.Status.CurrentBatch, tt.wantBatch)
+			}
+			for i, result := range cmd.Status.Results {
+				want, ok := tt.wantSkipped[result.Node]
+				if !ok {
+					if result.Phase != tt.results[i].Phase {
+						t.Errorf("result for %s changed to %+v", result.Node, result)
+					}
+					continue
+				}
+				if result.Phase != jarvisiov1.NodeSkipped || result.Reason != want || result.Batch != tt.results[i].Batch {
+					t.Errorf("result for %s = %s %s in batch %d, want Skipped %s", result.Node, result.Phase, result.Reason, result.Batch, want)
+				}
+			}
+
+			// Claimed nodes are not handed out again.
+			if again, _ := r.nextBatch(cmd, agents); len(again) != 0 {
+				t.Errorf("second nextBatch() = %v, want nothing", again)
+			}
+		})
+	}
+}
+
+func TestAbortRemaining(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	r := &CommandReconciler{Recorder: recorder}
+	cmd := &jarvisiov1.Command{Status: jarvisiov1.CommandStatus{Results: []jarvisiov1.CommandResult{
+		{Node: "a", Phase: jarvisiov1.NodeFailed},
+		{Node: "b", Phase: jarvisiov1.NodeRunning},
+		{Node: "c", Phase: jarvisiov1.NodePending, Batch: 2},
+	}}}
+	r.abortRemaining(cmd, 1, 0)
+	want := []jarvisiov1.NodePhase{jarvisiov1.NodeFailed, jarvisiov1.NodeRunning, jarvisiov1.NodeSkipped}
+	for i, result := range cmd.Status.Results {
+		if result.Phase != want[i] {
+			t.Errorf("result for %s is %s, want %s", result.Node, result.Phase, want[i])
+		}
+	}
+	if c := cmd.Status.Results[2]; c.Reason != reasonAborted || c.Batch != 2 {
+		t.Errorf("aborted result = %+v, want reason %s in batch 2", c, reasonAborted)
+	}
+	if len(recorder.Events) != 1 {
+		t.Errorf("recorded %d events, want 1", len(recorder.Events))
+	}
+
+	// Nothing left to abort records nothing.
+	r.abortRemaining(cmd, 1, 0)
+	if len(recorder.Events) != 1 {
+		t.Errorf("recorded %d events with nothing to abort, want 1", len(recorder.Events))
+	}
+}
+
+func TestSpecHash(t *testing.T) {
+	base := jarvisiov1.CommandSpec{Command: "uptime"}
+	tests := []struct {
+		// field is the CommandSpec field changed.
+		field    string
+		change   func(*jarvisiov1.CommandSpec)
+		wantSame bool
+	}{
+		{"Command", func(s *jarvisiov1.CommandSpec) { s.Command = "df -h" }, false},
+		{"Timeout", func(s *jarvisiov1.CommandSpec) { s.Timeout = &metav1.Duration{Duration: time.Minute} }, false},
+		{"Privilege", func(s *jarvisiov1.CommandSpec) { s.Privilege = jarvisiov1.PrivilegeReadWrite }, false},
+		{"Profile", func(s *jarvisiov1.CommandSpec) { s.Profile = jarvisiov1.ProfileDiagnostic }, false},
+		{"GracePeriod", func(s *jarvisiov1.CommandSpec) { s.GracePeriod = &metav1.Duration{Duration: time.Second} }, false},
+		{"OutputLimit", func(s *jarvisiov1.CommandSpec) { s.OutputLimit = ptr.To(resource.MustParse("1Mi")) }, false},
+		{"Resources", func(s *jarvisiov1.CommandSpec) { s.Resources = &jarvisiov1.CommandResources{Pids: ptr.To(int64(10))} }, false},
+		{"RunID", func(s *jarvisiov1.CommandSpec) { s.RunID = "2" }, false},
+		{"Selector", func(s *jarvisiov1.CommandSpec) { s.Selector.MatchLabels = map[string]string{"role": "db"} }, true},
+		{"AllNodes", func(s *jarvisiov1.CommandSpec) { s.AllNodes = true }, true},
+		{"ApplyToNewNodes", func(s *jarvisiov1.CommandSpec) { s.ApplyToNewNodes = true }, true},
+		{"Strategy", func(s *jarvisiov1.CommandSpec) {
+			s.Strategy = &jarvisiov1.RolloutStrategy{MaxParallel: ptr.To(intstr.FromInt(1)), MaxFailures: ptr.To(intstr.FromInt(0))}
+		}, true},
+		{"Paused", func(s *jarvisiov1.CommandSpec) { s.Paused = true }, true},
+		{"RetryPolicy", func(s *jarvisiov1.CommandSpec) { s.RetryPolicy = &jarvisiov1.RetryPolicy{MaxAttempts: 5} }, true},
+		{"CreatedBy", func(s *jarvisiov1.CommandSpec) { s.CreatedBy = &authenticationv1.UserInfo{Username: "alice"} }, true},
+		{"Approval", func(s *jarvisiov1.CommandSpec) { s.Approval = &jarvisiov1.ApprovalRequirement{Approvals: 1} }, true},
+	}
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		covered[tt.field] = true
+		t.Run(tt.field, func(t *testing.T) {
+			spec := base.DeepCopy()
+			tt.change(spec)
+			if same := specHash(spec) == specHash(&base); same != tt.wantSame {
+				t.Errorf("hash unchanged = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+	// A new field must be placed on one side or the other.
+	spec := reflect.TypeFor[jarvisiov1.CommandSpec]()
+	for i := range spec.NumField() {
+		if name := spec.Field(i).Name; !covered[name] {
+			t.Errorf("spec.%s is not covered: decide whether changing it starts a new run", name)
+		}
+	}
+}
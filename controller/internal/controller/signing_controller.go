@@ -0,0 +1,184 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	grpcClient "github.com/motilayo/jarvis/controller/client"
+	"github.com/motilayo/jarvis/controller/internal/pki"
+)
+
+const (
+	// signingKeySecretName is the Secret holding the key requests to agents
+	// are signed with. It is kept with the CA, out of the agents' reach.
+	signingKeySecretName = "jarvis-signing-key"
+	signingKeyKey        = "signing.key"
+	// signingKeysConfigMapName is the ConfigMap in the agent namespace that
+	// publishes the public key, under its ID, for the agents to check
+	// signatures against.
+	signingKeysConfigMapName = "jarvis-signing-keys"
+)
+
+// SigningKeyReconciler keeps the key the controller signs requests to agents
+// with, creating it the first time, and publishes its public key to the
+// agents. Deleting the Secret replaces the key, and agents stop accepting the
+// old one as soon as they see the new one.
+type SigningKeyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Config *ConfigStore
+	// CANamespace is where the signing key Secret is kept, along with the
+	// CA; it is created if missing.
+	CANamespace string
+
+	resync chan event.GenericEvent
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update
+func (r *SigningKeyReconciler) Reconcile(ctx context.Context, _ ctrl.Request) (ctrl.Result, error) {
+	log := logf.FromContext(ctx)
+	config := r.Config.Get()
+	namespace := cmp.Or(r.CANamespace, DefaultCANamespace)
+	if config.AgentNamespace == namespace {
+		// Agents could read the private key and sign requests themselves.
+		log.Error(nil, "Not signing requests: the CA namespace is the agent namespace", "namespace", namespace)
+		return ctrl.Result{}, nil
+	}
+
+	key, err := r.signingKey(ctx, namespace)
+	if err != nil {
+		log.Error(err, "Unable to load the signing key")
+		return ctrl.Result{}, err
+	}
+	// Published before it is used, so that agents know it by the time the
+	// first request signed with it arrives.
+	if err := r.publish(ctx, config.AgentNamespace, key); err != nil {
+		log.Error(err, "Unable to publish the signing key")
+		return ctrl.Result{}, err
+	}
+	r.Config.setSigner(&grpcClient.Signer{KeyID: key.ID, Key: key.Key})
+	return ctrl.Result{}, nil
+}
+
+// signingKey loads the signing key from its Secret, creating it the first
+// time.
+func (r *SigningKeyReconciler) signingKey(ctx context.Context, namespace string) (*pki.SigningKey, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Namespace: namespace, Name: signingKeySecretName}
+	err := r.Get(ctx, key, secret)
+	if apierrors.IsNotFound(err) {
+		logf.FromContext(ctx).Info("Creating signing key", "secret", key)
+		if err := r.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return nil, err
+		}
+		keyPEM, err := pki.NewSigningKey()
+		if err != nil {
+			return nil, err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: key.Namespace,
+				Name:      key.Name,
+				Labels:    map[string]string{ManagedByLabel: ManagedByValue},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{signingKeyKey: keyPEM},
+		}
+		// If it already exists the cache has yet to catch up; the retry
+		// will find it.
+		err = r.Create(ctx, secret)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signingKey, err := pki.LoadSigningKey(secret.Data[signingKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", key, err)
+	}
+	return signingKey, nil
+}
+
+// publish makes key's public half the only one in the agents' ConfigMap.
+func (r *SigningKeyReconciler) publish(ctx context.Context, namespace string, key *pki.SigningKey) error {
+	cm := &corev1.ConfigMap{}
+	name := types.NamespacedName{Namespace: namespace, Name: signingKeysConfigMapName}
+	err := r.Get(ctx, name, cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	data := map[string]string{key.ID: string(key.PublicPEM)}
+	if err == nil && maps.Equal(cm.Data, data) {
+		return nil
+	}
+	logf.FromContext(ctx).Info("Publishing signing key", "configMap", name, "keyID", key.ID)
+	cm.Namespace, cm.Name = name.Namespace, name.Name
+	cm.Labels = map[string]string{ManagedByLabel: ManagedByValue}
+	cm.Data = data
+	if cm.ResourceVersion == "" {
+		return r.Create(ctx, cm)
+	}
+	return r.Update(ctx, cm)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SigningKeyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// There is only the one key; every event reconciles it. The first one
+	// is sent straight away, in case there is no Secret yet to be notified
+	// about, and another whenever the agent namespace may have moved.
+	r.resync = make(chan event.GenericEvent, 1)
+	r.resync <- event.GenericEvent{Object: &corev1.Secret{}}
+	r.Config.watch(func(Config) {
+		select {
+		case r.resync <- event.GenericEvent{Object: &corev1.Secret{}}:
+		default:
+		}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("signingkey").
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.forSigningKey)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.forSigningKey)).
+		WatchesRawSource(source.Channel(r.resync, handler.EnqueueRequestsFromMapFunc(r.forSigningKey))).
+		Complete(r)
+}
+
+// forSigningKey maps the signing key Secret, the ConfigMap publishing it, or
+// a resync onto the one request the reconciler handles.
+func (r *SigningKeyReconciler) forSigningKey(_ context.Context, obj client.Object) []reconcile.Request {
+	switch obj.GetName() {
+	case signingKeySecretName, signingKeysConfigMapName, "":
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: signingKeySecretName}}}
+	}
+	return nil
+}
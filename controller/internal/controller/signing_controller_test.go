@@ -0,0 +1,73 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("SigningKey Controller", func() {
+	Context("When reconciling the signing key", func() {
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name: signingKeySecretName,
+		}
+
+		BeforeEach(func() {
+			By("creating the agent namespace")
+			err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: defaultAgentNamespace}})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("should create the key and publish it to the agents", func() {
+			By("Reconciling the signing key")
+			config := &ConfigStore{}
+			controllerReconciler := &SigningKeyReconciler{
+				Client: k8sClient,
+				Scheme: k8sClient.Scheme(),
+				Config: config,
+			}
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking that the public key was published")
+			signer := config.Get().Signer
+			Expect(signer).NotTo(BeNil())
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Namespace: defaultAgentNamespace,
+				Name:      signingKeysConfigMapName,
+			}, cm)).To(Succeed())
+			Expect(cm.Data).To(HaveKey(signer.KeyID))
+		})
+	})
+})
@@ -0,0 +1,253 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// Reasons recorded on node results and conditions.
+const (
+	reasonAgentNotFound   = "AgentNotFound"
+	reasonAgentError      = "AgentError"
+	reasonNonZeroExit     = "NonZeroExit"
+	reasonSignaled        = "Signaled"
+	reasonOOMKilled       = "OOMKilled"
+	reasonRunning         = "Running"
+	reasonSucceeded       = "Succeeded"
+	reasonNodesFailed     = "NodesFailed"
+	reasonInterrupted     = "Interrupted"
+	reasonAborted         = "Aborted"
+	reasonAgentUnhealthy  = "AgentUnhealthy"
+	reasonNodePolicy      = "DeniedByNodePolicy"
+	reasonForbidden       = "Forbidden"
+	reasonPolicyViolation = "PolicyViolation"
+	reasonPolicyCompliant = "Compliant"
+	reasonPendingApproval = "PendingApproval"
+	reasonApproved        = "Approved"
+	reasonPaused          = "Paused"
+	reasonResumed         = "Resumed"
+)
+
+// setNodeResult replaces the entry for result.Node, or appends one.
+func setNodeResult(status *jarvisiov1.CommandStatus, result jarvisiov1.CommandResult) {
+	for i := range status.Results {
+		if status.Results[i].Node == result.Node {
+			status.Results[i] = result
+			return
+		}
+	}
+	status.Results = append(status.Results, result)
+}
+
+// nodeResult returns the entry for node, or nil.
+func nodeResult(status *jarvisiov1.CommandStatus, node string) *jarvisiov1.CommandResult {
+	for i := range status.Results {
+		if status.Results[i].Node == node {
+			return &status.Results[i]
+		}
+	}
+	return nil
+}
+
+// summarize recomputes the counters and conditions from the per-node results,
+// and trims their output to fit. It is called before every write of status.
+func summarize(status *jarvisiov1.CommandStatus, generation int64) {
+	trimExcerpts(status)
+	status.Succeeded, status.Failed, status.Skipped = 0, 0, 0
+	inFlight, aborted := 0, 0
+	for _, result := range status.Results {
+		if result.Reason == reasonAborted {
+			aborted++
+		}
+		switch result.Phase {
+		case jarvisiov1.NodeSucceeded:
+			status.Succeeded++
+		case jarvisiov1.NodeFailed:
+			status.Failed++
+		case jarvisiov1.NodeSkipped:
+			status.Skipped++
+		default:
+			inFlight++
+		}
+	}
+
+	complete := metav1.Condition{Type: jarvisiov1.ConditionComplete, ObservedGeneration: generation}
+	failed := metav1.Condition{Type: jarvisiov1.ConditionFailed, ObservedGeneration: generation}
+	switch {
+	case inFlight > 0:
+		complete.Status, complete.Reason = metav1.ConditionFalse, reasonRunning
+		complete.Message = fmt.Sprintf("%d of %d nodes still running", inFlight, len(status.Results))
+		failed.Status, failed.Reason = metav1.ConditionFalse, reasonRunning
+	case aborted > 0:
+		complete.Status, complete.Reason = metav1.ConditionFalse, reasonAborted
+		failed.Status, failed.Reason = metav1.ConditionTrue, reasonAborted
+		failed.Message = fmt.Sprintf("rollout aborted after %d of %d nodes failed; %d not run", status.Failed, len(status.Results), aborted)
+	case status.Failed > 0:
+		complete.Status, complete.Reason = metav1.ConditionFalse, reasonNodesFailed
+		failed.Status, failed.Reason = metav1.ConditionTrue, reasonNodesFailed
+		failed.Message = fmt.Sprintf("%d of %d nodes failed", status.Failed, len(status.Results))
+	default:
+		complete.Status, complete.Reason = metav1.ConditionTrue, reasonSucceeded
+		complete.Message = fmt.Sprintf("%d nodes succeeded, %d skipped", status.Succeeded, status.Skipped)
+		failed.Status, failed.Reason = metav1.ConditionFalse, reasonSucceeded
+	}
+	meta.SetStatusCondition(&status.Conditions, complete)
+	meta.SetStatusCondition(&status.Conditions, failed)
+}
+
+// recordResults applies node results to their Commands' status as they
+// arrive on updates, folding whatever has queued up for each Command into a
+// single write. It returns once updates is closed.
+func (r *CommandReconciler) recordResults(ctx context.Context, updates <-chan resultUpdate) {
+	log := logf.FromContext(ctx)
+	for update := range updates {
+		batches := map[types.NamespacedName][]jarvisiov1.CommandResult{
+			update.command: {update.result},
+		}
+	drain:
+		for {
+			select {
+			case next, ok := <-updates:
+				if !ok {
+					break drain
+				}
+				batches[next.command] = append(batches[next.command], next.result)
+			default:
+				break drain
+			}
+		}
+
+		for key, batch := range batches {
+			if err := r.applyResults(ctx, key, batch); err != nil {
+				log.Error(err, "failed to record node results", "command", key, "nodes", len(batch))
+			}
+		}
+	}
+}
+
+func (r *CommandReconciler) applyResults(ctx context.Context, key types.NamespacedName, batch []jarvisiov1.CommandResult) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cmd := &jarvisiov1.Command{}
+		if err := r.Get(ctx, key, cmd); err != nil {
+			return err
+		}
+		for _, result := range batch {
+			// A newer run has started since this one was dispatched; its
+			// results replace ours.
+			current := nodeResult(&cmd.Status, result.Node)
+			if current == nil || current.Generation != result.Generation {
+				continue
+			}
+			result.Batch = current.Batch
+			setNodeResult(&cmd.Status, result)
+		}
+		summarize(&cmd.Status, cmd.Status.ObservedGeneration)
+		return r.Status().Update(ctx, cmd)
+	})
+}
+
+// runTracker remembers which run of each Command this process has started,
+// and which nodes it has sent that run to, so neither happens twice. Runs are
+// identified by the hash of the spec they were started from. The zero value is
+// ready to use.
+type runTracker struct {
+	mu   sync.Mutex
+	runs map[types.UID]*trackedRun
+}
+
+type trackedRun struct {
+	hash  string
+	nodes map[string]bool
+}
+
+// begin records that this process started the run identified by hash.
+func (t *runTracker) begin(uid types.UID, hash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.run(uid, hash)
+}
+
+// started reports whether this process started the run identified by hash.
+func (t *runTracker) started(uid types.UID, hash string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run, ok := t.runs[uid]
+	return ok && run.hash == hash
+}
+
+// claimNode reports whether node has not yet been sent the run, and marks it
+// sent.
+func (t *runTracker) claimNode(uid types.UID, hash, node string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run := t.run(uid, hash)
+	if run.nodes[node] {
+		return false
+	}
+	run.nodes[node] = true
+	return true
+}
+
+// sent reports whether this process sent the run to node.
+func (t *runTracker) sent(uid types.UID, hash, node string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run, ok := t.runs[uid]
+	return ok && run.hash == hash && run.nodes[node]
+}
+
+// releaseNode undoes claimNode when the node could not be sent the command
+// after all.
+func (t *runTracker) releaseNode(uid types.UID, hash, node string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if run, ok := t.runs[uid]; ok && run.hash == hash {
+		delete(run.nodes, node)
+	}
+}
+
+// forget drops what is known about uid, either because the Command is gone or
+// because starting its run failed and the next reconcile should try again.
+func (t *runTracker) forget(uid types.UID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.runs, uid)
+}
+
+// run returns the entry for hash, replacing any earlier run. t.mu must be held.
+func (t *runTracker) run(uid types.UID, hash string) *trackedRun {
+	if t.runs == nil {
+		t.runs = map[types.UID]*trackedRun{}
+	}
+	run, ok := t.runs[uid]
+	if !ok || run.hash != hash {
+		run = &trackedRun{hash: hash, nodes: map[string]bool{}}
+		t.runs[uid] = run
+	}
+	return run
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import "testing"
+
+func TestRunTracker(t *testing.T) {
+	var tr runTracker
+	if tr.started("uid", "h1") || tr.sent("uid", "h1", "a") {
+		t.Fatal("the zero value has a run")
+	}
+
+	tr.begin("uid", "h1")
+	if !tr.started("uid", "h1") || tr.started("uid", "h2") || tr.started("other", "h1") {
+		t.Error("started() does not match begin()")
+	}
+	if !tr.claimNode("uid", "h1", "a") {
+		t.Error("first claimNode() refused")
+	}
+	if tr.claimNode("uid", "h1", "a") {
+		t.Error("node claimed twice")
+	}
+	if !tr.sent("uid", "h1", "a") || tr.sent("uid", "h1", "b") {
+		t.Error("sent() does not match claimNode()")
+	}
+
+	tr.releaseNode("uid", "h1", "a")
+	if tr.sent("uid", "h1", "a") || !tr.claimNode("uid", "h1", "a") {
+		t.Error("released node cannot be claimed again")
+	}
+	// Releasing for a run that is not the current one changes nothing.
+	tr.releaseNode("uid", "h0", "a")
+	if !tr.sent("uid", "h1", "a") {
+		t.Error("releaseNode() for an old run released the current one")
+	}
+
+	// A new run replaces the old one, and its nodes start unclaimed.
+	if !tr.claimNode("uid", "h2", "a") {
+		t.Error("node of a new run already claimed")
+	}
+	if tr.started("uid", "h1") || tr.sent("uid", "h1", "a") {
+		t.Error("old run kept after a new one")
+	}
+
+	tr.forget("uid")
+	if tr.started("uid", "h2") || tr.sent("uid", "h2", "a") {
+		t.Error("run kept after forget()")
+	}
+}
@@ -0,0 +1,351 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy evaluates the CommandPolicies and ClusterCommandPolicies
+// that apply to a namespace. The admission webhooks use it to turn away
+// Commands that break a policy, and the controller to hold to the policies
+// as they are when a Command runs.
+package policy
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// Reasons a Command breaks a policy.
+const (
+	ReasonCommandNotAllowed     = "CommandNotAllowed"
+	ReasonNodeNotAllowed        = "NodeNotAllowed"
+	ReasonTimeoutNotAllowed     = "TimeoutNotAllowed"
+	ReasonParallelismNotAllowed = "ParallelismNotAllowed"
+	ReasonQuotaExceeded         = "QuotaExceeded"
+	ReasonPrivilegeNotAllowed   = "PrivilegeNotAllowed"
+	ReasonProfileNotAllowed     = "ProfileNotAllowed"
+)
+
+// Policy is one CommandPolicy or ClusterCommandPolicy.
+type Policy struct {
+	// Name identifies the policy in messages, e.g.
+	// "CommandPolicy team-a/limits".
+	Name string
+	Spec jarvisiov1.CommandPolicySpec
+}
+
+// Violation is one way a Command breaks a policy.
+type Violation struct {
+	Policy string
+	// Field is the path in the Command's spec the violation is about.
+	Field   string
+	Reason  string
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Policy == "" {
+		return v.Message
+	}
+	return v.Policy + ": " + v.Message
+}
+
+func violation(p Policy, field, reason, format string, args ...any) Violation {
+	return Violation{Policy: p.Name, Field: field, Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// Set is every policy that applies to one namespace. A Command must satisfy
+// all of them.
+type Set []Policy
+
+// For returns the policies that apply to the Commands in namespace.
+func For(ctx context.Context, c client.Reader, namespace string) (Set, error) {
+	var set Set
+	policies := &jarvisiov1.CommandPolicyList{}
+	if err := c.List(ctx, policies, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("listing CommandPolicies: %w", err)
+	}
+	for _, p := range policies.Items {
+		set = append(set, Policy{Name: fmt.Sprintf("CommandPolicy %s/%s", p.Namespace, p.Name), Spec: p.Spec})
+	}
+
+	clusterPolicies := &jarvisiov1.ClusterCommandPolicyList{}
+	if err := c.List(ctx, clusterPolicies); err != nil {
+		return nil, fmt.Errorf("listing ClusterCommandPolicies: %w", err)
+	}
+	if len(clusterPolicies.Items) == 0 {
+		return set, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: namespace}, ns); err != nil {
+		return nil, fmt.Errorf("getting namespace %s: %w", namespace, err)
+	}
+	for _, p := range clusterPolicies.Items {
+		if p.Spec.NamespaceSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+			// A selector that does not parse applies the policy, so that
+			// a broken policy errs on the side of caution.
+			if err == nil && !selector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+		}
+		set = append(set, Policy{Name: "ClusterCommandPolicy " + p.Name, Spec: p.Spec.CommandPolicySpec})
+	}
+	return set, nil
+}
+
+// CheckCommand reports the policies that do not allow command. A pattern
+// that does not compile allows nothing.
+func (s Set) CheckCommand(command string) []Violation {
+	var violations []Violation
+	deny := func(p Policy, format string, args ...any) {
+		violations = append(violations, violation(p, "command", ReasonCommandNotAllowed, format, args...))
+	}
+	for _, p := range s {
+		if len(p.Spec.AllowedCommands) > 0 {
+			allowed := false
+			for _, pattern := range p.Spec.AllowedCommands {
+				re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+				if err != nil {
+					deny(p, "allowedCommands pattern %q is invalid: %v", pattern, err)
+					continue
+				}
+				allowed = allowed || re.MatchString(command)
+			}
+			if !allowed {
+				deny(p, "command matches none of the allowed commands")
+			}
+		}
+		for _, pattern := range p.Spec.DeniedCommands {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				deny(p, "deniedCommands pattern %q is invalid: %v", pattern, err)
+				continue
+			}
+			if re.MatchString(command) {
+				deny(p, "command matches denied pattern %q", pattern)
+			}
+		}
+	}
+	return violations
+}
+
+// CheckPrivilege reports the policies that do not allow privilege. An unset
+// privilege is ReadOnly.
+func (s Set) CheckPrivilege(privilege jarvisiov1.Privilege) []Violation {
+	privilege = cmp.Or(privilege, jarvisiov1.PrivilegeReadOnly)
+	var violations []Violation
+	for _, p := range s {
+		if len(p.Spec.AllowedPrivileges) > 0 && !slices.Contains(p.Spec.AllowedPrivileges, privilege) {
+			violations = append(violations, violation(p, "privilege", ReasonPrivilegeNotAllowed,
+				"privilege %s is not allowed", privilege))
+		}
+	}
+	return violations
+}
+
+// CheckProfile reports the policies that do not allow profile. An unset
+// profile is Full.
+func (s Set) CheckProfile(profile jarvisiov1.Profile) []Violation {
+	profile = cmp.Or(profile, jarvisiov1.ProfileFull)
+	var violations []Violation
+	for _, p := range s {
+		if len(p.Spec.AllowedProfiles) > 0 && !slices.Contains(p.Spec.AllowedProfiles, profile) {
+			violations = append(violations, violation(p, "profile", ReasonProfileNotAllowed,
+				"profile %s is not allowed", profile))
+		}
+	}
+	return violations
+}
+
+// CheckExecution reports the policies that do not allow what spec runs or
+// how: its command, privilege and profile. These hold on every node.
+func (s Set) CheckExecution(spec *jarvisiov1.CommandSpec) []Violation {
+	violations := s.CheckCommand(spec.Command)
+	violations = append(violations, s.CheckPrivilege(spec.Privilege)...)
+	return append(violations, s.CheckProfile(spec.Profile)...)
+}
+
+// CheckSpec reports every way spec breaks the policies that can be told
+// before it runs. The nodes it may run on and the quota are left to the
+// controller.
+func (s Set) CheckSpec(spec *jarvisiov1.CommandSpec) []Violation {
+	violations := s.CheckExecution(spec)
+	for _, p := range s {
+		if max := p.Spec.MaxTimeout; max != nil {
+			switch {
+			case spec.Timeout == nil:
+				violations = append(violations, violation(p, "timeout", ReasonTimeoutNotAllowed,
+					"a timeout of at most %s is required", max.Duration))
+			case spec.Timeout.Duration > max.Duration:
+				violations = append(violations, violation(p, "timeout", ReasonTimeoutNotAllowed,
+					"timeout %s is longer than the %s allowed", spec.Timeout.Duration, max.Duration))
+			}
+		}
+		// Percentages depend on how many nodes are selected; the
+		// controller caps those when it plans the batches.
+		if max := p.Spec.MaxParallel; max != nil && spec.Strategy != nil {
+			sizes := []struct {
+				field string
+				value *intstr.IntOrString
+			}{
+				{"strategy.canary", spec.Strategy.Canary},
+				{"strategy.maxParallel", spec.Strategy.MaxParallel},
+			}
+			for _, size := range sizes {
+				if v := size.value; v != nil && v.Type == intstr.Int && v.IntVal > *max {
+					violations = append(violations, violation(p, size.field, ReasonParallelismNotAllowed,
+						"%d nodes at a time is more than the %d allowed", v.IntVal, *max))
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// CheckNode reports the policies that keep Commands off a node with
+// nodeLabels.
+func (s Set) CheckNode(nodeLabels map[string]string) []Violation {
+	var violations []Violation
+	for _, p := range s {
+		if p.Spec.NodeSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(p.Spec.NodeSelector)
+		if err != nil {
+			violations = append(violations, violation(p, "selector", ReasonNodeNotAllowed,
+				"nodeSelector is invalid: %v", err))
+			continue
+		}
+		if !selector.Matches(labels.Set(nodeLabels)) {
+			violations = append(violations, violation(p, "selector", ReasonNodeNotAllowed,
+				"node is outside the policy's nodeSelector"))
+		}
+	}
+	return violations
+}
+
+// MaxParallel is the fewest nodes any policy lets a Command run on at a
+// time, or 0 if none sets a limit.
+func (s Set) MaxParallel() int {
+	limit := 0
+	for _, p := range s {
+		if max := p.Spec.MaxParallel; max != nil && (limit == 0 || int(*max) < limit) {
+			limit = int(*max)
+		}
+	}
+	return limit
+}
+
+// MaxTimeout is the shortest timeout any policy allows, or 0 if none sets
+// a limit.
+func (s Set) MaxTimeout() time.Duration {
+	var limit time.Duration
+	for _, p := range s {
+		if max := p.Spec.MaxTimeout; max != nil && (limit == 0 || max.Duration < limit) {
+			limit = max.Duration
+		}
+	}
+	return limit
+}
+
+// RequiredApprovals is how many approvals the policies ask for before a
+// Command with commandLabels running command may start, and the policy
+// asking for the most. It is 0 if none of them do. A pattern or selector
+// that does not parse picks every Command.
+func (s Set) RequiredApprovals(commandLabels map[string]string, command string) (int, string) {
+	required, by := 0, ""
+	for _, p := range s {
+		rule := p.Spec.Approval
+		if rule == nil || !picks(rule, commandLabels, command) {
+			continue
+		}
+		if n := max(int(rule.Approvals), 1); n > required {
+			required, by = n, p.Name
+		}
+	}
+	return required, by
+}
+
+// Validate checks the parts of spec the API schema cannot: that its
+// patterns compile and its selector parses.
+func Validate(spec *jarvisiov1.CommandPolicySpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if spec.NodeSelector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(spec.NodeSelector,
+			metav1validation.LabelSelectorValidationOptions{}, path.Child("nodeSelector"))...)
+	}
+	for i, pattern := range spec.AllowedCommands {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, field.Invalid(path.Child("allowedCommands").Index(i), pattern, err.Error()))
+		}
+	}
+	for i, pattern := range spec.DeniedCommands {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, field.Invalid(path.Child("deniedCommands").Index(i), pattern, err.Error()))
+		}
+	}
+	if spec.MaxTimeout != nil && spec.MaxTimeout.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxTimeout"), spec.MaxTimeout.Duration.String(), "must be positive"))
+	}
+	if q := spec.Quota; q != nil && q.Window.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("quota", "window"), q.Window.Duration.String(), "must be positive"))
+	}
+	if a := spec.Approval; a != nil {
+		if a.Selector != nil {
+			errs = append(errs, metav1validation.ValidateLabelSelector(a.Selector,
+				metav1validation.LabelSelectorValidationOptions{}, path.Child("approval", "selector"))...)
+		}
+		for i, pattern := range a.Commands {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, field.Invalid(path.Child("approval", "commands").Index(i), pattern, err.Error()))
+			}
+		}
+	}
+	return errs
+}
+
+// picks reports whether rule applies to a Command with commandLabels running
+// command.
+func picks(rule *jarvisiov1.ApprovalPolicy, commandLabels map[string]string, command string) bool {
+	if rule.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(rule.Selector)
+		if err == nil && !selector.Matches(labels.Set(commandLabels)) {
+			return false
+		}
+	}
+	if len(rule.Commands) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Commands {
+		re, err := regexp.Compile(pattern)
+		if err != nil || re.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
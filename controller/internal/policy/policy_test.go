@@ -0,0 +1,317 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// policies returns the names of the policies behind violations.
+func policies(violations []Violation) []string {
+	var names []string
+	for _, v := range violations {
+		names = append(names, v.Policy)
+	}
+	return names
+}
+
+func TestFor(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := jarvisiov1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	namespace := func(name, env string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": env}}}
+	}
+	namespaced := func(namespace, name string) *jarvisiov1.CommandPolicy {
+		return &jarvisiov1.CommandPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+	cluster := func(name string, selector *metav1.LabelSelector) *jarvisiov1.ClusterCommandPolicy {
+		return &jarvisiov1.ClusterCommandPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       jarvisiov1.ClusterCommandPolicySpec{NamespaceSelector: selector},
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		namespace("team-a", "prod"), namespace("team-b", "dev"),
+		namespaced("team-a", "limits"), namespaced("team-b", "limits"),
+		cluster("everywhere", nil),
+		cluster("prod", &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}),
+		cluster("broken", &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "env", Operator: "Bogus"},
+		}}),
+	).Build()
+
+	tests := []struct {
+		name      string
+		namespace string
+		want      []string
+	}{
+		{"own policies and the selecting cluster ones", "team-a", []string{
+			"ClusterCommandPolicy broken", "ClusterCommandPolicy everywhere", "ClusterCommandPolicy prod",
+			"CommandPolicy team-a/limits",
+		}},
+		{"not another namespace's", "team-b", []string{
+			"ClusterCommandPolicy broken", "ClusterCommandPolicy everywhere",
+			"CommandPolicy team-b/limits",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := For(context.Background(), c, tt.namespace)
+			if err != nil {
+				t.Fatalf("For() error = %v", err)
+			}
+			var got []string
+			for _, p := range set {
+				got = append(got, p.Name)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("For(%q) = %v, want %v", tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	allow := func(name string, patterns ...string) Policy {
+		return Policy{Name: name, Spec: jarvisiov1.CommandPolicySpec{AllowedCommands: patterns}}
+	}
+	deny := func(name string, patterns ...string) Policy {
+		return Policy{Name: name, Spec: jarvisiov1.CommandPolicySpec{DeniedCommands: patterns}}
+	}
+	both := func(name string, allowed, denied string) Policy {
+		return Policy{Name: name, Spec: jarvisiov1.CommandPolicySpec{
+			AllowedCommands: []string{allowed},
+			DeniedCommands:  []string{denied},
+		}}
+	}
+	status := `systemctl status [a-z0-9@.-]+`
+
+	tests := []struct {
+		name    string
+		set     Set
+		command string
+		want    []string
+	}{
+		{"no policies", nil, "rm -rf /", nil},
+		{"allowed", Set{allow("ns", status, "uptime")}, "systemctl status kubelet", nil},
+		{"allowed by the second pattern", Set{allow("ns", status, "uptime")}, "uptime", nil},
+		{"allowlist matches the whole command", Set{allow("ns", status)}, "systemctl status kubelet; reboot", []string{"ns"}},
+		{"allowlist is anchored at the start", Set{allow("ns", "uptime")}, "sudo uptime", []string{"ns"}},
+		{"a different binary", Set{allow("ns", "journalctl( -u [a-z]+)?")}, "journalctl-upload", []string{"ns"}},
+		{"denied anywhere in the command", Set{deny("ns", `\breboot\b`)}, "uptime && reboot", []string{"ns"}},
+		{"deny over allow in one policy", Set{both("ns", ".*", `\brm\b`)}, "rm -rf /tmp/x", []string{"ns"}},
+		{"deny over allow across policies", Set{allow("ns", ".*"), deny("cluster", "reboot")}, "reboot", []string{"cluster"}},
+		{"every allowlist must match", Set{allow("ns", "uptime"), allow("cluster", "df -h")}, "uptime", []string{"cluster"}},
+		{"a cluster allowlist narrows a namespace's", Set{allow("ns", "systemctl .*"), allow("cluster", status)}, "systemctl restart kubelet", []string{"cluster"}},
+		{"every breach reported", Set{allow("ns", "uptime"), deny("cluster", "rm")}, "rm -f x", []string{"ns", "cluster"}},
+		{"invalid allowed pattern allows nothing", Set{allow("ns", "(")}, "(", []string{"ns", "ns"}},
+		{"invalid denied pattern allows nothing", Set{deny("ns", "(")}, "uptime", []string{"ns"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := tt.set.CheckCommand(tt.command)
+			if got := policies(violations); !slices.Equal(got, tt.want) {
+				t.Errorf("CheckCommand(%q) = %v, want violations by %v", tt.command, violations, tt.want)
+			}
+			for _, v := range violations {
+				if v.Reason != ReasonCommandNotAllowed || v.Field != "command" {
+					t.Errorf("CheckCommand(%q) violation %+v, want reason %s on command", tt.command, v, ReasonCommandNotAllowed)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPrivilegeAndProfile(t *testing.T) {
+	limited := Policy{Name: "ns", Spec: jarvisiov1.CommandPolicySpec{
+		AllowedPrivileges: []jarvisiov1.Privilege{jarvisiov1.PrivilegeReadOnly},
+		AllowedProfiles:   []jarvisiov1.Profile{jarvisiov1.ProfileDiagnostic, jarvisiov1.ProfileNetworkIsolated},
+	}}
+	open := Policy{Name: "cluster"}
+
+	tests := []struct {
+		name      string
+		set       Set
+		privilege jarvisiov1.Privilege
+		profile   jarvisiov1.Profile
+		want      []string
+	}{
+		{"no limits", Set{open}, jarvisiov1.PrivilegeReadWrite, jarvisiov1.ProfileFull, nil},
+		{"allowed", Set{limited, open}, jarvisiov1.PrivilegeReadOnly, jarvisiov1.ProfileDiagnostic, nil},
+		{"privilege not allowed", Set{limited, open}, jarvisiov1.PrivilegeReadWrite, jarvisiov1.ProfileDiagnostic, []string{ReasonPrivilegeNotAllowed}},
+		{"unset privilege is ReadOnly", Set{limited}, "", jarvisiov1.ProfileDiagnostic, nil},
+		{"profile not allowed", Set{limited}, jarvisiov1.PrivilegeReadOnly, jarvisiov1.ProfileFull, []string{ReasonProfileNotAllowed}},
+		{"unset profile is Full", Set{limited}, jarvisiov1.PrivilegeReadOnly, "", []string{ReasonProfileNotAllowed}},
+		{"both", Set{limited}, jarvisiov1.PrivilegeReadWrite, jarvisiov1.ProfileFull, []string{ReasonPrivilegeNotAllowed, ReasonProfileNotAllowed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &jarvisiov1.CommandSpec{Command: "uptime", Privilege: tt.privilege, Profile: tt.profile}
+			var got []string
+			for _, v := range tt.set.CheckExecution(spec) {
+				got = append(got, v.Reason)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("CheckExecution(%s, %s) = %v, want %v", tt.privilege, tt.profile, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSpecTimeout(t *testing.T) {
+	maxTimeout := func(name string, d time.Duration) Policy {
+		return Policy{Name: name, Spec: jarvisiov1.CommandPolicySpec{MaxTimeout: &metav1.Duration{Duration: d}}}
+	}
+	set := Set{maxTimeout("ns", 10*time.Minute), maxTimeout("cluster", time.Minute)}
+
+	tests := []struct {
+		name    string
+		timeout *metav1.Duration
+		want    []string
+	}{
+		{"within the strictest", &metav1.Duration{Duration: 30 * time.Second}, nil},
+		{"over the cluster limit only", &metav1.Duration{Duration: 5 * time.Minute}, []string{"cluster"}},
+		{"over both", &metav1.Duration{Duration: time.Hour}, []string{"ns", "cluster"}},
+		{"unset", nil, []string{"ns", "cluster"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := set.CheckSpec(&jarvisiov1.CommandSpec{Command: "uptime", Timeout: tt.timeout})
+			if got := policies(violations); !slices.Equal(got, tt.want) {
+				t.Errorf("CheckSpec() = %v, want violations by %v", violations, tt.want)
+			}
+		})
+	}
+	if got := set.MaxTimeout(); got != time.Minute {
+		t.Errorf("MaxTimeout() = %s, want the strictest, %s", got, time.Minute)
+	}
+}
+
+func TestCheckNode(t *testing.T) {
+	selecting := func(name string, selector *metav1.LabelSelector) Policy {
+		return Policy{Name: name, Spec: jarvisiov1.CommandPolicySpec{NodeSelector: selector}}
+	}
+	workers := selecting("ns", &metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}})
+	zoneA := selecting("cluster", &metav1.LabelSelector{MatchLabels: map[string]string{"zone": "a"}})
+	broken := selecting("broken", &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "zone", Operator: "Bogus"},
+	}})
+
+	tests := []struct {
+		name   string
+		set    Set
+		labels map[string]string
+		want   []string
+	}{
+		{"no selector", Set{{Name: "ns"}}, nil, nil},
+		{"inside every selector", Set{workers, zoneA}, map[string]string{"role": "worker", "zone": "a"}, nil},
+		{"outside one", Set{workers, zoneA}, map[string]string{"role": "worker", "zone": "b"}, []string{"cluster"}},
+		{"outside both", Set{workers, zoneA}, map[string]string{"role": "control-plane"}, []string{"ns", "cluster"}},
+		{"invalid selector allows no node", Set{broken}, map[string]string{"zone": "a"}, []string{"broken"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := tt.set.CheckNode(tt.labels)
+			if got := policies(violations); !slices.Equal(got, tt.want) {
+				t.Errorf("CheckNode(%v) = %v, want violations by %v", tt.labels, violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredApprovals(t *testing.T) {
+	approval := func(name string, rule jarvisiov1.ApprovalPolicy) Policy {
+		return Policy{Name: name, Spec: jarvisiov1.CommandPolicySpec{Approval: &rule}}
+	}
+	restarts := approval("ns", jarvisiov1.ApprovalPolicy{Commands: []string{`systemctl restart`}, Approvals: 1})
+	prod := approval("cluster", jarvisiov1.ApprovalPolicy{
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		Approvals: 2,
+	})
+	prodRestarts := approval("strict", jarvisiov1.ApprovalPolicy{
+		Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+		Commands:  []string{`restart`},
+		Approvals: 3,
+	})
+	broken := approval("broken", jarvisiov1.ApprovalPolicy{Commands: []string{"("}})
+
+	tests := []struct {
+		name         string
+		set          Set
+		labels       map[string]string
+		command      string
+		wantRequired int
+		wantBy       string
+	}{
+		{"no rule", Set{{Name: "ns"}}, nil, "systemctl restart kubelet", 0, ""},
+		{"not picked", Set{restarts, prod}, map[string]string{"env": "dev"}, "uptime", 0, ""},
+		{"picked by command", Set{restarts, prod}, map[string]string{"env": "dev"}, "systemctl restart kubelet", 1, "ns"},
+		{"picked by labels", Set{restarts, prod}, map[string]string{"env": "prod"}, "uptime", 2, "cluster"},
+		{"the most wins", Set{restarts, prod, prodRestarts}, map[string]string{"env": "prod"}, "systemctl restart kubelet", 3, "strict"},
+		{"selector and command must both pick", Set{prodRestarts}, map[string]string{"env": "dev"}, "systemctl restart kubelet", 0, ""},
+		{"unset approvals count as one", Set{approval("ns", jarvisiov1.ApprovalPolicy{})}, nil, "uptime", 1, "ns"},
+		{"invalid pattern picks everything", Set{broken}, nil, "uptime", 1, "broken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			required, by := tt.set.RequiredApprovals(tt.labels, tt.command)
+			if required != tt.wantRequired || by != tt.wantBy {
+				t.Errorf("RequiredApprovals() = %d, %q, want %d, %q", required, by, tt.wantRequired, tt.wantBy)
+			}
+		})
+	}
+}
+
+func TestMaxParallel(t *testing.T) {
+	parallel := func(n int32) Policy {
+		return Policy{Spec: jarvisiov1.CommandPolicySpec{MaxParallel: ptr.To(n)}}
+	}
+	tests := []struct {
+		name string
+		set  Set
+		want int
+	}{
+		{"no limit", Set{{}}, 0},
+		{"one limit", Set{{}, parallel(5)}, 5},
+		{"the fewest wins", Set{parallel(5), parallel(2), parallel(10)}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.set.MaxParallel(); got != tt.want {
+				t.Errorf("MaxParallel() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
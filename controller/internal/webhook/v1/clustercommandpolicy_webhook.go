@@ -0,0 +1,93 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	"github.com/motilayo/jarvis/controller/internal/policy"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var clustercommandpolicylog = logf.Log.WithName("clustercommandpolicy-resource")
+
+// SetupClusterCommandPolicyWebhookWithManager registers the webhook for ClusterCommandPolicy in the manager.
+func SetupClusterCommandPolicyWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&jarvisiov1.ClusterCommandPolicy{}).
+		WithValidator(&ClusterCommandPolicyCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-jarvis-io-v1-clustercommandpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=clustercommandpolicies,verbs=create;update,versions=v1,name=vclustercommandpolicy-v1.kb.io,admissionReviewVersions=v1
+
+// ClusterCommandPolicyCustomValidator struct is responsible for validating the ClusterCommandPolicy resource
+// when it is created, updated, or deleted.
+//
+// It checks that the policy's patterns compile and its selectors parse, so
+// that a broken policy is not left to deny every Command it applies to.
+type ClusterCommandPolicyCustomValidator struct{}
+
+var _ webhook.CustomValidator = &ClusterCommandPolicyCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type ClusterCommandPolicy.
+func (v *ClusterCommandPolicyCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	clusterCommandPolicy, ok := obj.(*jarvisiov1.ClusterCommandPolicy)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterCommandPolicy object but got %T", obj)
+	}
+	clustercommandpolicylog.Info("Validation for ClusterCommandPolicy upon creation", "name", clusterCommandPolicy.GetName())
+
+	return nil, validateClusterCommandPolicy(clusterCommandPolicy)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type ClusterCommandPolicy.
+func (v *ClusterCommandPolicyCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	clusterCommandPolicy, ok := newObj.(*jarvisiov1.ClusterCommandPolicy)
+	if !ok {
+		return nil, fmt.Errorf("expected a ClusterCommandPolicy object for the newObj but got %T", newObj)
+	}
+	clustercommandpolicylog.Info("Validation for ClusterCommandPolicy upon update", "name", clusterCommandPolicy.GetName())
+
+	return nil, validateClusterCommandPolicy(clusterCommandPolicy)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type ClusterCommandPolicy.
+func (v *ClusterCommandPolicyCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateClusterCommandPolicy checks the parts of clusterCommandPolicy the API schema cannot.
+func validateClusterCommandPolicy(clusterCommandPolicy *jarvisiov1.ClusterCommandPolicy) error {
+	specPath := field.NewPath("spec")
+	errs := policy.Validate(&clusterCommandPolicy.Spec.CommandPolicySpec, specPath)
+	if selector := clusterCommandPolicy.Spec.NamespaceSelector; selector != nil {
+		errs = append(errs, metav1validation.ValidateLabelSelector(selector,
+			metav1validation.LabelSelectorValidationOptions{}, specPath.Child("namespaceSelector"))...)
+	}
+	return invalid("ClusterCommandPolicy", clusterCommandPolicy.Name, errs)
+}
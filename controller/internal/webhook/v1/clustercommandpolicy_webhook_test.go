@@ -0,0 +1,55 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+var _ = Describe("ClusterCommandPolicy Webhook", func() {
+	var (
+		obj *jarvisiov1.ClusterCommandPolicy
+	)
+
+	BeforeEach(func() {
+		obj = &jarvisiov1.ClusterCommandPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-clustercommandpolicy"},
+			Spec:       jarvisiov1.ClusterCommandPolicySpec{CommandPolicySpec: jarvisiov1.CommandPolicySpec{AllowedCommands: []string{`uptime`}}},
+		}
+		Expect(obj).NotTo(BeNil(), "Expected obj to be initialized")
+	})
+
+	AfterEach(func() {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+	})
+
+	Context("When creating or updating ClusterCommandPolicy under Validating Webhook", func() {
+		It("Should admit a valid policy", func() {
+			Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+		})
+
+		It("Should deny creation if a pattern does not compile", func() {
+			obj.Spec.DeniedCommands = []string{"rm -rf ("}
+			Expect(k8sClient.Create(ctx, obj)).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,248 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	"github.com/motilayo/jarvis/controller/internal/policy"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var commandlog = logf.Log.WithName("command-resource")
+
+// SetupCommandWebhookWithManager registers the webhook for Command in the manager.
+func SetupCommandWebhookWithManager(mgr ctrl.Manager, controllerUser string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&jarvisiov1.Command{}).
+		WithDefaulter(&CommandCustomDefaulter{
+			creators: creators{controllerUser: controllerUser},
+			reader:   mgr.GetClient(),
+		}).
+		WithValidator(&CommandCustomValidator{reader: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-jarvis-io-v1-command,mutating=true,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=commands,verbs=create;update,versions=v1,name=mcommand-v1.kb.io,admissionReviewVersions=v1
+
+// CommandCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind Command when those are created or updated.
+//
+// It records who created the Command in spec.createdBy, which decides the
+// nodes it may run on, and fills in what a new Command leaves unset from the
+// JarvisConfig's defaults.
+type CommandCustomDefaulter struct {
+	creators creators
+	reader   client.Reader
+}
+
+var _ webhook.CustomDefaulter = &CommandCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind Command.
+func (d *CommandCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	command, ok := obj.(*jarvisiov1.Command)
+	if !ok {
+		return fmt.Errorf("expected an Command object but got %T", obj)
+	}
+	commandlog.Info("Defaulting for Command", "name", command.GetName())
+
+	if err := d.applyDefaults(ctx, &command.Spec); err != nil {
+		return err
+	}
+	return d.creators.stamp(ctx, "commands", command.Name, &command.Spec, func(raw []byte) (*jarvisiov1.CommandSpec, error) {
+		old := &jarvisiov1.Command{}
+		err := json.Unmarshal(raw, old)
+		return &old.Spec, err
+	})
+}
+
+// applyDefaults fills in a new Command from the JarvisConfig's defaults.
+// Existing Commands are left alone, so that changing the defaults does not
+// change their spec, and with it start them again.
+func (d *CommandCustomDefaulter) applyDefaults(ctx context.Context, spec *jarvisiov1.CommandSpec) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if req.Operation != admissionv1.Create {
+		return nil
+	}
+	if spec.Privilege == "" {
+		spec.Privilege = jarvisiov1.PrivilegeReadOnly
+	}
+	if spec.Profile == "" {
+		spec.Profile = jarvisiov1.ProfileFull
+	}
+	config := &jarvisiov1.JarvisConfig{}
+	if err := d.reader.Get(ctx, client.ObjectKey{Name: jarvisiov1.JarvisConfigName}, config); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	defaults := config.Spec.Defaults.DeepCopy()
+	if spec.Timeout == nil {
+		spec.Timeout = defaults.Timeout
+	}
+	if spec.GracePeriod == nil {
+		spec.GracePeriod = defaults.GracePeriod
+	}
+	if spec.OutputLimit == nil {
+		spec.OutputLimit = defaults.OutputLimit
+	}
+	if spec.Strategy == nil {
+		spec.Strategy = defaults.Strategy
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-jarvis-io-v1-command,mutating=false,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=commands,verbs=create;update,versions=v1,name=vcommand-v1.kb.io,admissionReviewVersions=v1
+
+// CommandCustomValidator struct is responsible for validating the Command resource
+// when it is created, updated, or deleted.
+//
+// It checks that the command parses and avoids the denylist, that a Command
+// without a selector says it means every node, that it keeps to the command
+// policies of its namespace, and that the spec stays as it was once the
+// Command has started running.
+type CommandCustomValidator struct {
+	reader client.Reader
+}
+
+var _ webhook.CustomValidator = &CommandCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type Command.
+func (v *CommandCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	command, ok := obj.(*jarvisiov1.Command)
+	if !ok {
+		return nil, fmt.Errorf("expected a Command object but got %T", obj)
+	}
+	commandlog.Info("Validation for Command upon creation", "name", command.GetName())
+
+	return nil, v.validate(ctx, command)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type Command.
+func (v *CommandCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	command, ok := newObj.(*jarvisiov1.Command)
+	if !ok {
+		return nil, fmt.Errorf("expected a Command object for the newObj but got %T", newObj)
+	}
+	old, ok := oldObj.(*jarvisiov1.Command)
+	if !ok {
+		return nil, fmt.Errorf("expected a Command object for the oldObj but got %T", oldObj)
+	}
+	commandlog.Info("Validation for Command upon update", "name", command.GetName())
+
+	specPath := field.NewPath("spec")
+	if sameRun(&command.Spec, &old.Spec) {
+		// Metadata updates, such as removing the finalizer, go through even
+		// for Commands created before the webhook was installed.
+		return nil, nil
+	}
+	if old.Status.RunGeneration != 0 {
+		return nil, invalid("Command", command.Name, field.ErrorList{field.Forbidden(specPath,
+			"may not change once the Command has started, except runID and paused; create a new Command instead")})
+	}
+	return nil, v.validate(ctx, command)
+}
+
+// validate checks command's spec, and that it keeps to the policies.
+func (v *CommandCustomValidator) validate(ctx context.Context, command *jarvisiov1.Command) error {
+	specPath := field.NewPath("spec")
+	errs := validateCommandSpec(&command.Spec, specPath)
+	violations, err := checkPolicies(ctx, v.reader, command.Namespace, &command.Spec, specPath)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	return invalid("Command", command.Name, append(errs, violations...))
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type Command.
+func (v *CommandCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// sameRun reports whether spec and old describe the same command, leaving
+// aside the fields that may change once it has started.
+func sameRun(spec, old *jarvisiov1.CommandSpec) bool {
+	spec, old = spec.DeepCopy(), old.DeepCopy()
+	for _, s := range []*jarvisiov1.CommandSpec{spec, old} {
+		s.RunID, s.Paused, s.CreatedBy = "", false, nil
+	}
+	return equality.Semantic.DeepEqual(spec, old)
+}
+
+// validateCommandSpec checks the parts of spec the API schema cannot.
+func validateCommandSpec(spec *jarvisiov1.CommandSpec, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if err := checkShell(spec.Command); err != nil {
+		errs = append(errs, field.Invalid(path.Child("command"), spec.Command, err.Error()))
+	}
+	selectorPath := path.Child("selector")
+	errs = append(errs, metav1validation.ValidateLabelSelector(&spec.Selector, metav1validation.LabelSelectorValidationOptions{}, selectorPath)...)
+	empty := len(spec.Selector.MatchLabels) == 0 && len(spec.Selector.MatchExpressions) == 0
+	switch {
+	case empty && !spec.AllNodes:
+		errs = append(errs, field.Required(selectorPath, "set a selector, or allNodes: true to run on every node"))
+	case !empty && spec.AllNodes:
+		errs = append(errs, field.Invalid(path.Child("allNodes"), spec.AllNodes, "may not be set together with a selector"))
+	}
+	if res := spec.Resources; res != nil {
+		if res.CPU != nil && res.CPU.MilliValue() < 1 {
+			errs = append(errs, field.Invalid(path.Child("resources", "cpu"), res.CPU.String(), "must be at least 1m"))
+		}
+		if res.Memory != nil && res.Memory.Sign() <= 0 {
+			errs = append(errs, field.Invalid(path.Child("resources", "memory"), res.Memory.String(), "must be positive"))
+		}
+	}
+	return errs
+}
+
+// checkPolicies reports how spec breaks the command policies that apply in
+// namespace.
+func checkPolicies(ctx context.Context, reader client.Reader, namespace string, spec *jarvisiov1.CommandSpec, path *field.Path) (field.ErrorList, error) {
+	policies, err := policy.For(ctx, reader, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var errs field.ErrorList
+	for _, violation := range policies.CheckSpec(spec) {
+		errs = append(errs, field.Forbidden(path.Child(violation.Field), violation.String()))
+	}
+	return errs, nil
+}
+
+// invalid turns errs into the error the API server reports, or nil.
+func invalid(kind, name string, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(jarvisiov1.GroupVersion.WithKind(kind).GroupKind(), name, errs)
+}
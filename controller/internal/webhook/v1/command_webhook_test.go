@@ -0,0 +1,88 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+var _ = Describe("Command Webhook", func() {
+	var (
+		obj *jarvisiov1.Command
+	)
+
+	BeforeEach(func() {
+		obj = &jarvisiov1.Command{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-command", Namespace: "default"},
+			Spec:       jarvisiov1.CommandSpec{Command: "uptime", AllNodes: true},
+		}
+		Expect(obj).NotTo(BeNil(), "Expected obj to be initialized")
+	})
+
+	AfterEach(func() {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+	})
+
+	Context("When creating Command under Defaulting Webhook", func() {
+		It("Should record the creator, whatever the request says", func() {
+			By("claiming to be someone else")
+			obj.Spec.CreatedBy = &authenticationv1.UserInfo{Username: "someone-else"}
+			Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+
+			By("checking that the requesting user was recorded")
+			Expect(obj.Spec.CreatedBy).NotTo(BeNil())
+			Expect(obj.Spec.CreatedBy.Username).NotTo(Equal("someone-else"))
+		})
+	})
+
+	Context("When creating or updating Command under Validating Webhook", func() {
+		It("Should deny creation if the command does not parse", func() {
+			obj.Spec.Command = "echo 'unterminated"
+			Expect(k8sClient.Create(ctx, obj)).NotTo(Succeed())
+		})
+
+		It("Should deny creation of a denylisted command", func() {
+			obj.Spec.Command = "rm -rf /"
+			Expect(k8sClient.Create(ctx, obj)).NotTo(Succeed())
+		})
+
+		It("Should deny creation without a selector unless allNodes is set", func() {
+			obj.Spec.AllNodes = false
+			Expect(k8sClient.Create(ctx, obj)).NotTo(Succeed())
+		})
+
+		It("Should deny changing the command once it has started", func() {
+			Expect(k8sClient.Create(ctx, obj)).To(Succeed())
+			obj.Status.RunGeneration = obj.Generation
+			Expect(k8sClient.Status().Update(ctx, obj)).To(Succeed())
+
+			By("changing runID, which is allowed")
+			obj.Spec.RunID = "again"
+			Expect(k8sClient.Update(ctx, obj)).To(Succeed())
+
+			By("changing the command, which is not")
+			obj.Spec.Command = "hostname"
+			Expect(k8sClient.Update(ctx, obj)).NotTo(Succeed())
+		})
+	})
+})
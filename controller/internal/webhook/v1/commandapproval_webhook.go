@@ -0,0 +1,148 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// defaultApprovalLifetime is how long an approval holds when it does not say.
+const defaultApprovalLifetime = time.Hour
+
+// nolint:unused
+// log is for logging in this package.
+var commandapprovallog = logf.Log.WithName("commandapproval-resource")
+
+// SetupCommandApprovalWebhookWithManager registers the webhook for CommandApproval in the manager.
+func SetupCommandApprovalWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&jarvisiov1.CommandApproval{}).
+		WithDefaulter(&CommandApprovalCustomDefaulter{reader: mgr.GetClient()}).
+		WithValidator(&CommandApprovalCustomValidator{reader: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-jarvis-io-v1-commandapproval,mutating=true,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=commandapprovals,verbs=create,versions=v1,name=mcommandapproval-v1.kb.io,admissionReviewVersions=v1
+
+// CommandApprovalCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind CommandApproval when those are created or updated.
+//
+// It records who approved, and which version of the Command they approved,
+// and has the approval go away with the Command.
+type CommandApprovalCustomDefaulter struct {
+	reader client.Reader
+}
+
+var _ webhook.CustomDefaulter = &CommandApprovalCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind CommandApproval.
+func (d *CommandApprovalCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	approval, ok := obj.(*jarvisiov1.CommandApproval)
+	if !ok {
+		return fmt.Errorf("expected an CommandApproval object but got %T", obj)
+	}
+	commandapprovallog.Info("Defaulting for CommandApproval", "name", approval.GetName())
+
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if req.Operation != admissionv1.Create {
+		return nil
+	}
+	command := &jarvisiov1.Command{}
+	if err := d.reader.Get(ctx, client.ObjectKey{Namespace: approval.Namespace, Name: approval.Spec.Command}, command); err != nil {
+		if apierrors.IsNotFound(err) {
+			return apierrors.NewBadRequest(fmt.Sprintf("Command %s not found in namespace %s", approval.Spec.Command, approval.Namespace))
+		}
+		return err
+	}
+	approval.Spec.ApprovedBy = req.UserInfo.DeepCopy()
+	approval.Spec.CommandUID = command.UID
+	approval.Spec.CommandGeneration = command.Generation
+	if approval.Spec.ExpiresAt == nil {
+		approval.Spec.ExpiresAt = ptr.To(metav1.NewTime(time.Now().Add(defaultApprovalLifetime)))
+	}
+	approval.OwnerReferences = append(approval.OwnerReferences, metav1.OwnerReference{
+		APIVersion: jarvisiov1.GroupVersion.String(),
+		Kind:       "Command",
+		Name:       command.Name,
+		UID:        command.UID,
+	})
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-jarvis-io-v1-commandapproval,mutating=false,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=commandapprovals,verbs=create,versions=v1,name=vcommandapproval-v1.kb.io,admissionReviewVersions=v1
+
+// CommandApprovalCustomValidator struct is responsible for validating the CommandApproval resource
+// when it is created, updated, or deleted.
+//
+// It enforces the two-person rule: nobody approves a Command they created.
+type CommandApprovalCustomValidator struct {
+	reader client.Reader
+}
+
+var _ webhook.CustomValidator = &CommandApprovalCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type CommandApproval.
+func (v *CommandApprovalCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	approval, ok := obj.(*jarvisiov1.CommandApproval)
+	if !ok {
+		return nil, fmt.Errorf("expected a CommandApproval object but got %T", obj)
+	}
+	commandapprovallog.Info("Validation for CommandApproval upon creation", "name", approval.GetName())
+
+	specPath := field.NewPath("spec")
+	var errs field.ErrorList
+	if approval.Spec.ExpiresAt != nil && !approval.Spec.ExpiresAt.After(time.Now()) {
+		errs = append(errs, field.Invalid(specPath.Child("expiresAt"), approval.Spec.ExpiresAt, "must be in the future"))
+	}
+	command := &jarvisiov1.Command{}
+	if err := v.reader.Get(ctx, client.ObjectKey{Namespace: approval.Namespace, Name: approval.Spec.Command}, command); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if approver, creator := approval.Spec.ApprovedBy, command.Spec.CreatedBy; approver != nil && creator != nil && approver.Username == creator.Username {
+		errs = append(errs, field.Forbidden(specPath.Child("approvedBy"),
+			fmt.Sprintf("%s created Command %s and may not approve it; someone else has to", creator.Username, command.Name)))
+	}
+	return nil, invalid("CommandApproval", approval.Name, errs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type CommandApproval.
+func (v *CommandApprovalCustomValidator) ValidateUpdate(context.Context, runtime.Object, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type CommandApproval.
+func (v *CommandApprovalCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
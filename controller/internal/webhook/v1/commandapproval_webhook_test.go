@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+var _ = Describe("CommandApproval Webhook", func() {
+	var (
+		obj     *jarvisiov1.CommandApproval
+		command *jarvisiov1.Command
+	)
+
+	BeforeEach(func() {
+		command = &jarvisiov1.Command{
+			ObjectMeta: metav1.ObjectMeta{Name: "approved-command", Namespace: "default"},
+			Spec:       jarvisiov1.CommandSpec{Command: "uptime", AllNodes: true},
+		}
+		obj = &jarvisiov1.CommandApproval{
+			ObjectMeta: metav1.ObjectMeta{Name: "webhook-commandapproval", Namespace: "default"},
+			Spec:       jarvisiov1.CommandApprovalSpec{Command: command.Name},
+		}
+		Expect(obj).NotTo(BeNil(), "Expected obj to be initialized")
+	})
+
+	AfterEach(func() {
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+		Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, command))).To(Succeed())
+	})
+
+	Context("When creating CommandApproval under Defaulting Webhook", func() {
+		It("Should deny approving a Command that does not exist", func() {
+			Expect(k8sClient.Create(ctx, obj)).NotTo(Succeed())
+		})
+	})
+
+	Context("When creating CommandApproval under Validating Webhook", func() {
+		It("Should deny the creator approving their own Command", func() {
+			Expect(k8sClient.Create(ctx, command)).To(Succeed())
+			Expect(k8sClient.Create(ctx, obj)).NotTo(Succeed())
+		})
+	})
+})
@@ -0,0 +1,88 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+	"github.com/motilayo/jarvis/controller/internal/policy"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var commandpolicylog = logf.Log.WithName("commandpolicy-resource")
+
+// SetupCommandPolicyWebhookWithManager registers the webhook for CommandPolicy in the manager.
+func SetupCommandPolicyWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&jarvisiov1.CommandPolicy{}).
+		WithValidator(&CommandPolicyCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-jarvis-io-v1-commandpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=commandpolicies,verbs=create;update,versions=v1,name=vcommandpolicy-v1.kb.io,admissionReviewVersions=v1
+
+// CommandPolicyCustomValidator struct is responsible for validating the CommandPolicy resource
+// when it is created, updated, or deleted.
+//
+// It checks that the policy's patterns compile and its selectors parse, so
+// that a broken policy is not left to deny every Command it applies to.
+type CommandPolicyCustomValidator struct{}
+
+var _ webhook.CustomValidator = &CommandPolicyCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type CommandPolicy.
+func (v *CommandPolicyCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	commandPolicy, ok := obj.(*jarvisiov1.CommandPolicy)
+	if !ok {
+		return nil, fmt.Errorf("expected a CommandPolicy object but got %T", obj)
+	}
+	commandpolicylog.Info("Validation for CommandPolicy upon creation", "name", commandPolicy.GetName())
+
+	return nil, validateCommandPolicy(commandPolicy)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type CommandPolicy.
+func (v *CommandPolicyCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	commandPolicy, ok := newObj.(*jarvisiov1.CommandPolicy)
+	if !ok {
+		return nil, fmt.Errorf("expected a CommandPolicy object for the newObj but got %T", newObj)
+	}
+	commandpolicylog.Info("Validation for CommandPolicy upon update", "name", commandPolicy.GetName())
+
+	return nil, validateCommandPolicy(commandPolicy)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type CommandPolicy.
+func (v *CommandPolicyCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateCommandPolicy checks the parts of commandPolicy the API schema cannot.
+func validateCommandPolicy(commandPolicy *jarvisiov1.CommandPolicy) error {
+	specPath := field.NewPath("spec")
+	errs := policy.Validate(&commandPolicy.Spec, specPath)
+	return invalid("CommandPolicy", commandPolicy.Name, errs)
+}
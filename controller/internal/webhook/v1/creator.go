@@ -0,0 +1,95 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// creators records who asked for a command to be run.
+type creators struct {
+	// controllerUser is the user the controller runs as. The Commands it
+	// creates for a CronCommand keep the CronCommand's creator.
+	controllerUser string
+}
+
+// stamp sets spec.CreatedBy to the user making the request on creation, and
+// keeps it as it was on update. Once recorded, only that user may change what
+// spec runs; pausing and resuming is left to anyone who may update the
+// object. oldSpec decodes the spec from the object being updated.
+func (c creators) stamp(ctx context.Context, resource, name string, spec *jarvisiov1.CommandSpec,
+	oldSpec func(raw []byte) (*jarvisiov1.CommandSpec, error)) error {
+	req, err := admission.RequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	user := req.UserInfo
+	fromController := c.controllerUser != "" && user.Username == c.controllerUser
+
+	switch req.Operation {
+	case admissionv1.Create:
+		if fromController && spec.CreatedBy != nil {
+			// Run on behalf of a CronCommand's creator.
+			return nil
+		}
+		spec.CreatedBy = user.DeepCopy()
+	case admissionv1.Update:
+		old, err := oldSpec(req.OldObject.Raw)
+		if err != nil {
+			return err
+		}
+		if old.CreatedBy == nil {
+			// Created before the webhook was installed. The controller
+			// only ever updates metadata, so it does not become the creator.
+			if !fromController {
+				spec.CreatedBy = user.DeepCopy()
+			}
+			return nil
+		}
+		spec.CreatedBy = old.CreatedBy.DeepCopy()
+		if fromController || user.Username == old.CreatedBy.Username {
+			return nil
+		}
+		changed, previous := spec.DeepCopy(), old.DeepCopy()
+		changed.Paused, previous.Paused = false, false
+		if !equality.Semantic.DeepEqual(changed, previous) {
+			return apierrors.NewForbidden(schema.GroupResource{Group: jarvisiov1.GroupVersion.Group, Resource: resource}, name,
+				fmt.Errorf("only %s, who created it, may change what it runs", old.CreatedBy.Username))
+		}
+	}
+	return nil
+}
+
+// ControllerUser asks the API server who c authenticates as.
+func ControllerUser(ctx context.Context, c client.Client) (string, error) {
+	review := &authenticationv1.SelfSubjectReview{}
+	if err := c.Create(ctx, review); err != nil {
+		return "", fmt.Errorf("SelfSubjectReview: %w", err)
+	}
+	return review.Status.UserInfo.Username, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	jarvisiov1 "github.com/motilayo/jarvis/controller/api/v1"
+)
+
+// nolint:unused
+// log is for logging in this package.
+var croncommandlog = logf.Log.WithName("croncommand-resource")
+
+// SetupCronCommandWebhookWithManager registers the webhook for CronCommand in the manager.
+func SetupCronCommandWebhookWithManager(mgr ctrl.Manager, controllerUser string) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&jarvisiov1.CronCommand{}).
+		WithDefaulter(&CronCommandCustomDefaulter{creators: creators{controllerUser: controllerUser}}).
+		WithValidator(&CronCommandCustomValidator{reader: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-jarvis-io-v1-croncommand,mutating=true,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=croncommands,verbs=create;update,versions=v1,name=mcroncommand-v1.kb.io,admissionReviewVersions=v1
+
+// CronCommandCustomDefaulter struct is responsible for setting default values on the custom resource of the
+// Kind CronCommand when those are created or updated.
+//
+// It records who created the CronCommand in spec.commandTemplate.createdBy,
+// which the Commands it creates run as.
+type CronCommandCustomDefaulter struct {
+	creators creators
+}
+
+var _ webhook.CustomDefaulter = &CronCommandCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind CronCommand.
+func (d *CronCommandCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	cronCommand, ok := obj.(*jarvisiov1.CronCommand)
+	if !ok {
+		return fmt.Errorf("expected an CronCommand object but got %T", obj)
+	}
+	croncommandlog.Info("Defaulting for CronCommand", "name", cronCommand.GetName())
+
+	return d.creators.stamp(ctx, "croncommands", cronCommand.Name, &cronCommand.Spec.CommandTemplate, func(raw []byte) (*jarvisiov1.CommandSpec, error) {
+		old := &jarvisiov1.CronCommand{}
+		err := json.Unmarshal(raw, old)
+		return &old.Spec.CommandTemplate, err
+	})
+}
+
+// +kubebuilder:webhook:path=/validate-jarvis-io-v1-croncommand,mutating=false,failurePolicy=fail,sideEffects=None,groups=jarvis.io,resources=croncommands,verbs=create;update,versions=v1,name=vcroncommand-v1.kb.io,admissionReviewVersions=v1
+
+// CronCommandCustomValidator struct is responsible for validating the CronCommand resource
+// when it is created, updated, or deleted.
+//
+// It holds spec.commandTemplate to the rules every Command it creates must
+// pass, command policies included, so a bad template is rejected up front
+// rather than on every tick.
+type CronCommandCustomValidator struct {
+	reader client.Reader
+}
+
+var _ webhook.CustomValidator = &CronCommandCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type CronCommand.
+func (v *CronCommandCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cronCommand, ok := obj.(*jarvisiov1.CronCommand)
+	if !ok {
+		return nil, fmt.Errorf("expected a CronCommand object but got %T", obj)
+	}
+	croncommandlog.Info("Validation for CronCommand upon creation", "name", cronCommand.GetName())
+
+	return nil, v.validate(ctx, cronCommand)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type CronCommand.
+func (v *CronCommandCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	cronCommand, ok := newObj.(*jarvisiov1.CronCommand)
+	if !ok {
+		return nil, fmt.Errorf("expected a CronCommand object for the newObj but got %T", newObj)
+	}
+	old, ok := oldObj.(*jarvisiov1.CronCommand)
+	if !ok {
+		return nil, fmt.Errorf("expected a CronCommand object for the oldObj but got %T", oldObj)
+	}
+	croncommandlog.Info("Validation for CronCommand upon update", "name", cronCommand.GetName())
+
+	if equality.Semantic.DeepEqual(cronCommand.Spec.CommandTemplate, old.Spec.CommandTemplate) {
+		return nil, nil
+	}
+	return nil, v.validate(ctx, cronCommand)
+}
+
+// validate checks the command template, and that it keeps to the policies.
+func (v *CronCommandCustomValidator) validate(ctx context.Context, cronCommand *jarvisiov1.CronCommand) error {
+	templatePath := field.NewPath("spec", "commandTemplate")
+	template := &cronCommand.Spec.CommandTemplate
+	errs := validateCommandSpec(template, templatePath)
+	violations, err := checkPolicies(ctx, v.reader, cronCommand.Namespace, template, templatePath)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	return invalid("CronCommand", cronCommand.Name, append(errs, violations...))
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type CronCommand.
+func (v *CronCommandCustomValidator) ValidateDelete(context.Context, runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// blockDevice matches the device files of whole disks and their partitions.
+var blockDevice = regexp.MustCompile(`^/dev/(sd|hd|vd|xvd)[a-z]|^/dev/(nvme|mmcblk|dm-)[0-9]|^/dev/mapper/`)
+
+// checkShell parses command and reports the first reason not to run it: a
+// syntax error, or a construct on the denylist. The denylist catches
+// mistakes, not a determined user; what a user may run is decided by whether
+// they may exec on the node at all.
+func checkShell(command string) error {
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	// The agent runs commands with /bin/sh, which is often bash. Parsing as
+	// bash accepts everything either would.
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return err
+	}
+	var denied error
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if denied != nil {
+			return false
+		}
+		switch node := node.(type) {
+		case *syntax.FuncDecl:
+			denied = checkForkBomb(node)
+		case *syntax.CallExpr:
+			denied = checkCall(node)
+		case *syntax.Redirect:
+			if isWrite(node.Op) {
+				if target := literal(node.Word); blockDevice.MatchString(target) {
+					denied = deny(node, "writes to the block device %s", target)
+				}
+			}
+		}
+		return true
+	})
+	return denied
+}
+
+// checkForkBomb rejects a function that calls itself more than once, or in
+// the background, like :(){ :|:& };:.
+func checkForkBomb(fn *syntax.FuncDecl) error {
+	calls, background := 0, false
+	syntax.Walk(fn.Body, func(node syntax.Node) bool {
+		stmt, ok := node.(*syntax.Stmt)
+		if !ok {
+			return true
+		}
+		if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && len(call.Args) > 0 && literal(call.Args[0]) == fn.Name.Value {
+			calls++
+			background = background || stmt.Background
+		}
+		return true
+	})
+	if calls > 1 || background {
+		return deny(fn, "function %s spawns copies of itself without bound (a fork bomb)", fn.Name.Value)
+	}
+	return nil
+}
+
+// checkCall rejects a recursive rm of the root filesystem, and dd or tee
+// writing to a block device. The script a shell is given with -c is checked
+// the same way.
+func checkCall(call *syntax.CallExpr) error {
+	args := make([]string, 0, len(call.Args))
+	for _, word := range call.Args {
+		args = append(args, literal(word))
+	}
+	// Look past wrappers that run the rest of the line as a command.
+	for len(args) > 0 && (args[0] == "sudo" || args[0] == "command" || args[0] == "exec") {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	switch path.Base(args[0]) {
+	case "rm":
+		recursive, root := false, false
+		for _, arg := range args[1:] {
+			switch {
+			case arg == "--recursive":
+				recursive = true
+			case arg == "/" || arg == "/*" || arg == "--no-preserve-root":
+				root = true
+			case strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.ContainsAny(arg, "rR"):
+				recursive = true
+			}
+		}
+		if recursive && root {
+			return deny(call, "recursively removes the root filesystem")
+		}
+	case "dd":
+		for _, arg := range args[1:] {
+			if target, ok := strings.CutPrefix(arg, "of="); ok && blockDevice.MatchString(target) {
+				return deny(call, "writes to the block device %s", target)
+			}
+		}
+	case "tee":
+		for _, arg := range args[1:] {
+			if blockDevice.MatchString(arg) {
+				return deny(call, "writes to the block device %s", arg)
+			}
+		}
+	case "sh", "bash", "dash", "ash", "zsh":
+		for i := 1; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+			if strings.HasPrefix(args[i], "--") || !strings.Contains(args[i], "c") || i+1 == len(args) {
+				continue
+			}
+			// A script built from expansions cannot be checked.
+			if script := args[i+1]; script != "" {
+				if err := checkShell(script); err != nil {
+					return deny(call, "runs a script that is not allowed: %v", err)
+				}
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// isWrite reports whether op redirects output to a file.
+func isWrite(op syntax.RedirOperator) bool {
+	switch op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrInOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+		return true
+	}
+	return false
+}
+
+// literal returns the value of word if it is made of plain and quoted text
+// only, and "" if it has expansions.
+func literal(word *syntax.Word) string {
+	if word == nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			b.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			b.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range part.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return ""
+				}
+				b.WriteString(lit.Value)
+			}
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// deny describes why the command at node is rejected.
+func deny(node syntax.Node, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", node.Pos(), fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckShell(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		// wantErr is part of the error expected, or empty if the command is
+		// allowed.
+		wantErr string
+	}{
+		{"plain command", "uptime", ""},
+		{"empty", "  ", "must not be empty"},
+		{"syntax error", "echo 'unterminated", "reached EOF"},
+
+		{"rm -rf /", "rm -rf /", "removes the root filesystem"},
+		{"rm with split flags", "rm -r -f /*", "removes the root filesystem"},
+		{"rm --recursive", "/bin/rm --recursive --no-preserve-root /", "removes the root filesystem"},
+		{"rm of a directory", "rm -rf /tmp/scratch", ""},
+		{"rm of / without -r", "rm -f /", ""},
+		{"behind sudo", "sudo rm -rf /", "removes the root filesystem"},
+
+		{"single-quoted", "rm -rf '/'", "removes the root filesystem"},
+		{"double-quoted", `rm -rf "/"`, "removes the root filesystem"},
+		{"quoted program", `'rm' "-rf" /`, "removes the root filesystem"},
+		{"quoted as an argument", `echo "rm -rf /"`, ""},
+
+		{"sh -c", `sh -c "rm -rf /"`, "removes the root filesystem"},
+		{"bash with combined flags", `bash -ec 'rm -rf /'`, "removes the root filesystem"},
+		{"sh -c nested twice", `sh -c "bash -c 'rm -rf /'"`, "removes the root filesystem"},
+		{"sh -c with a safe script", `sh -c 'df -h; uptime'`, ""},
+		{"sh -c with a built script", `sh -c "$SCRIPT"`, ""},
+		{"sh running a file", "sh /tmp/script.sh", ""},
+
+		{"command substitution", "echo $(rm -rf /)", "removes the root filesystem"},
+		{"backquotes", "echo `rm -rf /`", "removes the root filesystem"},
+		{"substitution as the target", "rm -rf $(echo /)", ""},
+
+		{"variable as the program", "RM=rm; $RM -rf /", ""},
+		{"variable as the target", "rm -rf $TARGET", ""},
+
+		{"after ;", "uptime; rm -rf /", "removes the root filesystem"},
+		{"after &&", "true && rm -rf /", "removes the root filesystem"},
+		{"after ||", "false || rm -rf /", "removes the root filesystem"},
+		{"in a pipeline", "yes | rm -rf /", "removes the root filesystem"},
+		{"in a subshell", "(cd /tmp && rm -rf /)", "removes the root filesystem"},
+
+		{"dd to a disk", "dd if=/dev/zero of=/dev/sda bs=1M", "block device /dev/sda"},
+		{"dd to a file", "dd if=/dev/zero of=/tmp/zero bs=1M count=1", ""},
+		{"tee to a partition", "echo x | tee /dev/nvme0n1p1", "block device /dev/nvme0n1p1"},
+		{"redirect to a disk", "cat image > /dev/vda", "block device /dev/vda"},
+		{"append to a mapper device", "echo x >> /dev/mapper/root", "block device /dev/mapper/root"},
+		{"redirect to /dev/null", "uptime > /dev/null 2>&1", ""},
+		{"read from a disk", "head -c 512 < /dev/sda", ""},
+
+		{"fork bomb", ":(){ :|:& };:", "fork bomb"},
+		{"recursive function", "f() { f; }", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkShell(tt.command)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkShell(%q) = %v, want nil", tt.command, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("checkShell(%q) = %v, want error containing %q", tt.command, err, tt.wantErr)
+			}
+		})
+	}
+}